@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// adminAuth guards the /admin routes, set from the -admin-api-key flag. When
+// nil the admin API is disabled.
+var adminAuth Authenticator
+
+// requireAdmin only lets requests carrying the admin API key through.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminAuth == nil {
+			writeError(w, "admin API is disabled; set -admin-api-key to enable it", http.StatusForbidden)
+			return
+		}
+		if _, err := adminAuth.Authenticate(r); err != nil {
+			writeError(w, errUnauthenticated.Error(), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// FlushCacheHandler clears the event cache, or only every user's entries for
+// the calendarId query parameter, along with every cached response, and reports
+// how many entries were cleared. Entries are keyed by calendar list ID, so
+// the primary alias is resolved first, as the server's own account.
+func (a *API) FlushCacheHandler(w http.ResponseWriter, r *http.Request) {
+	calendarID := r.URL.Query().Get("calendarId")
+	if calendarID == "primary" {
+		ctx, cancel := upstreamContext(r)
+		defer cancel()
+		srv, err := a.services.Get(ctx, "")
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		calendars, err := getCalendars(ctx, srv, []string{calendarID})
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		calendarID = calendars[0].Id
+	}
+	cleared := a.events.FlushCalendar(calendarID)
+	responses := a.responses.Flush()
+	logger.Infof("Flushed %d cache entries and %d responses (calendar=%q)", cleared, responses, calendarID)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]int{"cleared": cleared, "responses": responses}); err != nil {
+		logger.Errorf("Error encoding flush response %v", err)
+	}
+}
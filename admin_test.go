@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlushCacheHandler(t *testing.T) {
+	saved := adminAuth
+	var err error
+	if adminAuth, err = newAPIKeyAuthenticator("admin=secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { adminAuth = saved }()
+
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com", timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"))
+	api := newTestAPI(srv)
+	api.events = newEventCache(time.Hour)
+	flush := requireAdmin(api.FlushCacheHandler)
+	const target = "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"
+
+	listCalendar(t, api, target)
+	listCalendar(t, api, target)
+	if got := len(srv.eventListCalls()); got != 1 {
+		t.Fatalf("Events.List calls before flushing = %d, want 1", got)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		wantCode int
+		wantBody map[string]int
+	}{
+		{"wrong key", "guess", http.StatusUnauthorized, nil},
+		{"flush", "secret", http.StatusOK, map[string]int{"cleared": 1, "responses": 0}},
+		{"already empty", "secret", http.StatusOK, map[string]int{"cleared": 0, "responses": 0}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/admin/cache/flush", nil)
+		req.Header.Set("X-API-Key", tt.key)
+		rec := httptest.NewRecorder()
+		flush(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Fatalf("%s: status %d, want %d; body %s", tt.name, rec.Code, tt.wantCode, rec.Body)
+		}
+		if tt.wantBody == nil {
+			continue
+		}
+		var got map[string]int
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.wantBody) {
+			t.Errorf("%s: flushed %v, want %v", tt.name, got, tt.wantBody)
+		}
+	}
+
+	listCalendar(t, api, target)
+	if got := len(srv.eventListCalls()); got != 2 {
+		t.Errorf("Events.List calls after flushing = %d, want 2", got)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// agendaDay collects one day's events for the agenda view.
+type agendaDay struct {
+	date   time.Time
+	allDay []string
+	timed  []string
+}
+
+// renderAgenda lays out events as a plain-text agenda grouped by day in the
+// query's time zone, e.g.
+//
+//	Mon Jan 2
+//	  All day
+//	    Company offsite
+//	  09:00–09:30  Standup
+func renderAgenda(events []calendarEvent, q eventQuery) string {
+	sorted := make([]calendarEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return eventStart(sorted[i].Event).Before(eventStart(sorted[j].Event))
+	})
+
+	var folded map[string]string
+	if q.FoldRecurring {
+		folded = foldSeries(sorted, q.Location)
+	}
+	shown := make(map[string]bool)
+
+	days := make([]*agendaDay, 0)
+	byDate := make(map[string]*agendaDay)
+	for _, ce := range sorted {
+		series := ce.Event.RecurringEventId
+		label, fold := folded[series]
+		if fold {
+			if shown[series] {
+				continue
+			}
+			shown[series] = true
+		}
+
+		date, err := eventDate(ce.Event, q.Location)
+		if err != nil {
+			continue
+		}
+		day, ok := byDate[date]
+		if !ok {
+			d, _ := time.ParseInLocation(dateLayout, date, q.Location)
+			day = &agendaDay{date: d}
+			byDate[date] = day
+			days = append(days, day)
+		}
+
+		title := truncateSummary(ce.Event.Summary, q.MaxSummaryLen)
+		if isAllDay(ce.Event) {
+			day.allDay = append(day.allDay, title)
+			continue
+		}
+		start, end, err := eventTimes(ce.Event)
+		if err != nil {
+			continue
+		}
+		line := start.In(q.Location).Format("15:04") + "–" + end.In(q.Location).Format("15:04") + "  " + title
+		if fold {
+			line += " — " + label
+		}
+		day.timed = append(day.timed, line)
+	}
+
+	var b strings.Builder
+	for i, day := range days {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(day.date.Format("Mon Jan 2") + "\n")
+		if len(day.allDay) > 0 {
+			b.WriteString("  All day\n")
+			for _, title := range day.allDay {
+				b.WriteString("    " + title + "\n")
+			}
+		}
+		for _, line := range day.timed {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// foldSeries finds recurring series whose timed instances in events (sorted
+// by start) all share a title and local start and end times, and returns a
+// label describing each one's recurrence, such as "daily, Mon–Fri", keyed by
+// series ID. Series with a single instance aren't folded.
+func foldSeries(events []calendarEvent, loc *time.Location) map[string]string {
+	type series struct {
+		key    string
+		starts []time.Time
+		mixed  bool
+	}
+	bySeries := make(map[string]*series)
+	for _, ce := range events {
+		id := ce.Event.RecurringEventId
+		if id == "" || isTask(ce.Event) || isAllDay(ce.Event) {
+			continue
+		}
+		start, end, err := eventTimes(ce.Event)
+		if err != nil {
+			continue
+		}
+		start = start.In(loc)
+		key := ce.Event.Summary + "|" + start.Format("15:04") + "|" + end.In(loc).Format("15:04")
+		s, ok := bySeries[id]
+		if !ok {
+			s = &series{key: key}
+			bySeries[id] = s
+		}
+		if s.key != key {
+			s.mixed = true
+		}
+		s.starts = append(s.starts, start)
+	}
+
+	labels := make(map[string]string)
+	for id, s := range bySeries {
+		if s.mixed || len(s.starts) < 2 {
+			continue
+		}
+		labels[id] = recurrenceLabel(s.starts)
+	}
+	return labels
+}
+
+// recurrenceLabel describes how often starts recur and the span they cover.
+func recurrenceLabel(starts []time.Time) string {
+	frequency := "daily"
+	for i := 1; i < len(starts); i++ {
+		gap := int(starts[i].Sub(starts[i-1]).Hours()+12) / 24
+		switch {
+		case gap == 1 && frequency == "daily":
+		case gap == 1 || (gap == 3 && starts[i].Weekday() == time.Monday):
+			if frequency == "daily" || frequency == "weekdays" {
+				frequency = "weekdays"
+			} else {
+				frequency = "recurring"
+			}
+		case gap == 7 && (i == 1 || frequency == "weekly"):
+			frequency = "weekly"
+		default:
+			frequency = "recurring"
+		}
+	}
+
+	first, last := starts[0], starts[len(starts)-1]
+	if last.Sub(first) < 7*24*time.Hour {
+		return frequency + ", " + first.Format("Mon") + "–" + last.Format("Mon")
+	}
+	return frequency + ", " + first.Format("Jan 2") + "–" + last.Format("Jan 2")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRenderAgenda(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := ownedCalendar("work", "Work")
+	events := statsFixtures(cal,
+		timedEvent("review", "Review", "2024-03-05T02:30:00Z", "2024-03-05T03:00:00Z"),
+		timedEvent("standup", "Standup", "2024-03-04T14:00:00Z", "2024-03-04T14:15:00Z"),
+		allDayEvent("offsite", "Company offsite", "2024-03-04", "2024-03-05"),
+	)
+
+	tests := []struct {
+		name string
+		loc  *time.Location
+		want string
+	}{
+		{"UTC", time.UTC, "Mon Mar 4\n" +
+			"  All day\n" +
+			"    Company offsite\n" +
+			"  14:00–14:15  Standup\n" +
+			"\n" +
+			"Tue Mar 5\n" +
+			"  02:30–03:00  Review\n"},
+		// The late review falls on Monday evening in New York.
+		{"New York", newYork, "Mon Mar 4\n" +
+			"  All day\n" +
+			"    Company offsite\n" +
+			"  09:00–09:15  Standup\n" +
+			"  21:30–22:00  Review\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderAgenda(events, eventQuery{Location: tt.loc}); got != tt.want {
+				t.Errorf("renderAgenda() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderAgendaFoldsRecurring(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	events := statsFixtures(cal, timedEvent("review", "Review", "2024-03-06T14:00:00Z", "2024-03-06T15:00:00Z"))
+	for day := 4; day <= 8; day++ {
+		start := time.Date(2024, 3, day, 9, 0, 0, 0, time.UTC)
+		instance := timedEvent(fmt.Sprintf("standup_%d", day), "Standup", start.Format(time.RFC3339), start.Add(15*time.Minute).Format(time.RFC3339))
+		instance.RecurringEventId = "standup"
+		events = append(events, calendarEvent{Calendar: cal, Event: instance})
+	}
+
+	tests := []struct {
+		fold bool
+		want string
+	}{
+		{true, "Mon Mar 4\n" +
+			"  09:00–09:15  Standup — daily, Mon–Fri\n" +
+			"\n" +
+			"Wed Mar 6\n" +
+			"  14:00–15:00  Review\n"},
+		{false, "Mon Mar 4\n  09:00–09:15  Standup\n\n" +
+			"Tue Mar 5\n  09:00–09:15  Standup\n\n" +
+			"Wed Mar 6\n  09:00–09:15  Standup\n  14:00–15:00  Review\n\n" +
+			"Thu Mar 7\n  09:00–09:15  Standup\n\n" +
+			"Fri Mar 8\n  09:00–09:15  Standup\n"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("fold=%t", tt.fold), func(t *testing.T) {
+			if got := renderAgenda(events, eventQuery{Location: time.UTC, FoldRecurring: tt.fold}); got != tt.want {
+				t.Errorf("renderAgenda() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceLabel(t *testing.T) {
+	tests := []struct {
+		first time.Time
+		gaps  []int
+		want  string
+	}{
+		{time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), []int{1, 1, 1, 1}, "daily, Mon–Fri"},
+		// Friday to Monday is still a weekday series.
+		{time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC), []int{1, 1, 3, 1}, "weekdays, Wed–Tue"},
+		{time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), []int{7, 7}, "weekly, Mar 4–Mar 18"},
+		{time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), []int{2, 5}, "recurring, Mar 4–Mar 11"},
+	}
+	for _, tt := range tests {
+		starts := []time.Time{tt.first}
+		for _, gap := range tt.gaps {
+			starts = append(starts, starts[len(starts)-1].AddDate(0, 0, gap))
+		}
+		if got := recurrenceLabel(starts); got != tt.want {
+			t.Errorf("recurrenceLabel(%v) = %q, want %q", tt.gaps, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// errCalendarForbidden is returned for calendars outside the allowlist.
+var errCalendarForbidden = errors.New("calendar not allowed")
+
+// calendarAllowlist holds the calendar IDs the service may read, set by the
+// -calendar-allowlist flag. A nil allowlist allows every calendar.
+var calendarAllowlist map[string]bool
+
+// parseCalendarAllowlist reads a comma-separated list of calendar IDs, or
+// with a leading "@", a file of IDs separated by commas or newlines where
+// lines starting with "#" are ignored.
+func parseCalendarAllowlist(v string) (map[string]bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(v, "@") {
+		b, err := ioutil.ReadFile(v[1:])
+		if err != nil {
+			return nil, fmt.Errorf("unable to read calendar allowlist: %v", err)
+		}
+		lines := make([]string, 0)
+		for _, line := range strings.Split(string(b), "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+				lines = append(lines, line)
+			}
+		}
+		v = strings.Join(lines, ",")
+	}
+
+	allowed := make(map[string]bool)
+	for _, id := range strings.Split(v, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !validCalendarID(id) {
+			return nil, fmt.Errorf("invalid calendar ID %q in allowlist", id)
+		}
+		allowed[id] = true
+	}
+	if len(allowed) == 0 {
+		return nil, errors.New("calendar allowlist is empty")
+	}
+	return allowed, nil
+}
+
+// calendarAllowed reports whether the service may read any of the given
+// names for one calendar, e.g. "primary" and the address it resolves to.
+func calendarAllowed(ids ...string) bool {
+	if calendarAllowlist == nil {
+		return true
+	}
+	for _, id := range ids {
+		if calendarAllowlist[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCalendarAllowlist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "allowlist")
+	if err := ioutil.WriteFile(file, []byte("# team calendars\nteam@group.calendar.google.com\nme@example.com,  ops@example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in      string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"me@example.com, team@group.calendar.google.com,", map[string]bool{"me@example.com": true, "team@group.calendar.google.com": true}, false},
+		{"@" + file, map[string]bool{"me@example.com": true, "ops@example.com": true, "team@group.calendar.google.com": true}, false},
+		{"@" + filepath.Join(filepath.Dir(file), "missing"), nil, true},
+		{" , ", nil, true},
+		{"not a calendar", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCalendarAllowlist(tt.in)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCalendarAllowlist(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCalendarAllowlist(t *testing.T) {
+	const team, blocked = "team@group.calendar.google.com", "blocked@group.calendar.google.com"
+	saved := calendarAllowlist
+	calendarAllowlist = map[string]bool{"me@example.com": true, team: true}
+	defer func() { calendarAllowlist = saved }()
+
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar(team, "Team"), ownedCalendar(blocked, "Blocked"))
+	srv.addEvents(team, timedEvent("teams", "Team's", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"))
+	srv.addEvents(blocked, timedEvent("secret", "Secret", "2024-03-06T09:00:00Z", "2024-03-06T10:00:00Z"))
+	const window = "&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+	}{
+		{"allowlisted", "/calendar?calendars=" + team + window, http.StatusOK},
+		{"blocked", "/calendar?calendars=" + blocked + window, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).CalendarHandler, tt.target)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+
+	// Listing every calendar quietly leaves out the blocked one.
+	rec := serve(newTestAPI(srv).CalendarsHandler, "/calendars?includeSubscribed=true")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var infos []CalendarInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(infos))
+	for _, info := range infos {
+		ids = append(ids, info.ID)
+	}
+	if want := []string{"me@example.com", team}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("calendars = %v, want %v", ids, want)
+	}
+}
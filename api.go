@@ -0,0 +1,28 @@
+package main
+
+import "golang.org/x/sync/singleflight"
+
+// API serves the calendar endpoints, over HTTP and gRPC. It holds what
+// requests share: each user's Calendar API client and the caches in front of
+// Google. main builds one at startup; tests can build one around a provider
+// of fakes.
+type API struct {
+	services serviceProvider
+	// events holds fetched events per calendar and query, set up by the
+	// -event-cache-ttl flag. A nil cache disables caching.
+	events *eventCache
+	// responses holds rendered /calendar and /stats responses, set up by
+	// the -response-cache-ttl flag. A nil cache still tags responses with
+	// ETags so clients can revalidate.
+	responses *renderedCache
+	// inflight shares one upstream fetch between identical concurrent
+	// requests for a calendar's events. A nil group, set by
+	// -dedupe-requests=false, fetches separately for every request.
+	inflight *singleflight.Group
+}
+
+// newAPI returns an API reaching Google through services, with caching and
+// request sharing off.
+func newAPI(services serviceProvider) *API {
+	return &API{services: services}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// errUnauthenticated is returned when a request carries no usable credentials.
+var errUnauthenticated = errors.New("missing or invalid credentials")
+
+// Principal identifies the caller of the HTTP API.
+type Principal struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+}
+
+// Authenticator verifies the credentials on a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+type principalKey struct{}
+
+// withPrincipal returns a copy of ctx carrying p.
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFromContext returns the authenticated caller, if any.
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// authEnabled reports whether API authentication is configured, in which
+// case each caller acts as their own Google account.
+var authEnabled bool
+
+// publicPaths are served without authentication.
+var publicPaths = map[string]bool{
+	"/":             true,
+	"/healthz":      true,
+	"/health":       true,
+	"/readyz":       true,
+	"/readiness":    true,
+	"/metrics":      true,
+	"/openapi.json": true,
+	// Google redirects the browser here without API credentials; the
+	// state parameter ties the callback to an authenticated login.
+	"/oauth/callback": true,
+	"/auth/callback":  true,
+	// Google's push notifications are checked against the channel token.
+	"/notifications": true,
+}
+
+// authMiddleware rejects requests to non-public routes that fail
+// authentication by a, or that exceed the principal's rate limit when
+// limiter is set, and attaches the principal to the request context
+// otherwise.
+func authMiddleware(a Authenticator, limiter *rateLimiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Admin routes check the admin key themselves.
+			if publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/admin/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			p, err := a.Authenticate(r)
+			if err != nil {
+				logger.Warnf("Rejected request to %s: %v", r.URL.Path, err)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, errUnauthenticated.Error(), http.StatusUnauthorized)
+				return
+			}
+			if limiter != nil {
+				if ok, wait := limiter.Allow(p.Method + ":" + p.Subject); !ok {
+					logger.Warnf("Rate limited %s %q on %s", p.Method, p.Subject, r.URL.Path)
+					w.Header().Set("Retry-After", retryAfterSeconds(wait))
+					writeError(w, "rate limit exceeded", http.StatusTooManyRequests)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// apiKeyAuthenticator accepts requests whose X-API-Key header matches one of
+// its keys.
+type apiKeyAuthenticator struct {
+	keys map[string]string // key -> principal name
+}
+
+// newAPIKeyAuthenticator parses a comma-separated list of keys, each either
+// bare or written as name=key to name the principal.
+func newAPIKeyAuthenticator(list string) (*apiKeyAuthenticator, error) {
+	a := &apiKeyAuthenticator{keys: make(map[string]string)}
+	for i, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name := fmt.Sprintf("key-%d", i+1)
+		key := entry
+		if eq := strings.Index(entry, "="); eq >= 0 {
+			name, key = entry[:eq], entry[eq+1:]
+		}
+		if key == "" {
+			return nil, fmt.Errorf("API key %q is empty", name)
+		}
+		a.keys[key] = name
+	}
+	if len(a.keys) == 0 {
+		return nil, errors.New("no API keys configured")
+	}
+	return a, nil
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	given := r.Header.Get("X-API-Key")
+	if given == "" {
+		return Principal{}, errUnauthenticated
+	}
+	for key, name := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(key)) == 1 {
+			return Principal{Subject: name, Method: "apikey"}, nil
+		}
+	}
+	return Principal{}, errUnauthenticated
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
+
+// authOptions selects and configures the API authenticator from flags.
+type authOptions struct {
+	Mode        string
+	APIKeys     string
+	JWTSecret   string
+	JWKSURL     string
+	JWTIssuer   string
+	JWTAudience string
+}
+
+// newAuthenticator builds the authenticator for opts.Mode, returning nil when
+// authentication is disabled.
+func newAuthenticator(opts authOptions) (Authenticator, error) {
+	switch opts.Mode {
+	case "", "none":
+		return nil, nil
+	case "apikey":
+		return newAPIKeyAuthenticator(opts.APIKeys)
+	case "jwt":
+		return newJWTAuthenticator(opts.JWTSecret, opts.JWKSURL, opts.JWTIssuer, opts.JWTAudience)
+	}
+	return nil, fmt.Errorf("invalid auth mode %q: must be none, apikey or jwt", opts.Mode)
+}
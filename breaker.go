@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// errBreakerOpen is returned instead of calling Google while the breaker is open.
+var errBreakerOpen = errors.New("circuit breaker open: Google Calendar API is unavailable")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker trips open after threshold consecutive upstream failures and
+// fails fast until cooldown has passed, then lets a single probe call through
+// to decide whether to close again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     breakerState
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a call may go upstream, moving an open breaker to
+// half-open once the cooldown has elapsed.
+func (b *circuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return errBreakerOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return errBreakerOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success records a successful upstream call and closes the breaker.
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	b.state = breakerClosed
+}
+
+// Failure records a failed upstream call, tripping the breaker when the
+// threshold is reached or when a half-open probe fails.
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// State returns the current breaker state.
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return breakerHalfOpen
+	}
+	return b.state
+}
+
+// Do runs fn if the breaker allows it and records the outcome.
+func (b *circuitBreaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	googleAPICalls.Inc()
+	err := fn()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		recordGoogleAPIError(err)
+	}
+	if err != nil && isUpstreamFailure(err) {
+		b.Failure()
+	} else {
+		b.Success()
+	}
+	return err
+}
+
+// isUpstreamFailure reports whether err means Google itself is unhealthy, as
+// opposed to a client error such as a bad calendar ID or a cancelled request.
+func isUpstreamFailure(err error) bool {
+	// A client going away or a revoked token says nothing about Google's
+	// health.
+	if errors.Is(err, context.Canceled) || errors.Is(err, errNotAuthorized) {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= http.StatusInternalServerError || apiErr.Code == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	errUpstream := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	tests := []struct {
+		name    string
+		results []error
+		wait    time.Duration
+		want    breakerState
+	}{
+		{"closed below threshold", []error{errUpstream, errUpstream}, 0, breakerClosed},
+		{"opens at threshold", []error{errUpstream, errUpstream, errUpstream}, 0, breakerOpen},
+		{"success resets the count", []error{errUpstream, errUpstream, nil, errUpstream, errUpstream}, 0, breakerClosed},
+		{"client errors don't count", []error{&googleapi.Error{Code: http.StatusNotFound}, context.Canceled, errNotAuthorized, errUpstream}, 0, breakerClosed},
+		{"half-open after cooldown", []error{errUpstream, errUpstream, errUpstream}, time.Minute, breakerHalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+			b := newCircuitBreaker(3, time.Minute)
+			b.now = func() time.Time { return at }
+			for _, result := range tt.results {
+				result := result
+				b.Do(func() error { return result })
+			}
+			at = at.Add(tt.wait)
+			if got := b.State(); got != tt.want {
+				t.Errorf("State() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerFailsFastWhileOpen(t *testing.T) {
+	at := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return at }
+	errUpstream := &googleapi.Error{Code: http.StatusInternalServerError}
+	for i := 0; i < 2; i++ {
+		b.Do(func() error { return errUpstream })
+	}
+
+	called := false
+	if err := b.Do(func() error { called = true; return nil }); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("Do while open = %v, want errBreakerOpen", err)
+	}
+	if called {
+		t.Fatal("Do called upstream while open")
+	}
+
+	// One probe goes through after the cooldown; a failed probe reopens.
+	at = at.Add(time.Minute)
+	if err := b.Do(func() error { return errUpstream }); err != errUpstream {
+		t.Fatalf("probe = %v, want the upstream error", err)
+	}
+	if got := b.State(); got != breakerOpen {
+		t.Fatalf("after failed probe State() = %v, want open", got)
+	}
+
+	at = at.Add(time.Minute)
+	if err := b.Do(func() error { return nil }); err != nil {
+		t.Fatalf("probe = %v, want success", err)
+	}
+	if got := b.State(); got != breakerClosed {
+		t.Errorf("after successful probe State() = %v, want closed", got)
+	}
+}
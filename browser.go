@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// autoOpenBrowser is set by the -open-browser flag.
+var autoOpenBrowser bool
+
+// openBrowser launches the default browser at url. It is a variable so the
+// interactive auth flow can be exercised without starting a real browser.
+var openBrowser = openURL
+
+// offerLogin opens the browser at loginURL when -open-browser is set. The
+// URL has already been logged, so failing to open it is only logged.
+func offerLogin(loginURL string) {
+	if !autoOpenBrowser {
+		return
+	}
+	if err := openBrowser(loginURL); err != nil {
+		logger.Errorf("Unable to open browser, use the link above instead: %v", err)
+	}
+}
+
+// openURL opens url with the platform's default browser.
+func openURL(url string) error {
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "windows":
+		name, args = "rundll32", []string{"url.dll,FileProtocolHandler", url}
+	case "darwin":
+		name, args = "open", []string{url}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		name, args = "xdg-open", []string{url}
+	default:
+		return fmt.Errorf("opening a browser is not supported on %s", runtime.GOOS)
+	}
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the launcher once it exits so it doesn't linger as a zombie.
+	go cmd.Wait()
+	return nil
+}
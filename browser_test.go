@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOfferLogin(t *testing.T) {
+	savedOpen, savedAuto := openBrowser, autoOpenBrowser
+	defer func() { openBrowser, autoOpenBrowser = savedOpen, savedAuto }()
+
+	tests := []struct {
+		autoOpen bool
+		want     []string
+	}{
+		{false, nil},
+		{true, []string{"http://localhost:8080/oauth/login"}},
+	}
+	for _, tt := range tests {
+		var opened []string
+		openBrowser = func(url string) error {
+			opened = append(opened, url)
+			return nil
+		}
+		autoOpenBrowser = tt.autoOpen
+		offerLogin("http://localhost:8080/oauth/login")
+		if !reflect.DeepEqual(opened, tt.want) {
+			t.Errorf("with -open-browser=%v opened %v, want %v", tt.autoOpen, opened, tt.want)
+		}
+	}
+}
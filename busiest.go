@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const defaultBusiestDays = 7
+
+// BusiestPeriod is the run of consecutive days with the most meeting minutes.
+// Start and End are inclusive dates.
+type BusiestPeriod struct {
+	Start        string  `json:"start"`
+	End          string  `json:"end"`
+	Days         int     `json:"days"`
+	TotalMinutes float64 `json:"totalMinutes"`
+}
+
+// busiestPeriod slides a days-long period across the window's daily minutes
+// and returns the one with the highest total, the earliest on ties. Windows
+// shorter than days are returned whole.
+func busiestPeriod(h Heatmap, q eventQuery, days int) BusiestPeriod {
+	dates := make([]string, 0, len(h.Minutes))
+	y, m, d := q.TimeMin.In(q.Location).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, q.Location); day.Before(q.TimeMax); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format(dateLayout))
+	}
+	if len(dates) == 0 {
+		return BusiestPeriod{}
+	}
+	if days > len(dates) {
+		days = len(dates)
+	}
+
+	// prefix[i] holds the minutes of the first i days.
+	prefix := make([]float64, len(dates)+1)
+	for i, date := range dates {
+		prefix[i+1] = prefix[i] + h.Minutes[date]
+	}
+
+	best := 0
+	for i := 1; i+days <= len(dates); i++ {
+		if prefix[i+days]-prefix[i] > prefix[best+days]-prefix[best] {
+			best = i
+		}
+	}
+	return BusiestPeriod{
+		Start:        dates[best],
+		End:          dates[best+days-1],
+		Days:         days,
+		TotalMinutes: prefix[best+days] - prefix[best],
+	}
+}
+
+// BusiestHandler returns the busiest run of days (seven unless the days
+// parameter says otherwise) within the window. Here days is the period's
+// length, so it doesn't size the window as it does on other routes.
+func (a *API) BusiestHandler(w http.ResponseWriter, r *http.Request) {
+	days, err := parseIntParam(r.URL.Query(), "days", defaultBusiestDays)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if days < 1 {
+		writeError(w, "days must be positive", http.StatusBadRequest)
+		return
+	}
+
+	values := r.URL.Query()
+	values.Del("days")
+	q, err := parseEventValues(values)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	h, err := buildHeatmap(events, q)
+	if err != nil {
+		logger.Error(err)
+		writeError(w, "unable to compute busiest period", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(busiestPeriod(h, q, days)); err != nil {
+		logger.Errorf("Error encoding busiest period response %v", err)
+	}
+}
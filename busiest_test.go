@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBusiestHandler(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		timedEvent("early", "Kickoff", "2024-03-01T09:00:00Z", "2024-03-01T11:00:00Z"),
+		// The crunch: four hours on each of 11 to 13 March.
+		timedEvent("c1", "Crunch", "2024-03-11T09:00:00Z", "2024-03-11T13:00:00Z"),
+		timedEvent("c2", "Crunch", "2024-03-12T09:00:00Z", "2024-03-12T13:00:00Z"),
+		timedEvent("c3", "Crunch", "2024-03-13T09:00:00Z", "2024-03-13T13:00:00Z"),
+		timedEvent("late", "Retro", "2024-03-25T09:00:00Z", "2024-03-25T10:00:00Z"),
+	)
+	const window = "&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     BusiestPeriod
+	}{
+		// Ties go to the earliest week holding the whole crunch.
+		{"", http.StatusOK, BusiestPeriod{Start: "2024-03-07", End: "2024-03-13", Days: 7, TotalMinutes: 720}},
+		{"days=2", http.StatusOK, BusiestPeriod{Start: "2024-03-11", End: "2024-03-12", Days: 2, TotalMinutes: 480}},
+		{"days=1", http.StatusOK, BusiestPeriod{Start: "2024-03-11", End: "2024-03-11", Days: 1, TotalMinutes: 240}},
+		{"days=90", http.StatusOK, BusiestPeriod{Start: "2024-03-01", End: "2024-03-30", Days: 30, TotalMinutes: 900}},
+		{"days=0", http.StatusBadRequest, BusiestPeriod{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).BusiestHandler, "/busiest?"+tt.query+window)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d; body %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var got BusiestPeriod
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("busiest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
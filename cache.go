@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// maxCacheEntries bounds the cache; the oldest entry is evicted when full.
+const maxCacheEntries = 1000
+
+type eventCacheEntry struct {
+	user       string
+	calendarID string
+	etag       string
+	events     []*calendar.Event
+	stored     time.Time
+}
+
+// eventCache stores the raw events of a calendar for a query, valid while
+// the calendar's CalendarList etag is unchanged and the entry is younger
+// than ttl. The TTL bounds staleness since event edits don't always change
+// the calendar's etag.
+type eventCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]eventCacheEntry
+	now     func() time.Time
+}
+
+func newEventCache(ttl time.Duration) *eventCache {
+	return &eventCache{ttl: ttl, entries: make(map[string]eventCacheEntry), now: time.Now}
+}
+
+// eventCacheKey identifies the Events.List request made for a user's
+// calendar. Users sharing a calendar may see different parts of it, so each
+// gets their own entries.
+func eventCacheKey(user, calendarID string, q eventQuery) string {
+	return fmt.Sprintf("%s|%t|%s|%s|%s|%s", syncKey(user, calendarID), q.SingleEvents, q.OrderBy, q.TimeMin.UTC().Format(time.RFC3339), q.TimeMax.UTC().Format(time.RFC3339), q.Search)
+}
+
+// Get returns the cached events for key if they were stored under etag and
+// haven't expired.
+func (c *eventCache) Get(key, etag string) ([]*calendar.Event, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || etag == "" || entry.etag != etag || c.now().Sub(entry.stored) >= c.ttl {
+		return nil, false
+	}
+	return entry.events, true
+}
+
+// Put stores the events fetched for key under the calendar's etag.
+func (c *eventCache) Put(key, user, calendarID, etag string, events []*calendar.Event) {
+	if c == nil || etag == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		c.evictOldest()
+	}
+	c.entries[key] = eventCacheEntry{user: user, calendarID: calendarID, etag: etag, events: events, stored: c.now()}
+}
+
+// evictOldest removes the least recently stored entry. c.mu must be held.
+func (c *eventCache) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if oldestKey == "" || entry.stored.Before(oldest) {
+			oldestKey, oldest = key, entry.stored
+		}
+	}
+	delete(c.entries, oldestKey)
+}
+
+// Flush removes user's cached entries for calendarID, or all of user's
+// entries when calendarID is empty, and returns how many were removed.
+func (c *eventCache) Flush(user, calendarID string) int {
+	return c.remove(func(entry eventCacheEntry) bool {
+		return entry.user == user && (calendarID == "" || entry.calendarID == calendarID)
+	})
+}
+
+// FlushCalendar removes every user's cached entries for calendarID, or every
+// entry when calendarID is empty, and returns how many were removed.
+func (c *eventCache) FlushCalendar(calendarID string) int {
+	return c.remove(func(entry eventCacheEntry) bool {
+		return calendarID == "" || entry.calendarID == calendarID
+	})
+}
+
+// remove deletes the entries match selects.
+func (c *eventCache) remove(match func(eventCacheEntry) bool) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, entry := range c.entries {
+		if match(entry) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventCache(t *testing.T) {
+	const target = "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"
+	tests := []struct {
+		name string
+		// between runs after the first request is cached.
+		between   func(srv *fakeCalendarService, c *eventCache, at *time.Time)
+		wantFetch int
+	}{
+		{"unchanged etag hits", func(*fakeCalendarService, *eventCache, *time.Time) {}, 1},
+		{"changed etag misses", func(srv *fakeCalendarService, _ *eventCache, _ *time.Time) {
+			srv.calendars[0].Etag = `"changed"`
+		}, 2},
+		{"expired entry misses", func(_ *fakeCalendarService, _ *eventCache, at *time.Time) {
+			*at = at.Add(time.Minute)
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeService(primaryCalendar("me@example.com"))
+			srv.addEvents("me@example.com", timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"))
+			api := newTestAPI(srv)
+			at := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+			api.events = newEventCache(time.Minute)
+			api.events.now = func() time.Time { return at }
+
+			listCalendar(t, api, target)
+			tt.between(srv, api.events, &at)
+			events := listCalendar(t, api, target)
+			if len(events) != 1 {
+				t.Errorf("listed %d events, want 1", len(events))
+			}
+			if got := len(srv.eventListCalls()); got != tt.wantFetch {
+				t.Errorf("Events.List calls = %d, want %d", got, tt.wantFetch)
+			}
+		})
+	}
+}
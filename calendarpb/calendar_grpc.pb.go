@@ -0,0 +1,217 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package calendarpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CalendarServiceClient is the client API for CalendarService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CalendarServiceClient interface {
+	// ListEvents returns the events in a window, like GET /calendar.
+	ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error)
+	// GetStats reports time spent by group, like GET /stats.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
+	// CreateEvent adds an event, like POST /calendar.
+	CreateEvent(ctx context.Context, in *CreateEventRequest, opts ...grpc.CallOption) (*CreateEventResponse, error)
+	// FreeBusy reports when calendars are busy and free, like GET /freebusy.
+	FreeBusy(ctx context.Context, in *FreeBusyRequest, opts ...grpc.CallOption) (*FreeBusyResponse, error)
+}
+
+type calendarServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCalendarServiceClient(cc grpc.ClientConnInterface) CalendarServiceClient {
+	return &calendarServiceClient{cc}
+}
+
+func (c *calendarServiceClient) ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error) {
+	out := new(ListEventsResponse)
+	err := c.cc.Invoke(ctx, "/caltracker.v1.CalendarService/ListEvents", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarServiceClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, "/caltracker.v1.CalendarService/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarServiceClient) CreateEvent(ctx context.Context, in *CreateEventRequest, opts ...grpc.CallOption) (*CreateEventResponse, error) {
+	out := new(CreateEventResponse)
+	err := c.cc.Invoke(ctx, "/caltracker.v1.CalendarService/CreateEvent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarServiceClient) FreeBusy(ctx context.Context, in *FreeBusyRequest, opts ...grpc.CallOption) (*FreeBusyResponse, error) {
+	out := new(FreeBusyResponse)
+	err := c.cc.Invoke(ctx, "/caltracker.v1.CalendarService/FreeBusy", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CalendarServiceServer is the server API for CalendarService service.
+// All implementations must embed UnimplementedCalendarServiceServer
+// for forward compatibility
+type CalendarServiceServer interface {
+	// ListEvents returns the events in a window, like GET /calendar.
+	ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error)
+	// GetStats reports time spent by group, like GET /stats.
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	// CreateEvent adds an event, like POST /calendar.
+	CreateEvent(context.Context, *CreateEventRequest) (*CreateEventResponse, error)
+	// FreeBusy reports when calendars are busy and free, like GET /freebusy.
+	FreeBusy(context.Context, *FreeBusyRequest) (*FreeBusyResponse, error)
+	mustEmbedUnimplementedCalendarServiceServer()
+}
+
+// UnimplementedCalendarServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCalendarServiceServer struct {
+}
+
+func (UnimplementedCalendarServiceServer) ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEvents not implemented")
+}
+func (UnimplementedCalendarServiceServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedCalendarServiceServer) CreateEvent(context.Context, *CreateEventRequest) (*CreateEventResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateEvent not implemented")
+}
+func (UnimplementedCalendarServiceServer) FreeBusy(context.Context, *FreeBusyRequest) (*FreeBusyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FreeBusy not implemented")
+}
+func (UnimplementedCalendarServiceServer) mustEmbedUnimplementedCalendarServiceServer() {}
+
+// UnsafeCalendarServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CalendarServiceServer will
+// result in compilation errors.
+type UnsafeCalendarServiceServer interface {
+	mustEmbedUnimplementedCalendarServiceServer()
+}
+
+func RegisterCalendarServiceServer(s grpc.ServiceRegistrar, srv CalendarServiceServer) {
+	s.RegisterService(&CalendarService_ServiceDesc, srv)
+}
+
+func _CalendarService_ListEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServiceServer).ListEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/caltracker.v1.CalendarService/ListEvents",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServiceServer).ListEvents(ctx, req.(*ListEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CalendarService_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServiceServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/caltracker.v1.CalendarService/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServiceServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CalendarService_CreateEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServiceServer).CreateEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/caltracker.v1.CalendarService/CreateEvent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServiceServer).CreateEvent(ctx, req.(*CreateEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CalendarService_FreeBusy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FreeBusyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServiceServer).FreeBusy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/caltracker.v1.CalendarService/FreeBusy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServiceServer).FreeBusy(ctx, req.(*FreeBusyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CalendarService_ServiceDesc is the grpc.ServiceDesc for CalendarService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CalendarService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "caltracker.v1.CalendarService",
+	HandlerType: (*CalendarServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListEvents",
+			Handler:    _CalendarService_ListEvents_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _CalendarService_GetStats_Handler,
+		},
+		{
+			MethodName: "CreateEvent",
+			Handler:    _CalendarService_CreateEvent_Handler,
+		},
+		{
+			MethodName: "FreeBusy",
+			Handler:    _CalendarService_FreeBusy_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "calendar.proto",
+}
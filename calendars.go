@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type CalendarInfo struct {
+	ID         string `json:"id"`
+	Summary    string `json:"summary"`
+	AccessRole string `json:"accessRole"`
+	Primary    bool   `json:"primary"`
+	Subscribed bool   `json:"subscribed"`
+	TimeZone   string `json:"timeZone,omitempty"`
+	Color      string `json:"color"`
+}
+
+// CalendarsHandler lists the calendars a /calendar request with the same
+// calendars, minAccessRole and excludeCalendars parameters would aggregate,
+// so clients know which IDs they can filter on.
+func (a *API) CalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	calendars, err := listCalendars(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	infos := make([]CalendarInfo, 0, len(calendars))
+	for _, entry := range calendars {
+		infos = append(infos, CalendarInfo{
+			ID:         entry.Id,
+			Summary:    entry.Summary,
+			AccessRole: entry.AccessRole,
+			Primary:    entry.Primary,
+			Subscribed: isSubscribed(entry),
+			TimeZone:   entry.TimeZone,
+			Color:      calendarColor(entry, q.UseGoogleColors),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		logger.Errorf("Error encoding calendars %v", err)
+	}
+}
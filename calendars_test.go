@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestCalendarsHandler(t *testing.T) {
+	// The primary calendar counts as owned whatever its access role says.
+	primary := primaryCalendar("me@example.com")
+	primary.AccessRole = "reader"
+	holidays := ownedCalendar("en.usa#holiday@group.v.calendar.google.com", "Holidays")
+	holidays.AccessRole = "reader"
+	shared := ownedCalendar("team@group.calendar.google.com", "Team")
+	shared.AccessRole = "writer"
+	srv := newFakeService(primary, ownedCalendar("side@group.calendar.google.com", "Side project"), holidays, shared)
+
+	tests := []struct {
+		query          string
+		wantIDs        []string
+		wantSubscribed []bool
+	}{
+		{"", []string{"side@group.calendar.google.com"}, []bool{false}},
+		{"includeSubscribed=true", []string{"me@example.com", "side@group.calendar.google.com", holidays.Id, shared.Id}, []bool{false, false, true, true}},
+		{"minAccessRole=writer", []string{"side@group.calendar.google.com", shared.Id}, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).CalendarsHandler, "/calendars?"+tt.query)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			var infos []CalendarInfo
+			if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+				t.Fatal(err)
+			}
+			ids, subscribed := make([]string, 0), make([]bool, 0)
+			for _, info := range infos {
+				ids = append(ids, info.ID)
+				subscribed = append(subscribed, info.Subscribed)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || !reflect.DeepEqual(subscribed, tt.wantSubscribed) {
+				t.Errorf("calendars = %v subscribed %v, want %v subscribed %v", ids, subscribed, tt.wantIDs, tt.wantSubscribed)
+			}
+		})
+	}
+}
+
+func TestIsSubscribed(t *testing.T) {
+	tests := []struct {
+		entry *calendar.CalendarListEntry
+		want  bool
+	}{
+		{&calendar.CalendarListEntry{AccessRole: "owner"}, false},
+		{&calendar.CalendarListEntry{AccessRole: "reader", Primary: true}, false},
+		{&calendar.CalendarListEntry{AccessRole: "reader"}, true},
+		{&calendar.CalendarListEntry{AccessRole: "writer"}, true},
+	}
+	for _, tt := range tests {
+		if got := isSubscribed(tt.entry); got != tt.want {
+			t.Errorf("isSubscribed(%+v) = %v, want %v", tt.entry, got, tt.want)
+		}
+	}
+}
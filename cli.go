@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// commands describes the subcommands. serve runs when none is given, so
+// existing invocations with flags only keep starting the server.
+var commands = map[string]string{
+	"serve":      "run the HTTP API (the default)",
+	"events":     "print the events in a window, e.g. events -from -30d -format csv",
+	"auth login": "authorize access to a Google account and store its token",
+}
+
+// splitCommand returns the subcommand args start with and the arguments
+// after it.
+func splitCommand(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "serve", args, nil
+	}
+	name, rest := args[0], args[1:]
+	if name == "auth" && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		name, rest = name+" "+rest[0], rest[1:]
+	}
+	if _, ok := commands[name]; !ok {
+		return "", nil, fmt.Errorf("unknown command %q", name)
+	}
+	return name, rest, nil
+}
+
+// commandUsage lists the subcommands.
+func commandUsage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, commands[name])
+	}
+}
+
+// paramValues collects repeated -param name=value flags.
+type paramValues url.Values
+
+func (p paramValues) String() string {
+	return url.Values(p).Encode()
+}
+
+func (p paramValues) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i < 1 {
+		return fmt.Errorf("%q is not name=value", v)
+	}
+	url.Values(p).Add(v[:i], v[i+1:])
+	return nil
+}
+
+// cliOptions holds the flags of the events and auth login commands.
+type cliOptions struct {
+	From, To, Window, TZ string
+	Calendars, Query     string
+	Detail, Format       string
+	Output               string
+	Params               paramValues
+	// Listen is where auth login waits for Google's redirect.
+	Listen string
+	User   string
+}
+
+// commandFlagSet returns the flags of cmd: every flag defined on
+// flag.CommandLine, so settings such as -credentials and -config apply to
+// all commands, plus the command's own.
+func commandFlagSet(cmd string, opts *cliOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	switch cmd {
+	case "events":
+		opts.Params = paramValues(url.Values{})
+		fs.StringVar(&opts.From, "from", "", "window start: RFC3339, a date, now, or an offset such as -30d")
+		fs.StringVar(&opts.To, "to", "", "window end, as -from (default now)")
+		fs.StringVar(&opts.Window, "window", "", "named window instead of -from and -to - lastWeek, thisWeek or nextWeek")
+		fs.StringVar(&opts.TZ, "tz", "", "IANA time zone events are reported in")
+		fs.StringVar(&opts.Calendars, "calendars", "", "comma-separated calendar IDs (default all)")
+		fs.StringVar(&opts.Query, "q", "", "free-text search")
+		fs.StringVar(&opts.Detail, "detail", "", "summary or full")
+		fs.StringVar(&opts.Format, "format", "json", "output format - json, ndjson, csv, ics, agenda or xlsx")
+		fs.StringVar(&opts.Output, "o", "", "file to write to (default stdout)")
+		fs.Var(opts.Params, "param", "any other /calendar query parameter as name=value, e.g. -param onlyVideo=true; repeatable")
+	case "auth login":
+		fs.StringVar(&opts.Listen, "listen", "localhost:0", "address the redirect from Google is received on; match a redirect URI registered for the client, e.g. localhost:8080")
+		fs.StringVar(&opts.User, "user", "", "principal subject the token is stored for when the server runs with -auth (default the server's own token)")
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		commandUsage(out)
+		fmt.Fprintf(out, "\nFlags of %s:\n", cmd)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runEvents lists the events selected by opts, as GET /calendar would, and
+// writes them to opts.Output.
+func runEvents(api *API, opts cliOptions) error {
+	values := url.Values(opts.Params)
+	set := func(name, v string) {
+		if v != "" {
+			values.Set(name, v)
+		}
+	}
+	set("from", opts.From)
+	set("to", opts.To)
+	set("window", opts.Window)
+	set("tz", opts.TZ)
+	set("calendars", opts.Calendars)
+	set("q", opts.Query)
+	set("detail", opts.Detail)
+	q, err := parseEventValues(values)
+	if err != nil {
+		return err
+	}
+	switch opts.Format {
+	case "json", "ndjson", "csv", "ics", "agenda", "xlsx":
+	default:
+		return fmt.Errorf("invalid format %q: must be json, ndjson, csv, ics, agenda or xlsx", opts.Format)
+	}
+
+	ctx, cancel := withUpstreamTimeout(context.Background())
+	defer cancel()
+	srv, err := api.calendarService(ctx)
+	if errors.Is(err, errNotAuthorized) {
+		return errors.New("calendar access not authorized: run auth login first")
+	}
+	if err != nil {
+		return err
+	}
+	events, err := api.listEvents(ctx, srv, q)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if opts.Output != "" {
+		f, err := os.OpenFile(opts.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	bw := bufio.NewWriter(out)
+
+	switch opts.Format {
+	case "csv":
+		err = writeCSV(bw, events, q)
+	case "ics":
+		_, err = bw.WriteString(renderICS(events, q))
+	case "agenda":
+		_, err = bw.WriteString(renderAgenda(events, q))
+	case "xlsx":
+		err = writeXLSX(bw, events, q)
+	default:
+		var summaries []SummaryEvent
+		if summaries, err = summarizeEvents(ctx, srv, events, q); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(bw)
+		if opts.Format == "ndjson" {
+			for _, s := range summaries {
+				if err = enc.Encode(s); err != nil {
+					break
+				}
+			}
+			break
+		}
+		enc.SetIndent("", "  ")
+		err = enc.Encode(summaries)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// runAuthLogin completes the OAuth flow from the command line: it opens
+// Google's consent page, receives the redirect on a local listener and
+// stores the token for opts.User, as /oauth/login does for the server.
+func runAuthLogin(opts cliOptions) error {
+	if credentialMode == credentialServiceAccount {
+		return errors.New("authorization isn't needed with service account credentials")
+	}
+	config, err := loadOAuthConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return fmt.Errorf("unable to listen for the authorization redirect: %w", err)
+	}
+	defer ln.Close()
+	host, _, err := net.SplitHostPort(opts.Listen)
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	config.RedirectURL = "http://" + net.JoinHostPort(host, port) + "/oauth/callback"
+
+	state, err := oauthStates.New(opts.User)
+	if err != nil {
+		return err
+	}
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/callback", func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+		if _, ok := oauthStates.Consume(values.Get("state")); !ok {
+			http.Error(w, "invalid or expired state", http.StatusBadRequest)
+			return
+		}
+		res := result{code: values.Get("code")}
+		if reason := values.Get("error"); reason != "" {
+			res.err = errors.New("authorization denied: " + reason)
+		} else if res.code == "" {
+			res.err = errors.New("missing code")
+		}
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusForbidden)
+		} else {
+			fmt.Fprintln(w, "Authorized. You can close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadTimeout: 15 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	fmt.Fprintf(os.Stderr, "Authorize access in your browser:\n\n  %s\n\n", authURL)
+	if err := openBrowser(authURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to open a browser, use the link above instead: %v\n", err)
+	}
+
+	var res result
+	select {
+	case res = <-results:
+	case <-time.After(oauthStateTTL):
+		return errors.New("timed out waiting for authorization")
+	}
+	if res.err != nil {
+		return res.err
+	}
+	ctx, cancel := withUpstreamTimeout(context.Background())
+	defer cancel()
+	tok, err := config.Exchange(ctx, res.code)
+	if err != nil {
+		return fmt.Errorf("unable to exchange authorization code: %w", err)
+	}
+	if err := tokenStore.Save(opts.User, tok); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Token stored.")
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type CategoryTotals struct {
+	Minutes float64 `json:"minutes"`
+	Count   int     `json:"count"`
+}
+
+type WindowSummary struct {
+	From         time.Time                 `json:"from"`
+	To           time.Time                 `json:"to"`
+	TotalMinutes float64                   `json:"totalMinutes"`
+	Count        int                       `json:"count"`
+	Categories   map[string]CategoryTotals `json:"categories"`
+}
+
+type WindowDelta struct {
+	TotalMinutes float64                   `json:"totalMinutes"`
+	Count        int                       `json:"count"`
+	Categories   map[string]CategoryTotals `json:"categories"`
+}
+
+type CompareResponse struct {
+	Previous WindowSummary `json:"previous"`
+	Current  WindowSummary `json:"current"`
+	Delta    WindowDelta   `json:"delta"`
+}
+
+// summarizeWindow totals the events of q's window overall and per category.
+func summarizeWindow(events []calendarEvent, q eventQuery) (WindowSummary, error) {
+	ws := WindowSummary{From: q.TimeMin, To: q.TimeMax, Categories: make(map[string]CategoryTotals)}
+	groups, err := groupStats(events, "category", q.Location, false)
+	if err != nil {
+		return ws, err
+	}
+	for _, g := range groups {
+		ws.Categories[g.Key] = CategoryTotals{Minutes: g.TotalMinutes, Count: g.Count}
+		ws.TotalMinutes += g.TotalMinutes
+		ws.Count += g.Count
+	}
+	return ws, nil
+}
+
+// compareWindows returns current minus previous, with categories missing
+// from one side counted as zero.
+func compareWindows(previous, current WindowSummary) WindowDelta {
+	d := WindowDelta{
+		TotalMinutes: current.TotalMinutes - previous.TotalMinutes,
+		Count:        current.Count - previous.Count,
+		Categories:   make(map[string]CategoryTotals),
+	}
+	for key, c := range current.Categories {
+		d.Categories[key] = c
+	}
+	for key, p := range previous.Categories {
+		c := d.Categories[key]
+		d.Categories[key] = CategoryTotals{Minutes: c.Minutes - p.Minutes, Count: c.Count - p.Count}
+	}
+	return d
+}
+
+// CompareHandler compares two windows, given by the previous and current
+// query parameters as week shortcuts or start/end intervals, defaulting to
+// last week against this week.
+func (a *API) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	values := r.URL.Query()
+	previous, current := q, q
+	previousWindow, currentWindow := values.Get("previous"), values.Get("current")
+	if previousWindow == "" {
+		previousWindow = "lastWeek"
+	}
+	if currentWindow == "" {
+		currentWindow = "thisWeek"
+	}
+	if previous.TimeMin, previous.TimeMax, err = resolveWindow(previousWindow, q.Location); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if current.TimeMin, current.TimeMax, err = resolveWindow(currentWindow, q.Location); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	var resp CompareResponse
+	for _, window := range []struct {
+		q   eventQuery
+		out *WindowSummary
+	}{{previous, &resp.Previous}, {current, &resp.Current}} {
+		events, err := a.listEvents(ctx, srv, window.q)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		if *window.out, err = summarizeWindow(events, window.q); err != nil {
+			logger.Error(err)
+			writeError(w, "unable to compute window summary", http.StatusInternalServerError)
+			return
+		}
+	}
+	resp.Delta = compareWindows(resp.Previous, resp.Current)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Errorf("Error encoding compare response %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func coloredEvent(event *calendar.Event, colorID string) *calendar.Event {
+	event.ColorId = colorID
+	return event
+}
+
+func TestCompareHandler(t *testing.T) {
+	setNow(t, time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC))
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		// Last week: 90 minutes of tomato, 30 of default.
+		coloredEvent(timedEvent("a", "Incident", "2024-03-04T09:00:00Z", "2024-03-04T10:30:00Z"), "11"),
+		timedEvent("b", "1:1", "2024-03-05T09:00:00Z", "2024-03-05T09:30:00Z"),
+		// This week: 60 minutes of tomato, 60 of basil.
+		coloredEvent(timedEvent("c", "Incident", "2024-03-11T09:00:00Z", "2024-03-11T10:00:00Z"), "11"),
+		coloredEvent(timedEvent("d", "Planning", "2024-03-12T09:00:00Z", "2024-03-12T10:00:00Z"), "10"),
+	)
+
+	rec := serve(newTestAPI(srv).CompareHandler, "/compare?tz=UTC")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var resp CompareResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Previous.TotalMinutes != 120 || resp.Current.TotalMinutes != 120 {
+		t.Errorf("totals = %v and %v minutes, want 120 and 120", resp.Previous.TotalMinutes, resp.Current.TotalMinutes)
+	}
+	want := WindowDelta{
+		TotalMinutes: 0,
+		Count:        0,
+		Categories: map[string]CategoryTotals{
+			"tomato":  {Minutes: -30, Count: 0},
+			"default": {Minutes: -30, Count: -1},
+			"basil":   {Minutes: 60, Count: 1},
+		},
+	}
+	if !reflect.DeepEqual(resp.Delta, want) {
+		t.Errorf("delta = %+v, want %+v", resp.Delta, want)
+	}
+}
+
+func TestCompareWindows(t *testing.T) {
+	previous := WindowSummary{TotalMinutes: 100, Count: 3, Categories: map[string]CategoryTotals{"default": {Minutes: 100, Count: 3}}}
+	current := WindowSummary{TotalMinutes: 40, Count: 1, Categories: map[string]CategoryTotals{"grape": {Minutes: 40, Count: 1}}}
+	got := compareWindows(previous, current)
+	want := WindowDelta{
+		TotalMinutes: -60,
+		Count:        -2,
+		Categories: map[string]CategoryTotals{
+			"default": {Minutes: -100, Count: -3},
+			"grape":   {Minutes: 40, Count: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareWindows() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix prefixes the environment variable that overrides each flag,
+// e.g. CALTRACKER_READ_TIMEOUT for -read-timeout.
+const envPrefix = "CALTRACKER_"
+
+// configDuration is a duration written as a string such as "15s" in a config
+// file.
+type configDuration time.Duration
+
+func (d *configDuration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	*d = configDuration(v)
+	return nil
+}
+
+// Config is the settings file given by -config, in YAML or JSON. Keys match
+// the flag names; omitted keys keep the flag's default. Environment
+// variables override the file, and flags given on the command line override
+// both.
+type Config struct {
+	Addr             string         `yaml:"addr"`
+	Credentials      string         `yaml:"credentials"`
+	Token            string         `yaml:"token"`
+	CredentialMode   string         `yaml:"credential-mode"`
+	Scopes           []string       `yaml:"scopes"`
+	ReadTimeout      configDuration `yaml:"read-timeout"`
+	WriteTimeout     configDuration `yaml:"write-timeout"`
+	IdleTimeout      configDuration `yaml:"idle-timeout"`
+	GracefulTimeout  configDuration `yaml:"graceful-timeout"`
+	UpstreamTimeout  configDuration `yaml:"upstream-timeout"`
+	DefaultWindow    configDuration `yaml:"default-window"`
+	CalendarPageSize int            `yaml:"calendar-page-size"`
+	// Digests and SMTP configure scheduled digests, which have no flags.
+	Digests []DigestConfig `yaml:"digests"`
+	SMTP    SMTPConfig     `yaml:"smtp"`
+}
+
+// loadConfig reads a Config from a YAML or JSON file; JSON is valid YAML.
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// flagValues returns the settings present in the file by flag name.
+func (c Config) flagValues() map[string]string {
+	values := make(map[string]string)
+	setString := func(name, v string) {
+		if v != "" {
+			values[name] = v
+		}
+	}
+	setDuration := func(name string, d configDuration) {
+		if d != 0 {
+			values[name] = time.Duration(d).String()
+		}
+	}
+	setString("addr", c.Addr)
+	setString("credentials", c.Credentials)
+	setString("token", c.Token)
+	setString("credential-mode", c.CredentialMode)
+	setString("scopes", strings.Join(c.Scopes, ","))
+	setDuration("read-timeout", c.ReadTimeout)
+	setDuration("write-timeout", c.WriteTimeout)
+	setDuration("idle-timeout", c.IdleTimeout)
+	setDuration("graceful-timeout", c.GracefulTimeout)
+	setDuration("upstream-timeout", c.UpstreamTimeout)
+	setDuration("default-window", c.DefaultWindow)
+	if c.CalendarPageSize != 0 {
+		values["calendar-page-size"] = strconv.Itoa(c.CalendarPageSize)
+	}
+	return values
+}
+
+// flagEnvName is the environment variable overriding the named flag.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyConfig fills in every flag not given on the command line from its
+// environment variable, or failing that from cfg.
+func applyConfig(fs *flag.FlagSet, cfg Config) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	fromFile := cfg.flagValues()
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] {
+			return
+		}
+		source, v, ok := "environment variable "+flagEnvName(f.Name), "", false
+		if v, ok = os.LookupEnv(flagEnvName(f.Name)); !ok {
+			source = "config file"
+			v, ok = fromFile[f.Name]
+		}
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("invalid %s from %s: %v", f.Name, source, setErr)
+		}
+	})
+	return err
+}
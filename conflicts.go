@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+type ConflictCheckRequest struct {
+	CalendarID string `json:"calendarId"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+}
+
+type ConflictingEvent struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+type ConflictCheckResponse struct {
+	Conflicts []ConflictingEvent `json:"conflicts"`
+}
+
+// findConflicts lists the events on calendarID that overlap [start, end).
+// Events.List already restricts results to events ending after TimeMin and
+// starting before TimeMax, which is exactly the overlap condition.
+func findConflicts(ctx context.Context, srv CalendarService, calendarID string, start, end time.Time) ([]ConflictingEvent, error) {
+	conflicts := make([]ConflictingEvent, 0)
+	var events *calendar.Events
+	err := breaker.Do(func() (err error) {
+		events, err = srv.ListEvents(ctx, calendarID, eventListOptions{SingleEvents: true, TimeMin: start, TimeMax: end, OrderBy: "startTime"})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve events from calendar %s: %w", calendarID, err)
+	}
+
+	for _, event := range events.Items {
+		// Events marked "free" don't block time.
+		if event.Transparency == "transparent" {
+			continue
+		}
+		conflicts = append(conflicts, ConflictingEvent{
+			ID:      event.Id,
+			Summary: event.Summary,
+			Start:   rawEventTime(event.Start),
+			End:     rawEventTime(event.End),
+		})
+	}
+	return conflicts, nil
+}
+
+// ConflictCheckHandler reports the existing events that would overlap a
+// proposed event, so clients can warn before creating it.
+func (a *API) ConflictCheckHandler(w http.ResponseWriter, r *http.Request) {
+	var req ConflictCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.CalendarID == "" {
+		req.CalendarID = "primary"
+	}
+	if !validCalendarID(req.CalendarID) {
+		writeError(w, fmt.Sprintf("invalid calendarId %q", req.CalendarID), http.StatusBadRequest)
+		return
+	}
+	start, err := time.Parse(time.RFC3339, req.Start)
+	if err != nil {
+		writeError(w, "start must be an RFC3339 time", http.StatusBadRequest)
+		return
+	}
+	end, err := time.Parse(time.RFC3339, req.End)
+	if err != nil {
+		writeError(w, "end must be an RFC3339 time", http.StatusBadRequest)
+		return
+	}
+	if !start.Before(end) {
+		writeError(w, "start must be before end", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if calendarAllowlist != nil {
+		if _, err := getCalendars(ctx, srv, []string{req.CalendarID}); err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+	}
+
+	conflicts, err := findConflicts(ctx, srv, req.CalendarID, start, end)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(ConflictCheckResponse{Conflicts: conflicts}); err != nil {
+		logger.Errorf("Error encoding conflicts response %v", err)
+	}
+}
+
+type ConflictGroupEvent struct {
+	ID             string `json:"id"`
+	Calendar       string `json:"calendar"`
+	Summary        string `json:"summary"`
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	ResponseStatus string `json:"responseStatus,omitempty"`
+}
+
+// ConflictGroup is a run of events each overlapping another. Start and End
+// span the whole group; OverlapMinutes counts only the time at least two of
+// them run at once.
+type ConflictGroup struct {
+	Start          string               `json:"start"`
+	End            string               `json:"end"`
+	OverlapMinutes float64              `json:"overlapMinutes"`
+	Calendars      []string             `json:"calendars"`
+	Events         []ConflictGroupEvent `json:"events"`
+}
+
+type ConflictsResponse struct {
+	Groups []ConflictGroup `json:"groups"`
+}
+
+// conflictGroups groups the timed events that overlap. Events marked free,
+// declined by the user or, with onlyAccepted, not accepted by them are left
+// out, as are all-day events and tasks, which mark days rather than booked
+// time.
+func conflictGroups(events []calendarEvent, q eventQuery, onlyAccepted bool) []ConflictGroup {
+	type interval struct {
+		ce         calendarEvent
+		start, end time.Time
+		response   string
+	}
+	intervals := make([]interval, 0, len(events))
+	for _, ce := range events {
+		if isTask(ce.Event) || isAllDay(ce.Event) || ce.Event.Transparency == "transparent" {
+			continue
+		}
+		response := attendeeResponse(ce.Event, q.DelegateFor)
+		if response == "declined" || (onlyAccepted && response != "accepted") {
+			continue
+		}
+		start, end, err := eventTimes(ce.Event)
+		if err != nil || !start.Before(end) {
+			continue
+		}
+		intervals = append(intervals, interval{ce: ce, start: start, end: end, response: response})
+	}
+	sort.SliceStable(intervals, func(i, j int) bool { return intervals[i].start.Before(intervals[j].start) })
+
+	groups := make([]ConflictGroup, 0)
+	for i := 0; i < len(intervals); {
+		// Extend the group while the next event starts before all so far
+		// have ended.
+		j, end := i+1, intervals[i].end
+		for j < len(intervals) && intervals[j].start.Before(end) {
+			if intervals[j].end.After(end) {
+				end = intervals[j].end
+			}
+			j++
+		}
+		if j-i < 2 {
+			i = j
+			continue
+		}
+
+		group := ConflictGroup{
+			Start:     intervals[i].start.In(q.Location).Format(time.RFC3339),
+			End:       end.In(q.Location).Format(time.RFC3339),
+			Calendars: make([]string, 0),
+			Events:    make([]ConflictGroupEvent, 0, j-i),
+		}
+		seen := make(map[string]bool)
+		type edge struct {
+			at    time.Time
+			delta int
+		}
+		edges := make([]edge, 0, 2*(j-i))
+		for _, iv := range intervals[i:j] {
+			group.Events = append(group.Events, ConflictGroupEvent{
+				ID:             iv.ce.Event.Id,
+				Calendar:       iv.ce.Calendar.Summary,
+				Summary:        iv.ce.Event.Summary,
+				Start:          iv.start.In(q.Location).Format(time.RFC3339),
+				End:            iv.end.In(q.Location).Format(time.RFC3339),
+				ResponseStatus: iv.response,
+			})
+			if !seen[iv.ce.Calendar.Summary] {
+				seen[iv.ce.Calendar.Summary] = true
+				group.Calendars = append(group.Calendars, iv.ce.Calendar.Summary)
+			}
+			edges = append(edges, edge{iv.start, 1}, edge{iv.end, -1})
+		}
+		// Ends sort before starts at the same instant, so back-to-back
+		// events don't count as overlapping.
+		sort.Slice(edges, func(a, b int) bool {
+			if edges[a].at.Equal(edges[b].at) {
+				return edges[a].delta < edges[b].delta
+			}
+			return edges[a].at.Before(edges[b].at)
+		})
+		running := 0
+		var overlap time.Duration
+		for k, e := range edges {
+			if running >= 2 {
+				overlap += e.at.Sub(edges[k-1].at)
+			}
+			running += e.delta
+		}
+		group.OverlapMinutes = overlap.Minutes()
+		sort.Strings(group.Calendars)
+		groups = append(groups, group)
+		i = j
+	}
+	return groups
+}
+
+// ConflictsHandler scans the user's calendars for double-bookings in the
+// window and reports them as groups of overlapping events. An event on
+// several calendars is counted once.
+func (a *API) ConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Dedupe = true
+	onlyAccepted, err := parseBoolParam(r.URL.Query(), "onlyAccepted", false)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(ConflictsResponse{Groups: conflictGroups(events, q, onlyAccepted)}); err != nil {
+		logger.Errorf("Error encoding conflicts response %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConflictCheckHandler(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	free := timedEvent("focus", "Focus time", "2024-03-04T10:00:00Z", "2024-03-04T12:00:00Z")
+	free.Transparency = "transparent"
+	srv.addEvents("me@example.com",
+		timedEvent("standup", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"),
+		timedEvent("review", "Review", "2024-03-04T10:30:00Z", "2024-03-04T11:30:00Z"),
+		free,
+		timedEvent("lunch", "Lunch", "2024-03-04T12:00:00Z", "2024-03-04T13:00:00Z"),
+	)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       []string
+	}{
+		{"overlapping", `{"start":"2024-03-04T09:15:00Z","end":"2024-03-04T10:45:00Z"}`, http.StatusOK, []string{"standup", "review"}},
+		{"back to back", `{"start":"2024-03-04T09:30:00Z","end":"2024-03-04T10:30:00Z"}`, http.StatusOK, []string{}},
+		{"only a free event", `{"calendarId":"primary","start":"2024-03-04T11:30:00Z","end":"2024-03-04T12:00:00Z"}`, http.StatusOK, []string{}},
+		{"start after end", `{"start":"2024-03-04T11:00:00Z","end":"2024-03-04T10:00:00Z"}`, http.StatusBadRequest, nil},
+		{"bad calendar", `{"calendarId":"nope","start":"2024-03-04T09:00:00Z","end":"2024-03-04T10:00:00Z"}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newTestAPI(srv).ConflictCheckHandler(rec, httptest.NewRequest(http.MethodPost, "/events/check", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp ConflictCheckResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0)
+			for _, c := range resp.Conflicts {
+				got = append(got, c.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("conflicts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
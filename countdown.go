@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// countdownLookahead is how far ahead /next/countdown looks when the request
+// doesn't choose a window.
+const countdownLookahead = 7 * 24 * time.Hour
+
+type Countdown struct {
+	EventSummary string    `json:"eventSummary"`
+	StartsAt     time.Time `json:"startsAt"`
+	SecondsUntil int64     `json:"secondsUntil"`
+	AllDay       bool      `json:"allDay"`
+}
+
+// nextCountdown finds the event starting soonest after now. All-day events
+// start at midnight in loc.
+func nextCountdown(events []calendarEvent, loc *time.Location, now time.Time) (Countdown, bool) {
+	var next Countdown
+	found := false
+	for _, ce := range events {
+		if isTask(ce.Event) {
+			continue
+		}
+		start, _, err := eventSpan(ce.Event, loc)
+		if err != nil || !start.After(now) {
+			continue
+		}
+		if !found || start.Before(next.StartsAt) {
+			next = Countdown{
+				EventSummary: ce.Event.Summary,
+				StartsAt:     start.In(loc),
+				SecondsUntil: int64(start.Sub(now) / time.Second),
+				AllDay:       isAllDay(ce.Event),
+			}
+			found = true
+		}
+	}
+	return next, found
+}
+
+// CountdownHandler returns the time until the next event, or 204 when none
+// starts in the window (the next seven days unless a window is given).
+func (a *API) CountdownHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t := now()
+	if !windowRequested(r.URL.Query()) {
+		q.TimeMin, q.TimeMax = t.In(q.Location), t.Add(countdownLookahead).In(q.Location)
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	next, ok := nextCountdown(events, q.Location, t)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(next); err != nil {
+		logger.Errorf("Error encoding countdown response %v", err)
+	}
+}
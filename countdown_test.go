@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestCountdownHandler(t *testing.T) {
+	setNow(t, time.Date(2024, 3, 4, 9, 10, 0, 0, time.UTC))
+	tests := []struct {
+		name     string
+		events   []string
+		wantCode int
+		want     Countdown
+	}{
+		// Standup has already started, so review is next.
+		{"next timed event", []string{"standup", "review", "offsite"}, http.StatusOK,
+			Countdown{EventSummary: "Review", StartsAt: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC), SecondsUntil: 50 * 60}},
+		{"all-day event at midnight", []string{"offsite"}, http.StatusOK,
+			Countdown{EventSummary: "Offsite", StartsAt: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), SecondsUntil: 14*3600 + 50*60, AllDay: true}},
+		{"nothing in the next week", []string{"standup", "later"}, http.StatusNoContent, Countdown{}},
+	}
+	fixtures := map[string]*calendar.Event{
+		"standup": timedEvent("standup", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"),
+		"review":  timedEvent("review", "Review", "2024-03-04T10:00:00Z", "2024-03-04T11:00:00Z"),
+		"offsite": allDayEvent("offsite", "Offsite", "2024-03-05", "2024-03-06"),
+		"later":   timedEvent("later", "Quarterly", "2024-03-20T10:00:00Z", "2024-03-20T11:00:00Z"),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeService(primaryCalendar("me@example.com"))
+			for _, id := range tt.events {
+				srv.addEvents("me@example.com", fixtures[id])
+			}
+			rec := serve(newTestAPI(srv).CountdownHandler, "/next/countdown")
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d; body %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var got Countdown
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.EventSummary != tt.want.EventSummary || !got.StartsAt.Equal(tt.want.StartsAt) ||
+				got.SecondsUntil != tt.want.SecondsUntil || got.AllDay != tt.want.AllDay {
+				t.Errorf("countdown = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
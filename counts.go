@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+type CalendarCount struct {
+	ID         string `json:"id"`
+	Calendar   string `json:"calendar"`
+	Subscribed bool   `json:"subscribed"`
+	Count      int    `json:"count"`
+}
+
+// countEvents counts the events in the query window for each selected calendar.
+// Only event IDs are requested so no event bodies are transferred.
+func countEvents(ctx context.Context, srv CalendarService, q eventQuery) ([]CalendarCount, error) {
+	q = boundWindow(q)
+	calendars, err := listCalendars(ctx, srv, q)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]CalendarCount, 0, len(calendars))
+	for _, userCalendar := range calendars {
+		count := CalendarCount{ID: userCalendar.Id, Calendar: userCalendar.Summary, Subscribed: isSubscribed(userCalendar)}
+		pageToken := ""
+		for {
+			var events *calendar.Events
+			err := breaker.Do(func() (err error) {
+				events, err = srv.ListEvents(ctx, userCalendar.Id, eventListOptions{
+					SingleEvents: q.SingleEvents,
+					TimeMin:      q.TimeMin,
+					TimeMax:      q.TimeMax,
+					PageToken:    pageToken,
+					MaxResults:   eventPageSize,
+					Fields:       []googleapi.Field{"nextPageToken", "items(id)"},
+				})
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to count events in calendar %s: %w", userCalendar.Id, err)
+			}
+			count.Count += len(events.Items)
+
+			pageToken = events.NextPageToken
+			if pageToken == "" {
+				break
+			}
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+// CountsHandler returns the number of events per owned calendar in the
+// requested window, without the events themselves.
+func (a *API) CountsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	counts, err := countEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(counts); err != nil {
+		logger.Errorf("Error encoding counts response %v", err)
+	}
+}
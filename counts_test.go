@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCountsHandler(t *testing.T) {
+	subscribed := ownedCalendar("holidays", "Holidays")
+	subscribed.AccessRole = "reader"
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar("team", "Team"), subscribed)
+	srv.pageSize = 2
+	srv.addEvents("me@example.com",
+		timedEvent("a", "A", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+		timedEvent("b", "B", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"),
+		timedEvent("c", "C", "2024-03-06T09:00:00Z", "2024-03-06T10:00:00Z"),
+		// Outside the window.
+		timedEvent("d", "D", "2024-04-06T09:00:00Z", "2024-04-06T10:00:00Z"),
+	)
+	srv.addEvents("holidays", allDayEvent("h", "Holiday", "2024-03-08", "2024-03-09"))
+
+	tests := []struct {
+		query string
+		want  []CalendarCount
+	}{
+		{"", []CalendarCount{
+			{ID: "me@example.com", Calendar: "me@example.com", Count: 3},
+			{ID: "team", Calendar: "Team", Count: 0},
+		}},
+		{"&includeSubscribed=true", []CalendarCount{
+			{ID: "me@example.com", Calendar: "me@example.com", Count: 3},
+			{ID: "team", Calendar: "Team", Count: 0},
+			{ID: "holidays", Calendar: "Holidays", Subscribed: true, Count: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).CountsHandler, "/calendar/counts?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"+tt.query)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			var got []CalendarCount
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counts = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	for _, opts := range srv.eventListCalls() {
+		if len(opts.Fields) == 0 {
+			t.Errorf("Events.List asked for whole events: %+v", opts)
+		}
+	}
+}
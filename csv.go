@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// writeCSV writes one row per event under a header row, flushing as it goes
+// so large exports stream rather than build up in memory.
+func writeCSV(w io.Writer, events []calendarEvent, q eventQuery) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"calendar", "summary", "start", "end", "duration_minutes", "attendee_count"}); err != nil {
+		return err
+	}
+	for i, ce := range events {
+		summary, err := summarizeEvent(ce, q)
+		if err != nil {
+			return err
+		}
+		record := []string{
+			summary.Calendar,
+			summary.Summary,
+			rawEventTime(ce.Event.Start),
+			rawEventTime(ce.Event.End),
+			strconv.FormatFloat(summary.EventTime, 'f', -1, 64),
+			strconv.Itoa(summary.AttendeeCount),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		if i%500 == 499 {
+			cw.Flush()
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// dashboardEnabled is set by the -dashboard flag.
+var dashboardEnabled bool
+
+// dashboardLimit is how many of the latest events the dashboard lists.
+const dashboardLimit = 20
+
+// dashboardTemplate is a self-contained page that polls /healthz and
+// /calendar from the browser.
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.ok { color: green; } .bad { color: red; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Status: <span id="status">loading…</span></p>
+<table>
+<thead><tr><th>Calendar</th><th>Summary</th><th>Created</th><th>Minutes</th></tr></thead>
+<tbody id="events"></tbody>
+</table>
+<script>
+const limit = {{.Limit}};
+
+function cell(row, text) {
+	const td = document.createElement("td");
+	td.textContent = text;
+	row.appendChild(td);
+}
+
+fetch("/healthz").then(r => r.json()).then(h => {
+	const s = document.getElementById("status");
+	s.textContent = h.status + " (breaker " + h.breaker + ")";
+	s.className = h.breaker === "closed" ? "ok" : "bad";
+}).catch(e => {
+	const s = document.getElementById("status");
+	s.textContent = "unreachable: " + e;
+	s.className = "bad";
+});
+
+fetch("/calendar").then(r => {
+	if (!r.ok) { throw new Error(r.status + " " + r.statusText); }
+	return r.json();
+}).then(events => {
+	events.sort((a, b) => (b.created || "").localeCompare(a.created || ""));
+	const body = document.getElementById("events");
+	for (const e of events.slice(0, limit)) {
+		const row = document.createElement("tr");
+		cell(row, e.calendar);
+		cell(row, e.summary);
+		cell(row, e.created);
+		cell(row, e.eventTime);
+		body.appendChild(row);
+	}
+}).catch(e => {
+	const row = document.createElement("tr");
+	cell(row, "Unable to load events: " + e.message);
+	document.getElementById("events").appendChild(row);
+});
+</script>
+</body>
+</html>
+`))
+
+// serveDashboard renders the status dashboard.
+func serveDashboard(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	data := struct {
+		Title string
+		Limit int
+	}{"Calendar tracker", dashboardLimit}
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		logger.Errorf("Error rendering dashboard %v", err)
+	}
+}
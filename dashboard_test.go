@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSayHelloDashboard(t *testing.T) {
+	tests := []struct {
+		dashboard       bool
+		wantContentType string
+		wantBody        string
+	}{
+		{false, "text/plain; charset=utf-8", "Hello!"},
+		{true, "text/html; charset=UTF-8", "<title>Calendar tracker</title>"},
+	}
+	for _, tt := range tests {
+		saved := dashboardEnabled
+		dashboardEnabled = tt.dashboard
+		rec := serve(SayHelloFunc, "/")
+		dashboardEnabled = saved
+
+		if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+			t.Errorf("dashboard=%t: Content-Type %q, want %q", tt.dashboard, got, tt.wantContentType)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, tt.wantBody) {
+			t.Errorf("dashboard=%t: body %q lacks %q", tt.dashboard, body, tt.wantBody)
+		}
+	}
+}
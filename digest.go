@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DigestConfig is one scheduled digest in the config file's digests list.
+type DigestConfig struct {
+	Name string `yaml:"name"`
+	// Kind is agenda (tomorrow's events) or weekly (time spent over the
+	// past seven days by calendar).
+	Kind     string `yaml:"kind"`
+	Schedule string `yaml:"schedule"`
+	TimeZone string `yaml:"timezone"`
+	// User is the account whose calendars are read: an API principal's
+	// subject with -auth on, or empty for the server's own token.
+	User string `yaml:"user"`
+	// Params are further /calendar query parameters, e.g. calendars.
+	Params       map[string]string `yaml:"params"`
+	SlackWebhook string            `yaml:"slack-webhook"`
+	Email        []string          `yaml:"email"`
+	// Subject and Template are text/templates over DigestData, replacing
+	// the kind's defaults.
+	Subject  string `yaml:"subject"`
+	Template string `yaml:"template"`
+}
+
+// SMTPConfig is the mail server digests are emailed through.
+type SMTPConfig struct {
+	// Addr is host:port, e.g. smtp.example.com:587. STARTTLS is used when
+	// the server offers it.
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	// Password may be left out of the file and set with
+	// CALTRACKER_SMTP_PASSWORD instead.
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// DigestData is what digest templates are executed with.
+type DigestData struct {
+	Name   string
+	From   time.Time
+	To     time.Time
+	Events []SummaryEvent
+	// Agenda is the plain-text agenda of the events.
+	Agenda string
+	// Stats is set for weekly digests.
+	Stats *StatsResponse
+}
+
+var defaultDigestTemplates = map[string]struct{ subject, body string }{
+	"agenda": {
+		subject: `Agenda for {{.From.Format "Mon Jan 2"}}`,
+		body:    "{{if .Events}}{{.Agenda}}{{else}}No events.\n{{end}}",
+	},
+	"weekly": {
+		subject: `Time spent {{.From.Format "Jan 2"}} to {{.To.Format "Jan 2"}}`,
+		body: "{{printf \"%.1f\" .Stats.Overview.TotalHours}} hours in {{.Stats.Overview.Count}} events\n" +
+			"{{range .Stats.Groups}}  {{.Key}}: {{printf \"%.0f\" .TotalMinutes}} min, {{.Count}} events\n{{end}}",
+	},
+}
+
+// digest is a configured digest ready to run.
+type digest struct {
+	DigestConfig
+	schedule *cronSchedule
+	loc      *time.Location
+	subject  *template.Template
+	body     *template.Template
+}
+
+// newDigests checks the configured digests and parses their schedules and
+// templates.
+func newDigests(configs []DigestConfig, mail SMTPConfig) ([]*digest, error) {
+	digests := make([]*digest, 0, len(configs))
+	for i, c := range configs {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("digest %d", i+1)
+		}
+		defaults, ok := defaultDigestTemplates[c.Kind]
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid kind %q: must be agenda or weekly", c.Name, c.Kind)
+		}
+		if c.SlackWebhook == "" && len(c.Email) == 0 {
+			return nil, fmt.Errorf("%s: needs a slack-webhook or email recipients", c.Name)
+		}
+		if c.SlackWebhook != "" {
+			if u, err := url.Parse(c.SlackWebhook); err != nil || u.Scheme != "https" || u.Host == "" {
+				return nil, fmt.Errorf("%s: invalid slack-webhook %q: must be an https URL", c.Name, c.SlackWebhook)
+			}
+		}
+		if len(c.Email) > 0 && (mail.Addr == "" || mail.From == "") {
+			return nil, fmt.Errorf("%s: email digests need smtp addr and from", c.Name)
+		}
+		d := &digest{DigestConfig: c, loc: time.Local}
+		var err error
+		if d.schedule, err = parseCronSchedule(c.Schedule); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		if c.TimeZone != "" {
+			if d.loc, err = time.LoadLocation(c.TimeZone); err != nil {
+				return nil, fmt.Errorf("%s: invalid timezone %q: %v", c.Name, c.TimeZone, err)
+			}
+		}
+		subject, body := defaults.subject, defaults.body
+		if c.Subject != "" {
+			subject = c.Subject
+		}
+		if c.Template != "" {
+			body = c.Template
+		}
+		if d.subject, err = template.New("subject").Parse(subject); err != nil {
+			return nil, fmt.Errorf("%s: invalid subject: %v", c.Name, err)
+		}
+		if d.body, err = template.New("body").Parse(body); err != nil {
+			return nil, fmt.Errorf("%s: invalid template: %v", c.Name, err)
+		}
+		digests = append(digests, d)
+	}
+	return digests, nil
+}
+
+// window returns the span the digest covers when run at t: tomorrow for an
+// agenda, the seven days up to t for a weekly report.
+func (d *digest) window(t time.Time) (time.Time, time.Time) {
+	t = t.In(d.loc)
+	if d.Kind == "weekly" {
+		return t.AddDate(0, 0, -7), t
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, d.loc)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// compile reads the digest's events, from the synced copy when syncing is
+// on, and renders its subject and body.
+func (d *digest) compile(ctx context.Context, api *API, at time.Time) (string, string, error) {
+	from, to := d.window(at)
+	values := url.Values{}
+	for name, v := range d.Params {
+		values.Set(name, v)
+	}
+	values.Set("from", from.Format(time.RFC3339))
+	values.Set("to", to.Format(time.RFC3339))
+	values.Set("tz", d.loc.String())
+	q, err := parseEventValues(values)
+	if err != nil {
+		return "", "", err
+	}
+
+	if d.User != "" {
+		ctx = withPrincipal(ctx, Principal{Subject: d.User, Method: "digest"})
+	}
+	ctx, cancel := withUpstreamTimeout(ctx)
+	defer cancel()
+	srv, err := api.calendarService(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	events, err := api.listEvents(ctx, srv, q)
+	if err != nil {
+		return "", "", err
+	}
+	summaries, err := summarizeEvents(ctx, srv, events, q)
+	if err != nil {
+		return "", "", err
+	}
+
+	data := DigestData{Name: d.Name, From: from, To: to, Events: summaries, Agenda: renderAgenda(events, q)}
+	if d.Kind == "weekly" {
+		stats, err := computeStats(events, q, "calendar", false)
+		if err != nil {
+			return "", "", err
+		}
+		data.Stats = &stats
+	}
+	var subject, body bytes.Buffer
+	if err := d.subject.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("unable to render subject: %w", err)
+	}
+	if err := d.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("unable to render template: %w", err)
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// digestSender delivers rendered digests.
+type digestSender struct {
+	client *http.Client
+	mail   SMTPConfig
+}
+
+// send posts the digest to Slack and emails it, attempting both and
+// returning the failures.
+func (s *digestSender) send(d *digest, subject, body string) error {
+	var errs []string
+	if d.SlackWebhook != "" {
+		if err := s.postSlack(d.SlackWebhook, subject, body); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(d.Email) > 0 {
+		if err := s.sendMail(d.Email, subject, body); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *digestSender) postSlack(webhook, subject, body string) error {
+	msg := SlackMessage{
+		Text: subject,
+		Blocks: []SlackBlock{
+			{Type: "header", Text: &SlackText{Type: "plain_text", Text: subject}},
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "```" + body + "```"}},
+		},
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("slack webhook failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *digestSender) sendMail(to []string, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.mail.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if s.mail.Username != "" {
+		host, _, err := net.SplitHostPort(s.mail.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid smtp addr %q: %v", s.mail.Addr, err)
+		}
+		auth = smtp.PlainAuth("", s.mail.Username, s.mail.Password, host)
+	}
+	if err := smtp.SendMail(s.mail.Addr, auth, s.mail.From, to, msg.Bytes()); err != nil {
+		return fmt.Errorf("unable to email digest: %w", err)
+	}
+	return nil
+}
+
+// runDigest sends d each time its schedule comes round until ctx ends. A
+// digest that fails is logged and tried again at its next time.
+func runDigest(ctx context.Context, api *API, d *digest, sender *digestSender) {
+	for {
+		next := d.schedule.Next(now().In(d.loc))
+		if next.IsZero() {
+			logger.Warnf("Digest %s is never scheduled", d.Name)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		subject, body, err := d.compile(ctx, api, next)
+		if err == nil {
+			err = sender.send(d, subject, body)
+		}
+		if err != nil {
+			logger.Errorf("Digest %s failed: %v", d.Name, err)
+			continue
+		}
+		logger.Infof("Sent digest %s", d.Name)
+	}
+}
+
+// startDigests schedules the configured digests as background workers,
+// reading calendars through api.
+func startDigests(api *API, digests []*digest, mail SMTPConfig) {
+	if mail.Password == "" {
+		mail.Password = os.Getenv(envPrefix + "SMTP_PASSWORD")
+	}
+	sender := &digestSender{client: &http.Client{Timeout: 10 * time.Second}, mail: mail}
+	for _, d := range digests {
+		d := d
+		lifecycle.Go(func(ctx context.Context) { runDigest(ctx, api, d, sender) })
+	}
+}
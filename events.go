@@ -0,0 +1,1162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// calendarPageSize is the number of calendars requested per CalendarList
+// page, set by the -calendar-page-size flag.
+var calendarPageSize int64 = 100
+
+// defaultMaxAttendees caps attendee lists so large all-hands events don't
+// bloat responses.
+const defaultMaxAttendees = 50
+
+// Handling of events whose end precedes their start, set by the
+// -inverted-events flag.
+const (
+	invertedClamp = "clamp"
+	invertedSkip  = "skip"
+)
+
+var invertedEvents = invertedClamp
+
+// errCalendarNotFound is returned when a requested calendar is not in the
+// user's calendar list.
+var errCalendarNotFound = errors.New("calendar not found")
+
+// calendarEvent pairs an event with the calendar it was listed from.
+type calendarEvent struct {
+	Calendar *calendar.CalendarListEntry
+	Event    *calendar.Event
+	// Calendars names every calendar a deduplicated event was found on,
+	// when there was more than one.
+	Calendars []string
+}
+
+// eventQuery holds the request options that shape an events listing.
+type eventQuery struct {
+	// SingleEvents expands recurring events into instances. When false,
+	// recurring masters are returned once with their template times.
+	SingleEvents bool
+	// OnlyMultiDay keeps only all-day events and those spanning over 24 hours.
+	OnlyMultiDay bool
+	// TimeMin and TimeMax bound the events returned.
+	TimeMin time.Time
+	TimeMax time.Time
+	// Location is the time zone used to compute window boundaries.
+	Location *time.Location
+	// ZoneGiven is set when Location came from the tz parameter; otherwise
+	// event times are reported in each calendar's own time zone.
+	ZoneGiven bool
+	// Calendars restricts the listing to these calendar IDs instead of every
+	// owned calendar.
+	Calendars []string
+	// Calendar narrows the listing to the one calendar with this ID or name.
+	Calendar string
+	// OrderBy is the order Google returns each calendar's events in:
+	// updated or startTime.
+	OrderBy string
+	// Descending reverses the order of the returned events.
+	Descending bool
+	// Dedupe keeps only the first of the events sharing an iCalUID, such as
+	// one event on two of the user's calendars, listing the calendars it
+	// was found on. Off unless dedupe=true, so every copy is listed.
+	Dedupe bool
+	// MaxSummaryLen truncates summaries longer than this many characters.
+	// Zero leaves them untouched.
+	MaxSummaryLen int
+	// Room keeps only events booking this room, matched against resource
+	// attendees or the event location.
+	Room string
+	// InternalOnly keeps only events organized within UserDomain.
+	InternalOnly bool
+	// UserDomain is the authenticated user's email domain, resolved when
+	// InternalOnly is set.
+	UserDomain string
+	// IncludeTasks returns task-like entries, which have no end time,
+	// instead of dropping them.
+	IncludeTasks bool
+	// MinAccessRole is the least access a calendar needs to be listed when
+	// Calendars isn't given: reader, writer or owner (the default).
+	// includeSubscribed=true is shorthand for reader.
+	MinAccessRole string
+	// ExcludeCalendars drops these calendar IDs from the listing; "primary"
+	// matches the primary calendar.
+	ExcludeCalendars map[string]bool
+	// MaxAttendees caps the attendees listed per event.
+	MaxAttendees int
+	// OnlyVideo keeps only events with a video conference link.
+	OnlyVideo bool
+	// AnnotateOverlaps marks events that overlap another in the result.
+	AnnotateOverlaps bool
+	// FoldRecurring collapses a recurring series into one agenda line.
+	FoldRecurring bool
+	// UseGoogleColors reports calendars' own colors instead of the palette.
+	UseGoogleColors bool
+	// DelegateFor is the attendee whose meetings are listed, read from their
+	// own calendar unless calendars is given.
+	DelegateFor string
+	// ResponseStatus keeps only events DelegateFor (or the user, if unset)
+	// has given this response to.
+	ResponseStatus string
+	// Search is free text passed to Google's event search and matched again
+	// against the returned events' text, attendees and organizer.
+	Search string
+	// Expand lists each instance of a recurring series; when false the
+	// instances are collapsed into one entry per series.
+	Expand bool
+	// Attendee and Organizer keep only events with this attendee or
+	// organizer. A value ending in "@" matches any address with that prefix.
+	Attendee  string
+	Organizer string
+	// FullDetail adds attendees' responses, the organizer, location and
+	// visibility to each event.
+	FullDetail bool
+}
+
+// parseEventQuery reads the listing options from the request's query string.
+func parseEventQuery(r *http.Request) (eventQuery, error) {
+	return parseEventValues(r.URL.Query())
+}
+
+// parseEventValues reads the listing options from query parameters.
+func parseEventValues(values url.Values) (eventQuery, error) {
+	q := eventQuery{}
+	var err error
+	if q.SingleEvents, err = parseBoolParam(values, "singleEvents", true); err != nil {
+		return q, err
+	}
+	if q.OnlyMultiDay, err = parseBoolParam(values, "onlyMultiDay", false); err != nil {
+		return q, err
+	}
+	if q.Location, err = parseLocation(values); err != nil {
+		return q, err
+	}
+	q.ZoneGiven = values.Get("tz") != ""
+	if q.TimeMin, q.TimeMax, err = parseWindow(values, q.Location); err != nil {
+		return q, err
+	}
+	if q.Calendars, err = parseCalendarIDs(values); err != nil {
+		return q, err
+	}
+	if q.MaxSummaryLen, err = parseIntParam(values, "maxSummaryLen", 0); err != nil {
+		return q, err
+	}
+	q.Calendar = strings.TrimSpace(values.Get("calendar"))
+	switch q.OrderBy = values.Get("orderBy"); q.OrderBy {
+	case "":
+		q.OrderBy = "updated"
+	case "updated":
+	case "startTime":
+		if !q.SingleEvents {
+			return q, fmt.Errorf("orderBy=startTime requires singleEvents=true")
+		}
+	default:
+		return q, fmt.Errorf("invalid orderBy %q: must be startTime or updated", q.OrderBy)
+	}
+	switch direction := values.Get("sort"); direction {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, fmt.Errorf("invalid sort %q: must be asc or desc", direction)
+	}
+	q.Room = strings.TrimSpace(values.Get("room"))
+	if q.InternalOnly, err = parseBoolParam(values, "internalOnly", false); err != nil {
+		return q, err
+	}
+	if q.IncludeTasks, err = parseBoolParam(values, "includeTasks", false); err != nil {
+		return q, err
+	}
+	includeSubscribed, err := parseBoolParam(values, "includeSubscribed", false)
+	if err != nil {
+		return q, err
+	}
+	switch q.MinAccessRole = values.Get("minAccessRole"); q.MinAccessRole {
+	case "":
+		q.MinAccessRole = "owner"
+		if includeSubscribed {
+			q.MinAccessRole = "reader"
+		}
+	case "reader", "writer", "owner":
+		if includeSubscribed {
+			return q, fmt.Errorf("includeSubscribed can't be combined with minAccessRole")
+		}
+	default:
+		return q, fmt.Errorf("invalid minAccessRole %q: must be reader, writer or owner", q.MinAccessRole)
+	}
+	if v := values.Get("excludeCalendars"); v != "" {
+		q.ExcludeCalendars = make(map[string]bool)
+		for _, id := range strings.Split(v, ",") {
+			id = strings.TrimSpace(id)
+			if !validCalendarID(id) {
+				return q, fmt.Errorf("invalid calendar ID %q in excludeCalendars", id)
+			}
+			q.ExcludeCalendars[id] = true
+		}
+	}
+	if q.MaxAttendees, err = parseIntParam(values, "maxAttendees", defaultMaxAttendees); err != nil {
+		return q, err
+	}
+	if q.OnlyVideo, err = parseBoolParam(values, "onlyVideo", false); err != nil {
+		return q, err
+	}
+	if q.AnnotateOverlaps, err = parseBoolParam(values, "annotateOverlaps", false); err != nil {
+		return q, err
+	}
+	if q.FoldRecurring, err = parseBoolParam(values, "foldRecurring", false); err != nil {
+		return q, err
+	}
+	if q.UseGoogleColors, err = parseBoolParam(values, "useGoogleColors", false); err != nil {
+		return q, err
+	}
+	if q.Dedupe, err = parseBoolParam(values, "dedupe", false); err != nil {
+		return q, err
+	}
+	if q.DelegateFor = strings.ToLower(strings.TrimSpace(values.Get("delegateFor"))); q.DelegateFor != "" {
+		if q.DelegateFor == "primary" || !validCalendarID(q.DelegateFor) {
+			return q, fmt.Errorf("invalid delegateFor %q: must be an email address", q.DelegateFor)
+		}
+		if q.Calendars == nil {
+			q.Calendars = []string{q.DelegateFor}
+		}
+	}
+	if q.Expand, err = parseBoolParam(values, "expand", true); err != nil {
+		return q, err
+	}
+	q.Search = strings.TrimSpace(values.Get("q"))
+	q.Attendee = strings.ToLower(strings.TrimSpace(values.Get("attendee")))
+	q.Organizer = strings.ToLower(strings.TrimSpace(values.Get("organizer")))
+	if q.ResponseStatus = values.Get("responseStatus"); q.ResponseStatus != "" && !responseStatuses[q.ResponseStatus] {
+		return q, fmt.Errorf("invalid responseStatus %q: must be one of accepted, declined, tentative, needsAction", q.ResponseStatus)
+	}
+	switch detail := values.Get("detail"); detail {
+	case "", "summary":
+	case "full":
+		q.FullDetail = true
+	default:
+		return q, fmt.Errorf("invalid detail %q: must be summary or full", detail)
+	}
+	return q, nil
+}
+
+// parseCalendarIDs reads the comma-separated calendars parameter. Unless
+// includePrimary=false, the primary calendar is always part of the set.
+func parseCalendarIDs(values url.Values) ([]string, error) {
+	v := values.Get("calendars")
+	if v == "" {
+		return nil, nil
+	}
+	includePrimary, err := parseBoolParam(values, "includePrimary", true)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	if includePrimary {
+		seen["primary"] = true
+		ids = append(ids, "primary")
+	}
+	for _, id := range strings.Split(v, ",") {
+		id = strings.TrimSpace(id)
+		if !validCalendarID(id) {
+			return nil, fmt.Errorf("invalid calendar ID %q in calendars", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// validCalendarID reports whether id looks like a calendar ID: "primary" or
+// an email-style address such as project-x@group.calendar.google.com.
+func validCalendarID(id string) bool {
+	if id == "primary" {
+		return true
+	}
+	at := strings.Index(id, "@")
+	return at > 0 && at < len(id)-1 && !strings.ContainsAny(id, " \t/")
+}
+
+// parseIntParam reads an optional non-negative integer query parameter.
+func parseIntParam(values url.Values, name string, def int) (int, error) {
+	v := values.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return def, fmt.Errorf("invalid %s %q: must be a non-negative integer", name, v)
+	}
+	return n, nil
+}
+
+// parseBoolParam reads an optional boolean query parameter.
+func parseBoolParam(values url.Values, name string, def bool) (bool, error) {
+	v := values.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def, fmt.Errorf("invalid %s %q: must be true or false", name, v)
+	}
+	return b, nil
+}
+
+// loadOAuthConfig reads the OAuth client from the credentials file.
+func loadOAuthConfig() (*oauth2.Config, error) {
+	b, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read client secret file: %w", err)
+	}
+
+	// Tokens granted fewer scopes are rejected by checkTokenScopes, so
+	// changing them means authorizing again.
+	config, err := google.ConfigFromJSON(b, oauthScopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file to config: %w", err)
+	}
+	config.Scopes = normalizeScopes(config.Scopes)
+	return config, nil
+}
+
+// upstreamTimeout bounds the Google API calls made for one request, set by
+// the -upstream-timeout flag. Zero leaves them bounded only by the request.
+var upstreamTimeout = 10 * time.Second
+
+// upstreamContext returns the context for a request's Google API calls,
+// cancelled when the client goes away or the upstream timeout passes.
+func upstreamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return withUpstreamTimeout(r.Context())
+}
+
+// withUpstreamTimeout bounds ctx by the upstream timeout.
+func withUpstreamTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if upstreamTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, upstreamTimeout)
+}
+
+// listCalendars returns the calendars selected by the query, or every
+// calendar the authenticated user has MinAccessRole on when none are
+// selected, less any in ExcludeCalendars. A Calendar filter narrows the
+// result to the one calendar with that ID or name.
+func listCalendars(ctx context.Context, srv CalendarService, q eventQuery) ([]*calendar.CalendarListEntry, error) {
+	calendars, err := selectCalendars(ctx, srv, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.ExcludeCalendars) > 0 {
+		kept := make([]*calendar.CalendarListEntry, 0, len(calendars))
+		for _, entry := range calendars {
+			if !q.ExcludeCalendars[entry.Id] && !(entry.Primary && q.ExcludeCalendars["primary"]) {
+				kept = append(kept, entry)
+			}
+		}
+		calendars = kept
+	}
+	if q.Calendar == "" {
+		return calendars, nil
+	}
+	for _, entry := range calendars {
+		if entry.Id == q.Calendar || strings.EqualFold(entry.Summary, q.Calendar) {
+			return []*calendar.CalendarListEntry{entry}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errCalendarNotFound, q.Calendar)
+}
+
+// selectCalendars returns the calendars named by the query, or every
+// calendar the user has at least MinAccessRole on (owner when unset).
+func selectCalendars(ctx context.Context, srv CalendarService, q eventQuery) ([]*calendar.CalendarListEntry, error) {
+	if len(q.Calendars) > 0 {
+		return getCalendars(ctx, srv, q.Calendars)
+	}
+
+	minAccessRole := q.MinAccessRole
+	if minAccessRole == "" {
+		minAccessRole = "owner"
+	}
+
+	calendars := make([]*calendar.CalendarListEntry, 0)
+	pageToken := ""
+	for {
+		var cal *calendar.CalendarList
+		err := breaker.Do(func() (err error) {
+			cal, err = srv.ListCalendars(ctx, minAccessRole, pageToken, calendarPageSize)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve users calendars: %w", err)
+		}
+
+		for _, entry := range cal.Items {
+			if calendarAllowed(entry.Id) {
+				calendars = append(calendars, entry)
+			}
+		}
+
+		pageToken = cal.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+	if len(calendars) == 0 {
+		logger.Warn("No calendars found")
+	}
+	return calendars, nil
+}
+
+// isSubscribed reports whether the user merely subscribes to a calendar
+// rather than owning it. The primary calendar always counts as owned.
+func isSubscribed(entry *calendar.CalendarListEntry) bool {
+	return !entry.Primary && entry.AccessRole != "owner"
+}
+
+// getCalendars looks up each calendar ID in the user's calendar list.
+func getCalendars(ctx context.Context, srv CalendarService, ids []string) ([]*calendar.CalendarListEntry, error) {
+	calendars := make([]*calendar.CalendarListEntry, 0, len(ids))
+	for _, id := range ids {
+		var entry *calendar.CalendarListEntry
+		err := breaker.Do(func() (err error) {
+			entry, err = srv.GetCalendarListEntry(ctx, id)
+			return err
+		})
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", errCalendarNotFound, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve calendar %s: %w", id, err)
+		}
+		if !calendarAllowed(id, entry.Id) {
+			return nil, fmt.Errorf("%w: %s", errCalendarForbidden, id)
+		}
+		calendars = append(calendars, entry)
+	}
+	return calendars, nil
+}
+
+// listEvents fetches the events in the query window from each selected
+// calendar. With Dedupe, copies of an event are merged into the first,
+// which lists every calendar they came from.
+func (a *API) listEvents(ctx context.Context, srv CalendarService, q eventQuery) ([]calendarEvent, error) {
+	c := make([]calendarEvent, 0)
+	dedupe := q.Dedupe
+	q.Dedupe = false
+	err := a.forEachEvent(ctx, srv, q, func(ce calendarEvent) error {
+		c = append(c, ce)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dedupe {
+		c = mergeDuplicates(c)
+	}
+	return c, nil
+}
+
+// mergeDuplicates keeps the first of the events sharing a dedupeKey and sets
+// its Calendars to the names of the calendars all of them were on.
+func mergeDuplicates(events []calendarEvent) []calendarEvent {
+	first := make(map[string]int)
+	merged := make([]calendarEvent, 0, len(events))
+	for _, ce := range events {
+		key := dedupeKey(ce.Event)
+		i, ok := first[key]
+		if !ok {
+			first[key] = len(merged)
+			merged = append(merged, ce)
+			continue
+		}
+		kept := &merged[i]
+		if len(kept.Calendars) == 0 {
+			kept.Calendars = []string{kept.Calendar.Summary}
+		}
+		name := ce.Calendar.Summary
+		for _, existing := range kept.Calendars {
+			if existing == name {
+				name = ""
+				break
+			}
+		}
+		if name != "" {
+			kept.Calendars = append(kept.Calendars, name)
+		}
+	}
+	return merged
+}
+
+// summarizeEvents turns listed events into the JSON listing: annotated with
+// overlaps, collapsed into series and reversed as the query asks.
+func summarizeEvents(ctx context.Context, srv CalendarService, events []calendarEvent, q eventQuery) ([]SummaryEvent, error) {
+	c := make([]SummaryEvent, 0, len(events))
+	for _, ce := range events {
+		summary, err := summarizeEvent(ce, q)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, summary)
+	}
+	if q.AnnotateOverlaps {
+		annotateOverlaps(events, c, q.Location)
+	}
+	if !q.Expand {
+		c = collapseSeries(ctx, srv, events, c)
+	}
+	if q.Descending {
+		for i, j := 0, len(c)-1; i < j; i, j = i+1, j-1 {
+			c[i], c[j] = c[j], c[i]
+		}
+	}
+	return c, nil
+}
+
+// fetchConcurrency bounds how many calendars' events are fetched at once,
+// set by the -fetch-concurrency flag.
+var fetchConcurrency = 4
+
+// calendarResult is the outcome of fetching one calendar's events.
+type calendarResult struct {
+	items []*calendar.Event
+	err   error
+}
+
+// fetchAllCalendars fetches each calendar's events concurrently, at most
+// fetchConcurrency at a time. Each calendar's result arrives on the channel
+// at its index, so callers can use results in order as they come in.
+func (a *API) fetchAllCalendars(ctx context.Context, srv CalendarService, calendars []*calendar.CalendarListEntry, q eventQuery) []<-chan calendarResult {
+	results := make([]<-chan calendarResult, len(calendars))
+	sem := make(chan struct{}, fetchConcurrency)
+	for i, userCalendar := range calendars {
+		// Buffered, so fetches finish even if the caller stops reading.
+		result := make(chan calendarResult, 1)
+		results[i] = result
+		go func(userCalendar *calendar.CalendarListEntry) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			items, err := a.calendarEvents(ctx, srv, userCalendar, q)
+			result <- calendarResult{items: items, err: err}
+		}(userCalendar)
+	}
+	return results
+}
+
+// affectsAllCalendars reports whether a fetch error isn't specific to one
+// calendar, so the whole listing has to fail.
+func affectsAllCalendars(err error) bool {
+	return errors.Is(err, errBreakerOpen) || errors.Is(err, errNotAuthorized) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// forEachEvent calls fn for every event in the query window from each
+// selected calendar, stopping at the first error from fn. With Dedupe,
+// later copies of an event already passed to fn are dropped; their
+// calendars can't be merged into it after the fact. Calendars are
+// fetched concurrently and their events passed to fn in calendar order as
+// soon as each is in; one that fails is logged and left out unless every
+// calendar failed or the failure isn't specific to it.
+func (a *API) forEachEvent(ctx context.Context, srv CalendarService, q eventQuery, fn func(calendarEvent) error) error {
+	q = boundWindow(q)
+	calendars, err := listCalendars(ctx, srv, q)
+	if err != nil {
+		return err
+	}
+	if q.InternalOnly {
+		if q.UserDomain, err = userDomain(ctx, srv); err != nil {
+			return err
+		}
+	}
+
+	results := a.fetchAllCalendars(ctx, srv, calendars, q)
+	failed := 0
+	seen := make(map[string]bool)
+	for i, userCalendar := range calendars {
+		res := <-results[i]
+		if res.err != nil {
+			if affectsAllCalendars(res.err) {
+				return res.err
+			}
+			failed++
+			if failed == len(calendars) {
+				return res.err
+			}
+			logger.Warnf("Leaving out calendar %s: %v", userCalendar.Id, res.err)
+			continue
+		}
+		for _, event := range res.items {
+			if reason := checkEvent(event); reason != "" {
+				skippedEvents.Record(userCalendar.Id, event.Id, reason)
+				continue
+			}
+			if !matchesQuery(event, q) {
+				continue
+			}
+			if q.Dedupe {
+				key := dedupeKey(event)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			if err := fn(calendarEvent{Calendar: userCalendar, Event: event}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dedupeKey identifies an event across calendars by its iCalUID, or its ID
+// when it has none. Instances of a recurring series share the series'
+// iCalUID, so their original start time tells them apart.
+func dedupeKey(event *calendar.Event) string {
+	key := event.ICalUID
+	if key == "" {
+		key = event.Id
+	}
+	if event.RecurringEventId != "" {
+		key += "|" + rawEventTime(event.OriginalStartTime)
+	}
+	return key
+}
+
+// eventPageSize is the largest page Events.List allows, keeping the number of
+// round trips per calendar low.
+const eventPageSize = 2500
+
+// calendarEvents returns the events of one calendar in the query window,
+// read from the synced copy when the syncer covers the window, else served
+// from the cache while the calendar's etag is unchanged.
+func (a *API) calendarEvents(ctx context.Context, srv CalendarService, userCalendar *calendar.CalendarListEntry, q eventQuery) ([]*calendar.Event, error) {
+	if syncer.serves(ctx, userCalendar.Id, q) {
+		return syncer.Events(ctx, srv, userCalendar.Id, q)
+	}
+	user := accountFromContext(ctx)
+	key := eventCacheKey(user, userCalendar.Id, q)
+	if a.events != nil {
+		items, ok := a.events.Get(key, userCalendar.Etag)
+		recordCacheLookup("events", ok)
+		if ok {
+			return items, nil
+		}
+	}
+	if a.inflight == nil {
+		return a.fetchCalendarEvents(ctx, srv, userCalendar, q, user, key)
+	}
+
+	// The shared fetch outlives any one waiter, so it gets its own deadline
+	// rather than the context of whichever request started it.
+	ch := a.inflight.DoChan(key+"|"+userCalendar.Etag, func() (interface{}, error) {
+		fetchCtx, cancel := withUpstreamTimeout(context.Background())
+		defer cancel()
+		return a.fetchCalendarEvents(fetchCtx, srv, userCalendar, q, user, key)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]*calendar.Event), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("unable to retrieve events from calendar %s: %w", userCalendar.Id, ctx.Err())
+	}
+}
+
+// fetchCalendarEvents lists a calendar's events from Google and caches them
+// under user's key.
+func (a *API) fetchCalendarEvents(ctx context.Context, srv CalendarService, userCalendar *calendar.CalendarListEntry, q eventQuery, user, key string) ([]*calendar.Event, error) {
+	items := make([]*calendar.Event, 0)
+	pageToken := ""
+	for {
+		var events *calendar.Events
+		err := breaker.Do(func() (err error) {
+			events, err = srv.ListEvents(ctx, userCalendar.Id, eventListOptions{
+				SingleEvents: q.SingleEvents,
+				TimeMin:      q.TimeMin,
+				TimeMax:      q.TimeMax,
+				OrderBy:      q.OrderBy,
+				Query:        q.Search,
+				PageToken:    pageToken,
+				MaxResults:   eventPageSize,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve events from calendar %s: %w", userCalendar.Id, err)
+		}
+		items = append(items, events.Items...)
+		if events.NextPageToken == "" {
+			break
+		}
+		pageToken = events.NextPageToken
+	}
+
+	a.events.Put(key, user, userCalendar.Id, userCalendar.Etag, items)
+	return items, nil
+}
+
+// checkEvent returns why a malformed event has to be skipped, or "" if it
+// is usable. Events ending before they start are clamped unless the
+// -inverted-events flag asks for them to be skipped.
+func checkEvent(event *calendar.Event) string {
+	if event.Start == nil || (event.Start.DateTime == "" && event.Start.Date == "") {
+		return "missing start time"
+	}
+	if isTask(event) {
+		return ""
+	}
+	start, err := parseEventDateTime(event.Start)
+	if err != nil {
+		return fmt.Sprintf("unparseable start time: %v", err)
+	}
+	end, err := parseEventDateTime(event.End)
+	if err != nil {
+		return fmt.Sprintf("unparseable end time: %v", err)
+	}
+	if end.Before(start) {
+		if invertedEvents == invertedSkip {
+			return "ends before it starts"
+		}
+		logger.Warnf("Event %s ends before it starts; clamping its duration to 0", event.Id)
+	}
+	return ""
+}
+
+// matchesQuery reports whether event passes the query's filters.
+func matchesQuery(event *calendar.Event, q eventQuery) bool {
+	if isTask(event) && !q.IncludeTasks {
+		return false
+	}
+	if q.OnlyMultiDay && !isMultiDay(event) {
+		return false
+	}
+	if q.Room != "" && !booksRoom(event, q.Room) {
+		return false
+	}
+	if q.InternalOnly && !organizedWithin(event, q.UserDomain) {
+		return false
+	}
+	if q.OnlyVideo && videoLink(event) == "" {
+		return false
+	}
+	if q.DelegateFor != "" || q.ResponseStatus != "" {
+		status := attendeeResponse(event, q.DelegateFor)
+		if status == "" || (q.ResponseStatus != "" && status != q.ResponseStatus) {
+			return false
+		}
+	}
+	if q.Search != "" && !mentions(event, q.Search) {
+		return false
+	}
+	if q.Attendee != "" && !hasAttendee(event, q.Attendee) {
+		return false
+	}
+	if q.Organizer != "" && (event.Organizer == nil || !emailMatches(event.Organizer.Email, q.Organizer)) {
+		return false
+	}
+	return true
+}
+
+// emailMatches reports whether email is want, or starts with want when want
+// ends in "@", ignoring case.
+func emailMatches(email, want string) bool {
+	email = strings.ToLower(email)
+	if strings.HasSuffix(want, "@") {
+		return strings.HasPrefix(email, want)
+	}
+	return email == want
+}
+
+// hasAttendee reports whether any of the event's attendees matches want.
+func hasAttendee(event *calendar.Event, want string) bool {
+	for _, attendee := range event.Attendees {
+		if emailMatches(attendee.Email, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentions reports whether text appears, ignoring case, in the event's
+// summary, description or location, or in an attendee's or the organizer's
+// name or address.
+func mentions(event *calendar.Event, text string) bool {
+	text = strings.ToLower(text)
+	fields := []string{event.Summary, event.Description, event.Location}
+	for _, attendee := range event.Attendees {
+		fields = append(fields, attendee.Email, attendee.DisplayName)
+	}
+	if event.Organizer != nil {
+		fields = append(fields, event.Organizer.Email, event.Organizer.DisplayName)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseStatuses are the attendee responses Google reports.
+var responseStatuses = map[string]bool{"accepted": true, "declined": true, "tentative": true, "needsAction": true}
+
+// attendeeResponse returns how the attendee with the given email, or the
+// authenticated user when email is "", responded to event. An organizer of
+// an event without an attendee list counts as having accepted it; "" means
+// they aren't invited.
+func attendeeResponse(event *calendar.Event, email string) string {
+	for _, attendee := range event.Attendees {
+		if (email == "" && attendee.Self) || (email != "" && strings.EqualFold(attendee.Email, email)) {
+			return attendee.ResponseStatus
+		}
+	}
+	if len(event.Attendees) == 0 && event.Organizer != nil &&
+		((email == "" && event.Organizer.Self) || (email != "" && strings.EqualFold(event.Organizer.Email, email))) {
+		return "accepted"
+	}
+	return ""
+}
+
+// videoLink returns the event's video conference URL from its conference
+// data, falling back to the legacy Hangouts link. Phone-only or other
+// non-video conference entries yield "".
+func videoLink(event *calendar.Event) string {
+	if event.ConferenceData != nil {
+		for _, ep := range event.ConferenceData.EntryPoints {
+			if ep.EntryPointType == "video" && ep.Uri != "" {
+				return ep.Uri
+			}
+		}
+	}
+	return event.HangoutLink
+}
+
+// conferenceName returns the name of the event's conferencing solution,
+// such as "Google Meet" or "Zoom Meeting".
+func conferenceName(event *calendar.Event) string {
+	if event.ConferenceData != nil && event.ConferenceData.ConferenceSolution != nil {
+		return event.ConferenceData.ConferenceSolution.Name
+	}
+	if event.HangoutLink != "" {
+		return "Google Meet"
+	}
+	return ""
+}
+
+// organizedWithin reports whether event's organizer belongs to domain.
+// Events without an organizer email can't be attributed and are excluded.
+func organizedWithin(event *calendar.Event, domain string) bool {
+	if event.Organizer == nil || event.Organizer.Email == "" {
+		return false
+	}
+	return emailDomain(event.Organizer.Email) == domain
+}
+
+// emailDomain returns the lower-cased domain of an email address, or "" if
+// it has none.
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// userDomain returns the authenticated user's email domain. The primary
+// calendar's ID is the user's email address.
+func userDomain(ctx context.Context, srv CalendarService) (string, error) {
+	var entry *calendar.CalendarListEntry
+	err := breaker.Do(func() (err error) {
+		entry, err = srv.GetCalendarListEntry(ctx, "primary")
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve primary calendar: %w", err)
+	}
+	domain := emailDomain(entry.Id)
+	if domain == "" {
+		return "", fmt.Errorf("unable to determine domain from primary calendar %q", entry.Id)
+	}
+	return domain, nil
+}
+
+// booksRoom reports whether event books room, given as a resource email or a
+// room name. Room resources appear as attendees flagged as resources, but
+// some events only name the room in their location.
+func booksRoom(event *calendar.Event, room string) bool {
+	room = strings.ToLower(room)
+	for _, attendee := range event.Attendees {
+		if !attendee.Resource {
+			continue
+		}
+		if strings.ToLower(attendee.Email) == room || strings.Contains(strings.ToLower(attendee.DisplayName), room) {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(event.Location), room)
+}
+
+// eventTimes parses the start and end of an event. Recurring masters carry
+// the series template here, so their duration is that of one instance.
+func eventTimes(event *calendar.Event) (time.Time, time.Time, error) {
+	startTime, err := parseEventDateTime(event.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	endTime, err := parseEventDateTime(event.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	// Mis-synced events can end before they start; never report a negative
+	// duration.
+	if endTime.Before(startTime) {
+		endTime = startTime
+	}
+	return startTime, endTime, nil
+}
+
+// eventSpan returns when event starts and ends, reading the dates of
+// all-day events as midnight in loc rather than UTC.
+func eventSpan(event *calendar.Event, loc *time.Location) (time.Time, time.Time, error) {
+	if !isAllDay(event) {
+		return eventTimes(event)
+	}
+	start, err := time.ParseInLocation(dateLayout, event.Start.Date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := time.ParseInLocation(dateLayout, event.End.Date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if end.Before(start) {
+		end = start
+	}
+	return start, end, nil
+}
+
+// eventStart returns when event starts, or the zero time if it can't be
+// parsed, for ordering events.
+func eventStart(event *calendar.Event) time.Time {
+	start, _ := parseEventDateTime(event.Start)
+	return start
+}
+
+// parseEventDateTime parses a timed DateTime, falling back to the date-only
+// form Google uses for all-day events.
+func parseEventDateTime(edt *calendar.EventDateTime) (time.Time, error) {
+	if edt == nil {
+		return time.Time{}, errors.New("event has no start or end")
+	}
+	if edt.DateTime == "" && edt.Date != "" {
+		return time.Parse(dateLayout, edt.Date)
+	}
+	return time.Parse(time.RFC3339, edt.DateTime)
+}
+
+// rawEventTime returns the DateTime of a timed event or the Date of an
+// all-day event, as sent by Google.
+func rawEventTime(edt *calendar.EventDateTime) string {
+	if edt == nil {
+		return ""
+	}
+	if edt.DateTime != "" {
+		return edt.DateTime
+	}
+	return edt.Date
+}
+
+// isTask reports whether event is a task-like entry: typed as a task or
+// without a usable end time.
+func isTask(event *calendar.Event) bool {
+	return event.EventType == "task" || event.EndTimeUnspecified ||
+		event.End == nil || (event.End.DateTime == "" && event.End.Date == "")
+}
+
+// isAllDay reports whether event is date-only rather than timed.
+func isAllDay(event *calendar.Event) bool {
+	return event.Start != nil && event.Start.DateTime == "" && event.Start.Date != ""
+}
+
+// isMultiDay reports whether event is all-day or runs longer than 24 hours.
+func isMultiDay(event *calendar.Event) bool {
+	if isAllDay(event) {
+		return true
+	}
+	startTime, endTime, err := eventTimes(event)
+	if err != nil {
+		return false
+	}
+	return endTime.Sub(startTime) > 24*time.Hour
+}
+
+// isRecurringMaster reports whether event is the parent of a recurring series
+// rather than a single instance.
+func isRecurringMaster(event *calendar.Event) bool {
+	return len(event.Recurrence) > 0
+}
+
+// summarizeEvent converts a listed event into its JSON summary.
+func summarizeEvent(ce calendarEvent, q eventQuery) (SummaryEvent, error) {
+	summary, err := summarizeEventTimes(ce, q)
+	if err != nil {
+		return summary, err
+	}
+	summary.Calendars = ce.Calendars
+	if !q.FullDetail {
+		return summary, nil
+	}
+	for i, a := range ce.Event.Attendees {
+		if i == len(summary.Attendees) {
+			break
+		}
+		summary.Attendees[i].ResponseStatus = a.ResponseStatus
+		summary.Attendees[i].Optional = a.Optional
+		summary.Attendees[i].Organizer = a.Organizer
+	}
+	if o := ce.Event.Organizer; o != nil {
+		summary.Organizer = &SummaryAttendee{Email: o.Email, DisplayName: o.DisplayName}
+	}
+	summary.Location = ce.Event.Location
+	summary.HangoutLink = ce.Event.HangoutLink
+	summary.Visibility = ce.Event.Visibility
+	if summary.Visibility == "" {
+		summary.Visibility = "default"
+	}
+	return summary, nil
+}
+
+// summarizeEventTimes builds the summary every detail level shares.
+func summarizeEventTimes(ce calendarEvent, q eventQuery) (SummaryEvent, error) {
+	attendees, attendeeCount := summarizeAttendees(ce.Event, q.MaxAttendees)
+	if isTask(ce.Event) {
+		return SummaryEvent{
+			ID:            ce.Event.Id,
+			Calendar:      ce.Calendar.Summary,
+			CalendarColor: calendarColor(ce.Calendar, q.UseGoogleColors),
+			Summary:       truncateSummary(ce.Event.Summary, q.MaxSummaryLen),
+			Created:       ce.Event.Created,
+			Updated:       ce.Event.Updated,
+			Type:          "task",
+			Attendees:     attendees,
+			AttendeeCount: attendeeCount,
+		}, nil
+	}
+
+	loc := responseLocation(ce, q)
+	startTime, endTime, err := eventSpan(ce.Event, loc)
+	if err != nil {
+		return SummaryEvent{}, fmt.Errorf("error parsing time from event %s: %w", ce.Event.Id, err)
+	}
+
+	master := isRecurringMaster(ce.Event)
+	summary := SummaryEvent{
+		ID:              ce.Event.Id,
+		Calendar:        ce.Calendar.Summary,
+		CalendarColor:   calendarColor(ce.Calendar, q.UseGoogleColors),
+		Summary:         truncateSummary(ce.Event.Summary, q.MaxSummaryLen),
+		Created:         ce.Event.Created,
+		Updated:         ce.Event.Updated,
+		RecurringEvent:  master || ce.Event.RecurringEventId != "",
+		RecurringMaster: master,
+		RecurringID:     ce.Event.RecurringEventId,
+		Recurrence:      ce.Event.Recurrence,
+		Start:           formatEventTime(ce.Event.Start, startTime, loc),
+		End:             formatEventTime(ce.Event.End, endTime, loc),
+		TimeZone:        loc.String(),
+		EventTime:       endTime.Sub(startTime).Minutes(),
+		AllDay:          isAllDay(ce.Event),
+		Attendees:       attendees,
+		AttendeeCount:   attendeeCount,
+		MeetingLink:     videoLink(ce.Event),
+		Conference:      conferenceName(ce.Event),
+	}
+	if q.IncludeTasks {
+		summary.Type = "event"
+	}
+	if q.OnlyMultiDay {
+		summary.SpanDays = endTime.Sub(startTime).Hours() / 24
+	}
+	if summary.AllDay {
+		summary.DurationDays = float64(calendarDays(startTime, endTime))
+	}
+	return summary, nil
+}
+
+// responseLocation is the time zone an event's times are reported in: the
+// tz parameter's when given, else the event's calendar's, else the server's.
+func responseLocation(ce calendarEvent, q eventQuery) *time.Location {
+	if !q.ZoneGiven && ce.Calendar.TimeZone != "" {
+		if loc, err := time.LoadLocation(ce.Calendar.TimeZone); err == nil {
+			return loc
+		}
+	}
+	return q.Location
+}
+
+// formatEventTime reports a start or end time in loc, keeping all-day dates
+// as plain dates since they name a day rather than an instant.
+func formatEventTime(edt *calendar.EventDateTime, t time.Time, loc *time.Location) string {
+	if edt != nil && edt.DateTime == "" && edt.Date != "" {
+		return edt.Date
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// calendarDays counts the dates from start up to end, so a day shortened or
+// lengthened by a DST change still counts as one.
+func calendarDays(start, end time.Time) int {
+	sy, sm, sd := start.Date()
+	ey, em, ed := end.Date()
+	from := time.Date(sy, sm, sd, 0, 0, 0, 0, time.UTC)
+	to := time.Date(ey, em, ed, 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// summarizeAttendees lists up to max of an event's attendees along with the
+// full attendee count.
+func summarizeAttendees(event *calendar.Event, max int) ([]SummaryAttendee, int) {
+	attendees := make([]SummaryAttendee, 0)
+	for _, a := range event.Attendees {
+		if len(attendees) == max {
+			break
+		}
+		attendees = append(attendees, SummaryAttendee{Email: a.Email, DisplayName: a.DisplayName})
+	}
+	return attendees, len(event.Attendees)
+}
+
+// truncateSummary shortens s to at most max characters, ending in an
+// ellipsis when cut. It counts runes so multi-byte characters are never split.
+func truncateSummary(s string, max int) string {
+	if max <= 0 {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"unicode/utf8"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// listCalendar GETs target from api's CalendarHandler and decodes the
+// events it lists.
+func listCalendar(t *testing.T, api *API, target string) []SummaryEvent {
+	t.Helper()
+	rec := serve(api.CalendarHandler, target)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, body %s", target, rec.Code, rec.Body)
+	}
+	var events []SummaryEvent
+	if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	return events
+}
+
+// eventIDs returns the IDs of events, in order.
+func eventIDs(events []SummaryEvent) []string {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestRecurringMasterDuration(t *testing.T) {
+	master := timedEvent("weekly", "1:1", "2024-03-04T10:00:00Z", "2024-03-04T10:45:00Z")
+	master.Recurrence = []string{"RRULE:FREQ=WEEKLY;COUNT=10"}
+	instance := timedEvent("weekly_20240311", "1:1", "2024-03-11T10:00:00Z", "2024-03-11T10:45:00Z")
+	instance.RecurringEventId = "weekly"
+
+	tests := []struct {
+		name         string
+		event        *calendar.Event
+		singleEvents string
+		wantMaster   bool
+	}{
+		{"master", master, "false", true},
+		{"instance", instance, "true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeService(primaryCalendar("me@example.com"))
+			srv.addEvents("me@example.com", tt.event)
+			events := listCalendar(t, newTestAPI(srv), "/calendar?singleEvents="+tt.singleEvents+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			if len(events) != 1 {
+				t.Fatalf("listed %d events, want 1", len(events))
+			}
+			got := events[0]
+			if got.RecurringMaster != tt.wantMaster || got.EventTime != 45 {
+				t.Errorf("event = {RecurringMaster: %v, EventTime: %v}, want %v and 45 minutes", got.RecurringMaster, got.EventTime, tt.wantMaster)
+			}
+		})
+	}
+}
+
+func TestEventTimes(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *calendar.Event
+		minutes float64
+	}{
+		{"timed", timedEvent("a", "", "2024-03-04T10:00:00Z", "2024-03-04T10:30:00Z"), 30},
+		{"offsets", timedEvent("b", "", "2024-03-04T10:00:00+01:00", "2024-03-04T10:00:00Z"), 60},
+		{"all day", allDayEvent("c", "", "2024-03-04", "2024-03-05"), 24 * 60},
+		{"template of a series", &calendar.Event{
+			Recurrence: []string{"RRULE:FREQ=DAILY"},
+			Start:      &calendar.EventDateTime{DateTime: "2024-01-01T09:00:00Z"},
+			End:        &calendar.EventDateTime{DateTime: "2024-01-01T09:15:00Z"},
+		}, 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := eventTimes(tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := end.Sub(start).Minutes(); got != tt.minutes {
+				t.Errorf("duration = %v minutes, want %v", got, tt.minutes)
+			}
+		})
+	}
+}
+
+func TestOnlyMultiDay(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		timedEvent("standup", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:15:00Z"),
+		allDayEvent("offsite", "Offsite", "2024-03-05", "2024-03-08"),
+		timedEvent("review", "Review", "2024-03-06T14:00:00Z", "2024-03-06T15:00:00Z"),
+	)
+
+	tests := []struct {
+		onlyMultiDay string
+		want         []string
+	}{
+		{"false", []string{"standup", "offsite", "review"}},
+		{"true", []string{"offsite"}},
+	}
+	for _, tt := range tests {
+		t.Run("onlyMultiDay="+tt.onlyMultiDay, func(t *testing.T) {
+			events := listCalendar(t, newTestAPI(srv), "/calendar?onlyMultiDay="+tt.onlyMultiDay+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+			if tt.onlyMultiDay == "true" && events[0].SpanDays != 3 {
+				t.Errorf("spanDays = %v, want 3", events[0].SpanDays)
+			}
+		})
+	}
+}
+
+func TestParseCalendarIDs(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"calendars=team@group.calendar.google.com", []string{"primary", "team@group.calendar.google.com"}, false},
+		{"calendars=team@group.calendar.google.com,primary,team@group.calendar.google.com", []string{"primary", "team@group.calendar.google.com"}, false},
+		{"calendars=team@group.calendar.google.com&includePrimary=false", []string{"team@group.calendar.google.com"}, false},
+		{"calendars=not-a-calendar", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseCalendarIDs(values)
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCalendarIDs() = %v, %v; want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrimaryAndSelectedCalendars(t *testing.T) {
+	const team, other = "team@group.calendar.google.com", "other@group.calendar.google.com"
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar(team, "Team"), ownedCalendar(other, "Other"))
+	srv.addEvents("me@example.com", timedEvent("mine", "Mine", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"))
+	srv.addEvents(team, timedEvent("teams", "Team's", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"))
+	srv.addEvents(other, timedEvent("others", "Other's", "2024-03-06T09:00:00Z", "2024-03-06T10:00:00Z"))
+
+	events := listCalendar(t, newTestAPI(srv), "/calendar?calendars="+team+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+	if got, want := eventIDs(events), []string{"mine", "teams"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+}
+
+func TestTruncateSummary(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"Planning", 0, "Planning"},
+		{"Planning", 8, "Planning"},
+		{"Planning", 7, "Planni…"},
+		{"Planning", 1, "…"},
+		{"Café meeting", 4, "Caf…"},
+		{"Café meeting", 5, "Café…"},
+		{"日本語の会議", 6, "日本語の会議"},
+		{"日本語の会議", 4, "日本語…"},
+		{"🎉🎉🎉", 2, "🎉…"},
+	}
+	for _, tt := range tests {
+		got := truncateSummary(tt.s, tt.max)
+		if got != tt.want {
+			t.Errorf("truncateSummary(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateSummary(%q, %d) split a character: %q", tt.s, tt.max, got)
+		}
+	}
+}
+
+func TestBooksRoom(t *testing.T) {
+	withRoom := timedEvent("a", "Planning", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z")
+	withRoom.Attendees = []*calendar.EventAttendee{
+		{Email: "alice@example.com"},
+		{Email: "c_188abc@resource.calendar.google.com", DisplayName: "HQ-2-Boardroom (12)", Resource: true},
+	}
+	named := timedEvent("b", "Lunch", "2024-03-04T12:00:00Z", "2024-03-04T13:00:00Z")
+	named.Location = "HQ Cafeteria"
+	// A person whose name matches isn't a room.
+	person := timedEvent("c", "1:1", "2024-03-04T14:00:00Z", "2024-03-04T14:30:00Z")
+	person.Attendees = []*calendar.EventAttendee{{Email: "boardroom@example.com", DisplayName: "Boardroom"}}
+
+	tests := []struct {
+		name  string
+		event *calendar.Event
+		room  string
+		want  bool
+	}{
+		{"resource email", withRoom, "C_188abc@resource.calendar.google.com", true},
+		{"resource name", withRoom, "boardroom", true},
+		{"other room", withRoom, "cafeteria", false},
+		{"location", named, "cafeteria", true},
+		{"attendee that isn't a resource", person, "boardroom", false},
+	}
+	for _, tt := range tests {
+		if got := booksRoom(tt.event, tt.room); got != tt.want {
+			t.Errorf("%s: booksRoom(%q) = %v, want %v", tt.name, tt.room, got, tt.want)
+		}
+	}
+}
+
+func TestInternalOnly(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		organizedBy(timedEvent("internal", "Planning", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"), "Alice@Example.com"),
+		organizedBy(timedEvent("external", "Vendor call", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"), "sales@vendor.example"),
+		organizedBy(timedEvent("subdomain", "Partner sync", "2024-03-06T09:00:00Z", "2024-03-06T10:00:00Z"), "bob@eu.example.com"),
+		timedEvent("unknown", "No organizer", "2024-03-07T09:00:00Z", "2024-03-07T10:00:00Z"),
+	)
+
+	tests := []struct {
+		internalOnly string
+		want         []string
+	}{
+		{"false", []string{"internal", "external", "subdomain", "unknown"}},
+		{"true", []string{"internal"}},
+	}
+	for _, tt := range tests {
+		t.Run("internalOnly="+tt.internalOnly, func(t *testing.T) {
+			events := listCalendar(t, newTestAPI(srv), "/calendar?internalOnly="+tt.internalOnly+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTasks(t *testing.T) {
+	task := &calendar.Event{
+		Id: "task", Summary: "File expenses", EventType: "task", Status: "confirmed",
+		Start: &calendar.EventDateTime{DateTime: "2024-03-05T09:00:00Z"},
+	}
+	noEnd := &calendar.Event{
+		Id: "reminder", Summary: "Call back", Status: "confirmed", EndTimeUnspecified: true,
+		Start: &calendar.EventDateTime{DateTime: "2024-03-06T09:00:00Z"},
+		End:   &calendar.EventDateTime{DateTime: "2024-03-06T09:00:00Z"},
+	}
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com", timedEvent("meeting", "Meeting", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"), task, noEnd)
+
+	tests := []struct {
+		includeTasks string
+		want         []string
+		wantTypes    []string
+	}{
+		{"false", []string{"meeting"}, []string{""}},
+		{"true", []string{"meeting", "task", "reminder"}, []string{"event", "task", "task"}},
+	}
+	for _, tt := range tests {
+		t.Run("includeTasks="+tt.includeTasks, func(t *testing.T) {
+			events := listCalendar(t, newTestAPI(srv), "/calendar?includeTasks="+tt.includeTasks+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("listed %v, want %v", got, tt.want)
+			}
+			types := make([]string, 0, len(events))
+			for _, event := range events {
+				types = append(types, event.Type)
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("types = %v, want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestCalendarListPagination(t *testing.T) {
+	saved := calendarPageSize
+	calendarPageSize = 15
+	defer func() { calendarPageSize = saved }()
+
+	calendars := make([]*calendar.CalendarListEntry, 0, 30)
+	for i := 0; i < 30; i++ {
+		calendars = append(calendars, ownedCalendar(fmt.Sprintf("cal%02d@group.calendar.google.com", i), fmt.Sprintf("Calendar %d", i)))
+	}
+	srv := newFakeService(calendars...)
+
+	rec := serve(newTestAPI(srv).CalendarsHandler, "/calendars")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var infos []CalendarInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 30 {
+		t.Errorf("listed %d calendars, want 30", len(infos))
+	}
+	if want := []int64{15, 15}; !reflect.DeepEqual(srv.calendarListCalls, want) {
+		t.Errorf("CalendarList page sizes = %v, want %v", srv.calendarListCalls, want)
+	}
+}
+
+func TestInvertedEvents(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		timedEvent("ok", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"),
+		timedEvent("inverted", "Mis-synced", "2024-03-05T10:00:00Z", "2024-03-05T09:00:00Z"),
+	)
+
+	tests := []struct {
+		mode      string
+		wantIDs   []string
+		wantTimes []float64
+	}{
+		{invertedClamp, []string{"ok", "inverted"}, []float64{30, 0}},
+		{invertedSkip, []string{"ok"}, []float64{30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			saved := invertedEvents
+			invertedEvents = tt.mode
+			defer func() { invertedEvents = saved }()
+
+			events := listCalendar(t, newTestAPI(srv), "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			times := make([]float64, 0, len(events))
+			for _, event := range events {
+				times = append(times, event.EventTime)
+			}
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.wantIDs) || !reflect.DeepEqual(times, tt.wantTimes) {
+				t.Errorf("listed %v with minutes %v, want %v with %v", got, times, tt.wantIDs, tt.wantTimes)
+			}
+		})
+	}
+}
+
+func TestMaxAttendees(t *testing.T) {
+	allHands := timedEvent("all-hands", "All hands", "2024-03-04T16:00:00Z", "2024-03-04T17:00:00Z")
+	for i := 0; i < 60; i++ {
+		allHands.Attendees = append(allHands.Attendees, &calendar.EventAttendee{Email: fmt.Sprintf("person%02d@example.com", i)})
+	}
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com", allHands)
+
+	tests := []struct {
+		query      string
+		wantListed int
+	}{
+		{"", defaultMaxAttendees},
+		{"maxAttendees=3", 3},
+		{"maxAttendees=0", 0},
+		{"maxAttendees=100", 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			events := listCalendar(t, newTestAPI(srv), "/calendar?"+tt.query+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			if len(events) != 1 {
+				t.Fatalf("listed %d events, want 1", len(events))
+			}
+			if got := len(events[0].Attendees); got != tt.wantListed {
+				t.Errorf("listed %d attendees, want %d", got, tt.wantListed)
+			}
+			if got := events[0].AttendeeCount; got != 60 {
+				t.Errorf("attendeeCount = %d, want 60", got)
+			}
+		})
+	}
+
+	if rec := serve(newTestAPI(srv).CalendarHandler, "/calendar?maxAttendees=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("maxAttendees=-1: status %d, want 400", rec.Code)
+	}
+}
+
+func TestOnlyVideo(t *testing.T) {
+	meet := timedEvent("meet", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:15:00Z")
+	meet.HangoutLink = "https://meet.google.com/abc-defg-hij"
+	zoom := timedEvent("zoom", "Client call", "2024-03-04T11:00:00Z", "2024-03-04T12:00:00Z")
+	zoom.ConferenceData = &calendar.ConferenceData{
+		ConferenceSolution: &calendar.ConferenceSolution{Name: "Zoom Meeting"},
+		EntryPoints: []*calendar.EntryPoint{
+			{EntryPointType: "phone", Uri: "tel:+1-555-0100"},
+			{EntryPointType: "video", Uri: "https://zoom.us/j/123"},
+		},
+	}
+	dialIn := timedEvent("dial-in", "Phone bridge", "2024-03-04T13:00:00Z", "2024-03-04T13:30:00Z")
+	dialIn.ConferenceData = &calendar.ConferenceData{
+		ConferenceSolution: &calendar.ConferenceSolution{Name: "Phone"},
+		EntryPoints:        []*calendar.EntryPoint{{EntryPointType: "phone", Uri: "tel:+1-555-0101"}},
+	}
+	inPerson := timedEvent("in-person", "Lunch", "2024-03-04T12:00:00Z", "2024-03-04T13:00:00Z")
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com", meet, zoom, dialIn, inPerson)
+
+	tests := []struct {
+		onlyVideo       string
+		want            []string
+		wantLinks       []string
+		wantConferences []string
+	}{
+		{"false", []string{"meet", "zoom", "dial-in", "in-person"},
+			[]string{"https://meet.google.com/abc-defg-hij", "https://zoom.us/j/123", "", ""},
+			[]string{"Google Meet", "Zoom Meeting", "Phone", ""}},
+		{"true", []string{"meet", "zoom"},
+			[]string{"https://meet.google.com/abc-defg-hij", "https://zoom.us/j/123"},
+			[]string{"Google Meet", "Zoom Meeting"}},
+	}
+	for _, tt := range tests {
+		t.Run("onlyVideo="+tt.onlyVideo, func(t *testing.T) {
+			events := listCalendar(t, newTestAPI(srv), "/calendar?onlyVideo="+tt.onlyVideo+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			links, conferences := make([]string, 0), make([]string, 0)
+			for _, event := range events {
+				links = append(links, event.MeetingLink)
+				conferences = append(conferences, event.Conference)
+			}
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("listed %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(links, tt.wantLinks) || !reflect.DeepEqual(conferences, tt.wantConferences) {
+				t.Errorf("links %q conferences %q, want %q %q", links, conferences, tt.wantLinks, tt.wantConferences)
+			}
+		})
+	}
+}
+
+func TestDelegateFor(t *testing.T) {
+	const exec = "exec@example.com"
+	responding := func(event *calendar.Event, status string) *calendar.Event {
+		event.Attendees = []*calendar.EventAttendee{
+			{Email: "me@example.com", Self: true, ResponseStatus: "accepted"},
+			{Email: "Exec@Example.com", ResponseStatus: status},
+		}
+		return event
+	}
+	organized := timedEvent("organized", "Exec staff", "2024-03-08T09:00:00Z", "2024-03-08T10:00:00Z")
+	organized.Organizer = &calendar.EventOrganizer{Email: exec}
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar(exec, "Exec"))
+	srv.addEvents(exec,
+		responding(timedEvent("board", "Board", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"), "accepted"),
+		responding(timedEvent("vendor", "Vendor pitch", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"), "declined"),
+		responding(timedEvent("offsite", "Offsite", "2024-03-06T09:00:00Z", "2024-03-06T10:00:00Z"), "tentative"),
+		timedEvent("uninvited", "Focus", "2024-03-07T09:00:00Z", "2024-03-07T10:00:00Z"),
+		organized,
+	)
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{"delegateFor=" + exec + "&responseStatus=accepted", http.StatusOK, []string{"board", "organized"}},
+		{"delegateFor=" + exec + "&responseStatus=declined", http.StatusOK, []string{"vendor"}},
+		{"delegateFor=" + exec, http.StatusOK, []string{"board", "vendor", "offsite", "organized"}},
+		{"delegateFor=primary", http.StatusBadRequest, nil},
+		{"delegateFor=" + exec + "&responseStatus=maybe", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			target := "/calendar?" + tt.query + "&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"
+			if tt.wantCode != http.StatusOK {
+				if rec := serve(newTestAPI(srv).CalendarHandler, target); rec.Code != tt.wantCode {
+					t.Errorf("status %d, want %d", rec.Code, tt.wantCode)
+				}
+				return
+			}
+			if got := eventIDs(listCalendar(t, newTestAPI(srv), target)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The delegate's calendar has to be one the token can read.
+	rec := serve(newTestAPI(srv).CalendarHandler, "/calendar?delegateFor=other@example.com&responseStatus=accepted")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown delegate: status %d, want 404", rec.Code)
+	}
+}
+
+func TestEventPagination(t *testing.T) {
+	const team = "team@group.calendar.google.com"
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar(team, "Team"), ownedCalendar("ops@group.calendar.google.com", "Ops"))
+	srv.pageSize = 2
+	srv.addEvents("me@example.com",
+		timedEvent("m1", "One", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+		timedEvent("m2", "Two", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"),
+		timedEvent("m3", "Three", "2024-03-06T09:00:00Z", "2024-03-06T10:00:00Z"),
+	)
+	srv.addEvents(team,
+		timedEvent("t1", "Four", "2024-03-07T09:00:00Z", "2024-03-07T10:00:00Z"),
+		timedEvent("t2", "Five", "2024-03-08T09:00:00Z", "2024-03-08T10:00:00Z"),
+	)
+	srv.addEvents("ops@group.calendar.google.com", timedEvent("o1", "Six", "2024-03-09T09:00:00Z", "2024-03-09T10:00:00Z"))
+
+	// Every owned calendar is listed, across two calendar list pages.
+	events := listCalendar(t, newTestAPI(srv), "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+	if got, want := eventIDs(events), []string{"m1", "m2", "m3", "t1", "t2", "o1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+	tokens := make([]string, 0)
+	for _, opts := range srv.eventListCalls() {
+		tokens = append(tokens, opts.PageToken)
+	}
+	// Calendars are fetched concurrently, so only the set of tokens is fixed.
+	sort.Strings(tokens)
+	if want := []string{"", "", "", "2"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Events.List page tokens %q, want %q", tokens, want)
+	}
+	if got := len(srv.calendarListCalls); got != 2 {
+		t.Errorf("CalendarList calls = %d, want 2", got)
+	}
+}
+
+func TestRecurringEventField(t *testing.T) {
+	instance := timedEvent("weekly_20240311", "1:1", "2024-03-11T10:00:00Z", "2024-03-11T10:45:00Z")
+	instance.RecurringEventId = "weekly"
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com", instance, timedEvent("once", "Interview", "2024-03-12T10:00:00Z", "2024-03-12T11:00:00Z"))
+
+	rec := serve(newTestAPI(srv).CalendarHandler, "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var events []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"weekly_20240311": true, "once": false}
+	if len(events) != len(want) {
+		t.Fatalf("listed %d events, want %d", len(events), len(want))
+	}
+	for _, event := range events {
+		if got := event["recurringEvent"]; got != want[event["id"].(string)] {
+			t.Errorf("%v: recurringEvent = %v, want %v", event["id"], got, want[event["id"].(string)])
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	const team = "team@group.calendar.google.com"
+	shared := func(id string) *calendar.Event {
+		event := timedEvent(id, "Planning", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z")
+		event.ICalUID = "planning@google.com"
+		return event
+	}
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar(team, "Team"))
+	srv.addEvents("me@example.com", shared("mine"), timedEvent("solo", "Focus", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"))
+	srv.addEvents(team, shared("teams"))
+
+	tests := []struct {
+		dedupe        string
+		want          []string
+		wantCalendars []string
+	}{
+		{"false", []string{"mine", "solo", "teams"}, nil},
+		{"true", []string{"mine", "solo"}, []string{"me@example.com", "Team"}},
+	}
+	for _, tt := range tests {
+		t.Run("dedupe="+tt.dedupe, func(t *testing.T) {
+			events := listCalendar(t, newTestAPI(srv), "/calendar?dedupe="+tt.dedupe+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("listed %v, want %v", got, tt.want)
+			}
+			if got := events[0].Calendars; !reflect.DeepEqual(got, tt.wantCalendars) {
+				t.Errorf("calendars of the shared event = %v, want %v", got, tt.wantCalendars)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// maxFreeBusyCalendars is the most calendars the FreeBusy API accepts in
+// one query.
+const maxFreeBusyCalendars = 50
+
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type FreeBusyResponse struct {
+	TimeMin time.Time         `json:"timeMin"`
+	TimeMax time.Time         `json:"timeMax"`
+	Busy    []Interval        `json:"busy"`
+	Free    []Interval        `json:"free"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// mergeIntervals sorts intervals and joins any that overlap or touch.
+func mergeIntervals(intervals []Interval) []Interval {
+	sorted := make([]Interval, len(intervals))
+	copy(sorted, intervals)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	merged := make([]Interval, 0, len(sorted))
+	for _, iv := range sorted {
+		if n := len(merged); n > 0 && !iv.Start.After(merged[n-1].End) {
+			if iv.End.After(merged[n-1].End) {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// freeIntervals returns the gaps between merged busy intervals within
+// [start, end).
+func freeIntervals(busy []Interval, start, end time.Time) []Interval {
+	free := make([]Interval, 0)
+	cursor := start
+	for _, b := range busy {
+		if !b.End.After(cursor) {
+			continue
+		}
+		if !b.Start.Before(end) {
+			break
+		}
+		if b.Start.After(cursor) {
+			free = append(free, Interval{Start: cursor, End: b.Start})
+		}
+		cursor = b.End
+	}
+	if cursor.Before(end) {
+		free = append(free, Interval{Start: cursor, End: end})
+	}
+	return free
+}
+
+// parseEmails reads a comma-separated list of calendar addresses from the
+// named parameter.
+func parseEmails(v, name string) ([]string, error) {
+	emails := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, email := range strings.Split(v, ",") {
+		email = strings.TrimSpace(email)
+		if email == "" || seen[email] {
+			continue
+		}
+		if !validCalendarID(email) {
+			return nil, fmt.Errorf("invalid %s entry %q", name, email)
+		}
+		if !calendarAllowed(email) {
+			return nil, fmt.Errorf("%w: %s", errCalendarForbidden, email)
+		}
+		seen[email] = true
+		emails = append(emails, email)
+	}
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("%s is required", name)
+	}
+	if len(emails) > maxFreeBusyCalendars {
+		return nil, fmt.Errorf("%s lists %d calendars; the limit is %d", name, len(emails), maxFreeBusyCalendars)
+	}
+	return emails, nil
+}
+
+// queryBusy asks the FreeBusy API for the busy periods of each calendar,
+// returning them by calendar along with any per-calendar error reasons.
+func queryBusy(ctx context.Context, srv CalendarService, emails []string, timeMin, timeMax time.Time) (map[string][]Interval, map[string]string, error) {
+	req := &calendar.FreeBusyRequest{
+		TimeMin: timeMin.Format(time.RFC3339),
+		TimeMax: timeMax.Format(time.RFC3339),
+	}
+	for _, email := range emails {
+		req.Items = append(req.Items, &calendar.FreeBusyRequestItem{Id: email})
+	}
+
+	var resp *calendar.FreeBusyResponse
+	err := breaker.Do(func() (err error) {
+		resp, err = srv.QueryFreeBusy(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to query free/busy: %w", err)
+	}
+
+	busy := make(map[string][]Interval)
+	errs := make(map[string]string)
+	for id, cal := range resp.Calendars {
+		if len(cal.Errors) > 0 {
+			errs[id] = cal.Errors[0].Reason
+			continue
+		}
+		for _, period := range cal.Busy {
+			start, err := time.Parse(time.RFC3339, period.Start)
+			if err != nil {
+				continue
+			}
+			end, err := time.Parse(time.RFC3339, period.End)
+			if err != nil {
+				continue
+			}
+			busy[id] = append(busy[id], Interval{Start: start, End: end})
+		}
+	}
+	return busy, errs, nil
+}
+
+// FreeBusyHandler returns the merged busy blocks of the calendars listed in
+// emails over the window, and the free slots between them.
+func (a *API) FreeBusyHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	loc, err := parseLocation(values)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeMin, timeMax, err := parseWindow(values, loc)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	emails, err := parseEmails(values.Get("emails"), "emails")
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errCalendarForbidden) {
+			status = http.StatusForbidden
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	resp, err := freeBusy(ctx, srv, emails, timeMin, timeMax, loc)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Errorf("Error encoding free/busy response %v", err)
+	}
+}
+
+// freeBusy reports when the calendars are busy, merged into one timeline,
+// and the gaps between, with times in loc.
+func freeBusy(ctx context.Context, srv CalendarService, emails []string, timeMin, timeMax time.Time, loc *time.Location) (FreeBusyResponse, error) {
+	byCalendar, errs, err := queryBusy(ctx, srv, emails, timeMin, timeMax)
+	if err != nil {
+		return FreeBusyResponse{}, err
+	}
+	all := make([]Interval, 0)
+	for _, intervals := range byCalendar {
+		all = append(all, intervals...)
+	}
+	busy := mergeIntervals(all)
+	for i := range busy {
+		busy[i].Start, busy[i].End = busy[i].Start.In(loc), busy[i].End.In(loc)
+	}
+
+	resp := FreeBusyResponse{
+		TimeMin: timeMin.In(loc),
+		TimeMax: timeMax.In(loc),
+		Busy:    busy,
+		Free:    freeIntervals(busy, timeMin.In(loc), timeMax.In(loc)),
+	}
+	if len(errs) > 0 {
+		resp.Errors = errs
+	}
+	return resp, nil
+}
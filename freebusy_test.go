@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// interval parses an Interval from two RFC3339 times.
+func interval(t *testing.T, start, end string) Interval {
+	t.Helper()
+	s, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Interval{Start: s, End: e}
+}
+
+func TestMergeIntervals(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []Interval
+		want []Interval
+	}{
+		{"empty", nil, []Interval{}},
+		{"disjoint out of order", []Interval{
+			interval(t, "2024-03-04T13:00:00Z", "2024-03-04T14:00:00Z"),
+			interval(t, "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+		}, []Interval{
+			interval(t, "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+			interval(t, "2024-03-04T13:00:00Z", "2024-03-04T14:00:00Z"),
+		}},
+		{"overlapping and touching", []Interval{
+			interval(t, "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+			interval(t, "2024-03-04T09:30:00Z", "2024-03-04T11:00:00Z"),
+			interval(t, "2024-03-04T11:00:00Z", "2024-03-04T11:30:00Z"),
+		}, []Interval{interval(t, "2024-03-04T09:00:00Z", "2024-03-04T11:30:00Z")}},
+		{"contained", []Interval{
+			interval(t, "2024-03-04T09:00:00Z", "2024-03-04T12:00:00Z"),
+			interval(t, "2024-03-04T10:00:00Z", "2024-03-04T11:00:00Z"),
+		}, []Interval{interval(t, "2024-03-04T09:00:00Z", "2024-03-04T12:00:00Z")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeIntervals(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeIntervals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeIntervals(t *testing.T) {
+	day := interval(t, "2024-03-04T09:00:00Z", "2024-03-04T17:00:00Z")
+	tests := []struct {
+		name string
+		busy []Interval
+		want []Interval
+	}{
+		{"all free", nil, []Interval{day}},
+		{"gaps around meetings", []Interval{
+			interval(t, "2024-03-04T10:00:00Z", "2024-03-04T11:00:00Z"),
+			interval(t, "2024-03-04T13:00:00Z", "2024-03-04T14:00:00Z"),
+		}, []Interval{
+			interval(t, "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+			interval(t, "2024-03-04T11:00:00Z", "2024-03-04T13:00:00Z"),
+			interval(t, "2024-03-04T14:00:00Z", "2024-03-04T17:00:00Z"),
+		}},
+		{"busy across the edges", []Interval{
+			interval(t, "2024-03-04T08:00:00Z", "2024-03-04T09:30:00Z"),
+			interval(t, "2024-03-04T16:00:00Z", "2024-03-04T18:00:00Z"),
+		}, []Interval{interval(t, "2024-03-04T09:30:00Z", "2024-03-04T16:00:00Z")}},
+		{"outside the range", []Interval{
+			interval(t, "2024-03-04T07:00:00Z", "2024-03-04T08:00:00Z"),
+			interval(t, "2024-03-04T18:00:00Z", "2024-03-04T19:00:00Z"),
+		}, []Interval{day}},
+		{"fully busy", []Interval{interval(t, "2024-03-04T08:00:00Z", "2024-03-04T18:00:00Z")}, []Interval{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := freeIntervals(tt.busy, day.Start, day.End); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("freeIntervals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
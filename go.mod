@@ -5,11 +5,17 @@ go 1.16
 require (
 	cloud.google.com/go v0.82.0 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
-	golang.org/x/net v0.0.0-20210525063256-abc453219eb5 // indirect
-	golang.org/x/oauth2 v0.0.0-20210514164344-f6687ab2804c // indirect
-	golang.org/x/sys v0.0.0-20210525143221-35b2ab0089ea // indirect
-	google.golang.org/api v0.47.0 // indirect
+	github.com/gorilla/mux v1.8.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/prometheus/client_golang v1.11.0
+	github.com/xuri/excelize/v2 v2.4.1
+	go.uber.org/zap v1.17.0
+	golang.org/x/oauth2 v0.0.0-20210514164344-f6687ab2804c
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	google.golang.org/api v0.47.0
 	google.golang.org/genproto v0.0.0-20210524171403-669157292da3 // indirect
-	google.golang.org/grpc v1.38.0 // indirect
+	google.golang.org/grpc v1.38.0
+	google.golang.org/protobuf v1.26.0
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,379 @@
+package main
+
+//go:generate protoc -I proto --go_out=calendarpb --go_opt=paths=source_relative --go-grpc_out=calendarpb --go-grpc_opt=paths=source_relative calendar.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"caltracker/main/calendarpb"
+)
+
+// grpcAddr is the address the gRPC API listens on, set by the -grpc-addr
+// flag. Empty leaves it off.
+var grpcAddr string
+
+// grpcCalendarServer serves CalendarService over the same functions the
+// REST handlers use, translating only requests, responses and errors.
+type grpcCalendarServer struct {
+	calendarpb.UnimplementedCalendarServiceServer
+	api *API
+}
+
+// queryValues turns an EventQuery into the REST query parameters, so it is
+// parsed and validated exactly as they are.
+func queryValues(pb *calendarpb.EventQuery) url.Values {
+	values := url.Values{}
+	set := func(name, v string) {
+		if v != "" {
+			values.Set(name, v)
+		}
+	}
+	set("from", pb.GetFrom())
+	set("to", pb.GetTo())
+	set("window", pb.GetWindow())
+	set("tz", pb.GetTz())
+	set("calendars", strings.Join(pb.GetCalendars(), ","))
+	set("q", pb.GetQ())
+	set("attendee", pb.GetAttendee())
+	set("organizer", pb.GetOrganizer())
+	if pb.GetFullDetail() {
+		values.Set("detail", "full")
+	}
+	if pb.GetDedupe() {
+		values.Set("dedupe", "true")
+	}
+	return values
+}
+
+func toPBAttendee(a SummaryAttendee) *calendarpb.Attendee {
+	return &calendarpb.Attendee{
+		Email:          a.Email,
+		DisplayName:    a.DisplayName,
+		ResponseStatus: a.ResponseStatus,
+		Optional:       a.Optional,
+		Organizer:      a.Organizer,
+	}
+}
+
+func toPBEvent(e SummaryEvent) *calendarpb.Event {
+	pb := &calendarpb.Event{
+		Id:               e.ID,
+		Calendar:         e.Calendar,
+		Summary:          e.Summary,
+		Start:            e.Start,
+		End:              e.End,
+		TimeZone:         e.TimeZone,
+		DurationMinutes:  e.EventTime,
+		AllDay:           e.AllDay,
+		Recurring:        e.RecurringEvent,
+		RecurringEventId: e.RecurringID,
+		AttendeeCount:    int32(e.AttendeeCount),
+		MeetingLink:      e.MeetingLink,
+		Location:         e.Location,
+		Visibility:       e.Visibility,
+		Calendars:        e.Calendars,
+	}
+	for _, a := range e.Attendees {
+		pb.Attendees = append(pb.Attendees, toPBAttendee(a))
+	}
+	if e.Organizer != nil {
+		pb.Organizer = toPBAttendee(*e.Organizer)
+	}
+	return pb
+}
+
+func toPBIntervals(intervals []Interval) []*calendarpb.Interval {
+	pb := make([]*calendarpb.Interval, 0, len(intervals))
+	for _, iv := range intervals {
+		pb = append(pb, &calendarpb.Interval{Start: iv.Start.Format(time.RFC3339), End: iv.End.Format(time.RFC3339)})
+	}
+	return pb
+}
+
+// grpcStatusCodes maps the Google API statuses passed on to REST clients to
+// their gRPC equivalents; anything else is Unavailable.
+var grpcStatusCodes = map[int]codes.Code{
+	http.StatusBadRequest:         codes.InvalidArgument,
+	http.StatusUnauthorized:       codes.Unauthenticated,
+	http.StatusForbidden:          codes.PermissionDenied,
+	http.StatusNotFound:           codes.NotFound,
+	http.StatusGone:               codes.NotFound,
+	http.StatusPreconditionFailed: codes.FailedPrecondition,
+	http.StatusTooManyRequests:    codes.ResourceExhausted,
+}
+
+// grpcServiceError is writeServiceError for gRPC.
+func grpcServiceError(err error) error {
+	if errors.Is(err, errNotAuthorized) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	logger.Error(err)
+	return status.Error(codes.Internal, "unable to create calendar client")
+}
+
+// grpcUpstreamError is writeUpstreamError for gRPC.
+func grpcUpstreamError(err error) error {
+	switch {
+	case errors.Is(err, errBreakerOpen):
+		return status.Error(codes.Unavailable, errBreakerOpen.Error())
+	case errors.Is(err, errNotAuthorized):
+		return status.Error(codes.Unauthenticated, errNotAuthorized.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.Error(codes.DeadlineExceeded, "timed out waiting for Google Calendar")
+	case errors.Is(err, errCalendarNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errCalendarForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	logger.Error(err)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if code, ok := grpcStatusCodes[apiErr.Code]; ok {
+			return status.Error(code, "Google Calendar rejected the request: "+apiErr.Message)
+		}
+	}
+	return status.Error(codes.Unavailable, "unable to retrieve calendar data")
+}
+
+// calendarService is API.calendarService bounded by the upstream timeout.
+func (s *grpcCalendarServer) calendarService(ctx context.Context) (context.Context, context.CancelFunc, CalendarService, error) {
+	ctx, cancel := withUpstreamTimeout(ctx)
+	srv, err := s.api.calendarService(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, grpcServiceError(err)
+	}
+	return ctx, cancel, srv, nil
+}
+
+func (s *grpcCalendarServer) ListEvents(ctx context.Context, req *calendarpb.ListEventsRequest) (*calendarpb.ListEventsResponse, error) {
+	q, err := parseEventValues(queryValues(req.GetQuery()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx, cancel, srv, err := s.calendarService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	events, err := s.api.listEvents(ctx, srv, q)
+	if err != nil {
+		return nil, grpcUpstreamError(err)
+	}
+	summaries, err := summarizeEvents(ctx, srv, events, q)
+	if err != nil {
+		logger.Error(err)
+		return nil, status.Error(codes.Internal, "unable to summarize events")
+	}
+	resp := &calendarpb.ListEventsResponse{Events: make([]*calendarpb.Event, 0, len(summaries))}
+	for _, e := range summaries {
+		resp.Events = append(resp.Events, toPBEvent(e))
+	}
+	return resp, nil
+}
+
+func (s *grpcCalendarServer) GetStats(ctx context.Context, req *calendarpb.GetStatsRequest) (*calendarpb.GetStatsResponse, error) {
+	groupBy, err := parseGroupBy(req.GetGroupBy())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	q, err := parseEventValues(queryValues(req.GetQuery()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx, cancel, srv, err := s.calendarService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	events, err := s.api.listEvents(ctx, srv, q)
+	if err != nil {
+		return nil, grpcUpstreamError(err)
+	}
+	stats, err := computeStats(events, q, groupBy, req.GetNormalizeTitles())
+	if err != nil {
+		logger.Error(err)
+		return nil, status.Error(codes.Internal, "unable to compute stats")
+	}
+
+	resp := &calendarpb.GetStatsResponse{
+		GroupBy: stats.GroupBy,
+		Overview: &calendarpb.StatsOverview{
+			TotalHours:       stats.Overview.TotalHours,
+			Count:            int32(stats.Overview.Count),
+			AverageMinutes:   stats.Overview.AverageMinutes,
+			RecurringPercent: stats.Overview.RecurringPercent,
+		},
+	}
+	if d := stats.Overview.BusiestDay; d != nil {
+		resp.Overview.BusiestDay = &calendarpb.BusiestDay{Date: d.Date, TotalMinutes: d.TotalMinutes}
+	}
+	for _, g := range stats.Groups {
+		resp.Groups = append(resp.Groups, &calendarpb.StatsGroup{Key: g.Key, TotalMinutes: g.TotalMinutes, Count: int32(g.Count)})
+	}
+	return resp, nil
+}
+
+func (s *grpcCalendarServer) CreateEvent(ctx context.Context, req *calendarpb.CreateEventRequest) (*calendarpb.CreateEventResponse, error) {
+	calendarID, event, err := buildInsertEvent(InsertEventRequest{
+		CalendarID:  req.GetCalendarId(),
+		Summary:     req.GetSummary(),
+		Description: req.GetDescription(),
+		Start:       req.GetStart(),
+		End:         req.GetEnd(),
+		Attendees:   req.GetAttendees(),
+		Recurrence:  req.GetRecurrence(),
+	})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx, cancel, srv, err := s.calendarService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	created, err := s.api.createEvent(ctx, srv, calendarID, event)
+	if err != nil {
+		return nil, grpcUpstreamError(err)
+	}
+	return &calendarpb.CreateEventResponse{Id: created.Id, HtmlLink: created.HtmlLink}, nil
+}
+
+func (s *grpcCalendarServer) FreeBusy(ctx context.Context, req *calendarpb.FreeBusyRequest) (*calendarpb.FreeBusyResponse, error) {
+	values := url.Values{}
+	for name, v := range map[string]string{"from": req.GetFrom(), "to": req.GetTo(), "window": req.GetWindow(), "tz": req.GetTz()} {
+		if v != "" {
+			values.Set(name, v)
+		}
+	}
+	loc, err := parseLocation(values)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	timeMin, timeMax, err := parseWindow(values, loc)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	emails, err := parseEmails(strings.Join(req.GetEmails(), ","), "emails")
+	if err != nil {
+		if errors.Is(err, errCalendarForbidden) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx, cancel, srv, err := s.calendarService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	fb, err := freeBusy(ctx, srv, emails, timeMin, timeMax, loc)
+	if err != nil {
+		return nil, grpcUpstreamError(err)
+	}
+	return &calendarpb.FreeBusyResponse{
+		TimeMin: fb.TimeMin.Format(time.RFC3339),
+		TimeMax: fb.TimeMax.Format(time.RFC3339),
+		Busy:    toPBIntervals(fb.Busy),
+		Free:    toPBIntervals(fb.Free),
+		Errors:  fb.Errors,
+	}, nil
+}
+
+// grpcInterceptor gives each call a request ID, authenticates and rate
+// limits it as the HTTP middleware does, from the x-api-key and
+// authorization metadata, and logs it.
+func grpcInterceptor(a Authenticator, limiter *rateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		md, _ := metadata.FromIncomingContext(ctx)
+		id := ""
+		if ids := md.Get(strings.ToLower(requestIDHeader)); len(ids) > 0 && validRequestID.MatchString(ids[0]) {
+			id = ids[0]
+		} else if id, _ = randomToken(); id == "" {
+			id = fmt.Sprintf("%d", time.Now().UnixNano())
+		}
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+
+		resp, err := func() (interface{}, error) {
+			if a == nil {
+				return handler(ctx, req)
+			}
+			// Authenticators read HTTP headers, so hand them the metadata
+			// as headers.
+			r := &http.Request{Header: http.Header{}}
+			for _, name := range []string{"X-API-Key", "Authorization"} {
+				for _, v := range md.Get(name) {
+					r.Header.Add(name, v)
+				}
+			}
+			p, err := a.Authenticate(r)
+			if err != nil {
+				logger.Warnf("Rejected gRPC call to %s: %v", info.FullMethod, err)
+				return nil, status.Error(codes.Unauthenticated, errUnauthenticated.Error())
+			}
+			if limiter != nil {
+				if ok, _ := limiter.Allow(p.Method + ":" + p.Subject); !ok {
+					logger.Warnf("Rate limited %s %q on %s", p.Method, p.Subject, info.FullMethod)
+					return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+				}
+			}
+			return handler(withPrincipal(ctx, p), req)
+		}()
+
+		loggerFor(ctx).Infow("grpc request",
+			"method", info.FullMethod,
+			"code", status.Code(err).String(),
+			"duration", time.Since(start),
+		)
+		return resp, err
+	}
+}
+
+// serveGRPC starts the gRPC API for api on grpcAddr, stopped gracefully at
+// shutdown. It uses the HTTP server's TLS settings when TLS is on.
+func serveGRPC(api *API, a Authenticator, limiter *rateLimiter, opts ...grpc.ServerOption) error {
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		return fmt.Errorf("unable to listen for gRPC on %s: %w", grpcAddr, err)
+	}
+	s := grpc.NewServer(append(opts, grpc.UnaryInterceptor(grpcInterceptor(a, limiter)))...)
+	calendarpb.RegisterCalendarServiceServer(s, &grpcCalendarServer{api: api})
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			logger.Error(err)
+		}
+	}()
+	lifecycle.OnShutdown("stop gRPC server", func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.Stop()
+		}
+		return nil
+	})
+	logger.Infof("Serving gRPC on %s", grpcAddr)
+	return nil
+}
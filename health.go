@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessAPICheckTTL is how long the outcome of the Calendar API readiness
+// check is reused, so frequent probes don't spend API quota.
+const readinessAPICheckTTL = 30 * time.Second
+
+const (
+	checkOK      = "ok"
+	checkFailed  = "failed"
+	checkSkipped = "skipped"
+)
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func checkResult(err error) CheckResult {
+	if err != nil {
+		return CheckResult{Status: checkFailed, Error: err.Error()}
+	}
+	return CheckResult{Status: checkOK}
+}
+
+// HealthHandler reports liveness along with the Google API circuit breaker state.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "ok",
+		"breaker": breaker.State().String(),
+	})
+}
+
+// sharedAccount reports whether the service acts as one Google account for
+// every caller. With API authentication on, OAuth callers each authorize
+// their own account, so there's no token or account to check at startup.
+func sharedAccount() bool {
+	return !authEnabled || credentialMode == credentialServiceAccount
+}
+
+// checkCredentials verifies the credentials file parses.
+func checkCredentials() CheckResult {
+	if credentialMode == credentialServiceAccount {
+		_, err := serviceAccountClient()
+		return checkResult(err)
+	}
+	_, err := loadOAuthConfig()
+	return checkResult(err)
+}
+
+// checkToken verifies the shared account's token is stored, has the scopes
+// the service needs, and is either unexpired or can be refreshed.
+func checkToken() CheckResult {
+	if credentialMode == credentialServiceAccount || !sharedAccount() {
+		return CheckResult{Status: checkSkipped}
+	}
+	tok, err := tokenStore.Get("")
+	if err != nil {
+		return checkResult(err)
+	}
+	if config, err := loadOAuthConfig(); err == nil {
+		if err := checkTokenScopes(config, tok); err != nil {
+			return checkResult(err)
+		}
+	}
+	if !tok.Valid() && tok.RefreshToken == "" {
+		return checkResult(errors.New("stored token has expired and has no refresh token"))
+	}
+	return CheckResult{Status: checkOK}
+}
+
+// apiCheck remembers the last Calendar API readiness check.
+var apiCheck struct {
+	mu     sync.Mutex
+	at     time.Time
+	result CheckResult
+}
+
+// checkCalendarAPI makes the cheapest authenticated call there is, listing
+// a single calendar, reusing a recent result.
+func (a *API) checkCalendarAPI(ctx context.Context) CheckResult {
+	if !sharedAccount() {
+		return CheckResult{Status: checkSkipped}
+	}
+	apiCheck.mu.Lock()
+	defer apiCheck.mu.Unlock()
+	if !apiCheck.at.IsZero() && time.Since(apiCheck.at) < readinessAPICheckTTL {
+		return apiCheck.result
+	}
+
+	ctx, cancel := withUpstreamTimeout(ctx)
+	defer cancel()
+	srv, err := a.services.Get(ctx, "")
+	if err == nil {
+		err = breaker.Do(func() error {
+			_, err := srv.ListCalendars(ctx, "", "", 1)
+			return err
+		})
+	}
+	apiCheck.at, apiCheck.result = time.Now(), checkResult(err)
+	return apiCheck.result
+}
+
+// ReadinessHandler reports whether the service can serve calendar data,
+// checking the credentials file, the stored token and a Calendar API call,
+// with each check's outcome. Any failed check makes it 503.
+func (a *API) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResponse{Status: "ready", Checks: map[string]CheckResult{
+		"credentials": checkCredentials(),
+		"token":       checkToken(),
+	}}
+	if resp.Checks["credentials"].Status == checkFailed || resp.Checks["token"].Status == checkFailed {
+		resp.Checks["calendarApi"] = CheckResult{Status: checkSkipped}
+	} else {
+		resp.Checks["calendarApi"] = a.checkCalendarAPI(r.Context())
+	}
+
+	status := http.StatusOK
+	for _, c := range resp.Checks {
+		if c.Status == checkFailed {
+			resp.Status, status = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Errorf("Error encoding readiness %v", err)
+	}
+}
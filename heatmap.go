@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const dateLayout = "2006-01-02"
+
+// Heatmap maps every date in the window to its event count and minutes.
+// Dates without events are present with zero values.
+type Heatmap struct {
+	Counts  map[string]int     `json:"counts"`
+	Minutes map[string]float64 `json:"minutes"`
+}
+
+// eventDate returns the date an event starts on in loc. All-day events keep
+// their calendar date regardless of loc.
+func eventDate(event *calendar.Event, loc *time.Location) (string, error) {
+	if isAllDay(event) {
+		return event.Start.Date, nil
+	}
+	start, err := time.Parse(time.RFC3339, event.Start.DateTime)
+	if err != nil {
+		return "", err
+	}
+	return start.In(loc).Format(dateLayout), nil
+}
+
+// buildHeatmap buckets events per start date across the whole query window.
+func buildHeatmap(events []calendarEvent, q eventQuery) (Heatmap, error) {
+	h := Heatmap{Counts: make(map[string]int), Minutes: make(map[string]float64)}
+
+	y, m, d := q.TimeMin.In(q.Location).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, q.Location); day.Before(q.TimeMax); day = day.AddDate(0, 0, 1) {
+		h.Counts[day.Format(dateLayout)] = 0
+		h.Minutes[day.Format(dateLayout)] = 0
+	}
+
+	for _, ce := range events {
+		if isTask(ce.Event) {
+			continue
+		}
+		date, err := eventDate(ce.Event, q.Location)
+		if err != nil {
+			return h, fmt.Errorf("error parsing time from event %s: %w", ce.Event.Id, err)
+		}
+		if _, ok := h.Counts[date]; !ok {
+			continue
+		}
+		start, end, err := eventTimes(ce.Event)
+		if err != nil {
+			return h, fmt.Errorf("error parsing time from event %s: %w", ce.Event.Id, err)
+		}
+		h.Counts[date]++
+		h.Minutes[date] += end.Sub(start).Minutes()
+	}
+	return h, nil
+}
+
+// HeatmapHandler returns per-date event counts and minutes for the window,
+// with every date in range present.
+func (a *API) HeatmapHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	h, err := buildHeatmap(events, q)
+	if err != nil {
+		logger.Error(err)
+		writeError(w, "unable to compute heatmap", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		logger.Errorf("Error encoding heatmap response %v", err)
+	}
+}
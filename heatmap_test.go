@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestBuildHeatmap(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	events := statsFixtures(cal,
+		timedEvent("a", "A", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"),
+		timedEvent("b", "B", "2024-03-05T14:00:00Z", "2024-03-05T14:30:00Z"),
+		allDayEvent("c", "C", "2024-03-08", "2024-03-09"),
+		// Before the window.
+		timedEvent("d", "D", "2024-02-28T09:00:00Z", "2024-02-28T10:00:00Z"),
+	)
+	q := eventQuery{
+		TimeMin:  time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		TimeMax:  time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		Location: time.UTC,
+	}
+
+	h, err := buildHeatmap(events, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCounts := map[string]int{
+		"2024-03-04": 0, "2024-03-05": 2, "2024-03-06": 0, "2024-03-07": 0,
+		"2024-03-08": 1, "2024-03-09": 0, "2024-03-10": 0,
+	}
+	wantMinutes := map[string]float64{
+		"2024-03-04": 0, "2024-03-05": 90, "2024-03-06": 0, "2024-03-07": 0,
+		"2024-03-08": 24 * 60, "2024-03-09": 0, "2024-03-10": 0,
+	}
+	if !reflect.DeepEqual(h.Counts, wantCounts) {
+		t.Errorf("counts = %v, want %v", h.Counts, wantCounts)
+	}
+	if !reflect.DeepEqual(h.Minutes, wantMinutes) {
+		t.Errorf("minutes = %v, want %v", h.Minutes, wantMinutes)
+	}
+}
+
+func TestEventDate(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	late := timedEvent("a", "", "2024-03-04T20:00:00Z", "2024-03-04T21:00:00Z")
+	allDay := allDayEvent("b", "", "2024-03-04", "2024-03-05")
+	tests := []struct {
+		name  string
+		event *calendar.Event
+		loc   *time.Location
+		want  string
+	}{
+		{"timed in UTC", late, time.UTC, "2024-03-04"},
+		{"timed in Tokyo", late, tokyo, "2024-03-05"},
+		{"all-day in Tokyo", allDay, tokyo, "2024-03-04"},
+	}
+	for _, tt := range tests {
+		got, err := eventDate(tt.event, tt.loc)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: eventDate() = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+)
+
+// ErrorResponse is the JSON body of every error response. Code repeats the
+// HTTP status; Details carries the underlying cause where it is safe to show,
+// such as Google's own error message. Fields lists the invalid parameters
+// of a request rejected by validateRequests.
+type ErrorResponse struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Details string       `json:"details,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// writeError writes msg as a JSON error body with the given status code.
+func writeError(w http.ResponseWriter, msg string, code int) {
+	writeErrorDetails(w, msg, "", code)
+}
+
+// writeErrorDetails writes msg and details as a JSON error body with the
+// given status code.
+func writeErrorDetails(w http.ResponseWriter, msg, details string, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Code: code, Message: msg, Details: details}); err != nil {
+		logger.Errorf("Error encoding error response %v", err)
+	}
+}
+
+// writeFieldErrors rejects a request with 400, listing its invalid fields.
+func writeFieldErrors(w http.ResponseWriter, fields []FieldError) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	resp := ErrorResponse{Code: http.StatusBadRequest, Message: "invalid request parameters", Fields: fields}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Errorf("Error encoding error response %v", err)
+	}
+}
+
+// writeServiceError reports a failure to set up the Calendar API client,
+// such as missing or invalid credentials.
+func writeServiceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNotAuthorized) {
+		writeError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	logger.Error(err)
+	writeError(w, "unable to create calendar client", http.StatusInternalServerError)
+}
+
+// googleStatuses maps the Google API statuses worth passing on to clients;
+// any other failure is reported as 502.
+var googleStatuses = map[int]int{
+	http.StatusBadRequest:         http.StatusBadRequest,
+	http.StatusUnauthorized:       http.StatusUnauthorized,
+	http.StatusForbidden:          http.StatusForbidden,
+	http.StatusNotFound:           http.StatusNotFound,
+	http.StatusGone:               http.StatusNotFound,
+	http.StatusPreconditionFailed: http.StatusPreconditionFailed,
+	http.StatusTooManyRequests:    http.StatusTooManyRequests,
+}
+
+// writeUpstreamError reports a failed Google API call, failing fast with 503
+// while the circuit breaker is open and with 504 when the request times out.
+// Google's client errors keep their status, with Google's message as details.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBreakerOpen) {
+		writeError(w, errBreakerOpen.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, errNotAuthorized) {
+		logger.Error(err)
+		writeError(w, errNotAuthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		logger.Error(err)
+		writeError(w, "timed out waiting for Google Calendar", http.StatusGatewayTimeout)
+		return
+	}
+	if errors.Is(err, errCalendarNotFound) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errCalendarForbidden) {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	logger.Error(err)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if code, ok := googleStatuses[apiErr.Code]; ok {
+			writeErrorDetails(w, "Google Calendar rejected the request", apiErr.Message, code)
+			return
+		}
+	}
+	writeError(w, "unable to retrieve calendar data", http.StatusBadGateway)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestCalendarHandlerErrors(t *testing.T) {
+	saved := credentialsFile
+	credentialsFile = filepath.Join(t.TempDir(), "missing.json")
+	defer func() { credentialsFile = saved }()
+
+	upstream := newFakeService(primaryCalendar("me@example.com"))
+	upstream.err = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+	rejected := newFakeService(primaryCalendar("me@example.com"))
+	rejected.err = &googleapi.Error{Code: http.StatusTooManyRequests, Message: "rate limit exceeded"}
+
+	tests := []struct {
+		name     string
+		api      *API
+		wantCode int
+	}{
+		{"bad credentials path", newAPI(newServiceCache()), http.StatusInternalServerError},
+		{"Google failure", newTestAPI(upstream), http.StatusBadGateway},
+		{"Google client error", newTestAPI(rejected), http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.api.CalendarHandler, "/calendar")
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d; body %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode || body.Message == "" {
+				t.Errorf("error body %s, want a JSON error with code %d", rec.Body, tt.wantCode)
+			}
+		})
+	}
+
+	// The process is still up and serves the next request.
+	healthy := newFakeService(primaryCalendar("me@example.com"))
+	healthy.addEvents("me@example.com", timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"))
+	if events := listCalendar(t, newTestAPI(healthy), "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"); len(events) != 1 {
+		t.Errorf("listed %d events after the failures, want 1", len(events))
+	}
+}
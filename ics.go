@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	icsDateTime = "20060102T150405"
+	icsDate     = "20060102"
+)
+
+// icsEscaper escapes TEXT property values per RFC 5545 section 3.3.11.
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// eventLocation returns the time zone an event is expressed in: its own
+// start time zone, else its calendar's, else UTC.
+func eventLocation(ce calendarEvent) *time.Location {
+	for _, name := range []string{ce.Event.Start.TimeZone, ce.Calendar.TimeZone} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// renderICS renders events as an RFC 5545 calendar. Timed events in a named
+// zone reference a VTIMEZONE by TZID; UTC events use the "Z" suffix.
+// Summaries are truncated to the query's MaxSummaryLen like other formats.
+func renderICS(events []calendarEvent, q eventQuery) string {
+	var body strings.Builder
+	zones := make(map[string]*time.Location)
+	var first, last time.Time
+	stamp := now().UTC().Format(icsDateTime) + "Z"
+
+	for _, ce := range events {
+		if isTask(ce.Event) {
+			continue
+		}
+		start, end, err := eventTimes(ce.Event)
+		if err != nil {
+			continue
+		}
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if end.After(last) {
+			last = end
+		}
+
+		uid := ce.Event.ICalUID
+		if uid == "" {
+			uid = ce.Event.Id
+		}
+		writeICSLine(&body, "BEGIN:VEVENT")
+		writeICSLine(&body, "UID:"+uid)
+		writeICSLine(&body, "DTSTAMP:"+stamp)
+		if isAllDay(ce.Event) {
+			writeICSLine(&body, "DTSTART;VALUE=DATE:"+start.Format(icsDate))
+			writeICSLine(&body, "DTEND;VALUE=DATE:"+end.Format(icsDate))
+		} else {
+			loc := eventLocation(ce)
+			if loc == time.UTC {
+				writeICSLine(&body, "DTSTART:"+start.UTC().Format(icsDateTime)+"Z")
+				writeICSLine(&body, "DTEND:"+end.UTC().Format(icsDateTime)+"Z")
+			} else {
+				zones[loc.String()] = loc
+				writeICSLine(&body, "DTSTART;TZID="+loc.String()+":"+start.In(loc).Format(icsDateTime))
+				writeICSLine(&body, "DTEND;TZID="+loc.String()+":"+end.In(loc).Format(icsDateTime))
+			}
+		}
+		// Google keeps recurrence as RFC 5545 RRULE, EXDATE and RDATE lines.
+		for _, rule := range ce.Event.Recurrence {
+			writeICSLine(&body, rule)
+		}
+		if ce.Event.RecurringEventId != "" && ce.Event.OriginalStartTime != nil {
+			if line, ok := recurrenceID(ce); ok {
+				writeICSLine(&body, line)
+			}
+		}
+		writeICSLine(&body, "SUMMARY:"+icsEscaper.Replace(truncateSummary(ce.Event.Summary, q.MaxSummaryLen)))
+		if ce.Event.Description != "" {
+			writeICSLine(&body, "DESCRIPTION:"+icsEscaper.Replace(ce.Event.Description))
+		}
+		if ce.Event.Location != "" {
+			writeICSLine(&body, "LOCATION:"+icsEscaper.Replace(ce.Event.Location))
+		}
+		writeICSLine(&body, "END:VEVENT")
+	}
+
+	var b strings.Builder
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//caltracker//Calendar Export//EN")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeVTimezone(&b, zones[name], first.AddDate(-1, 0, 0), last.AddDate(1, 0, 0))
+	}
+
+	b.WriteString(body.String())
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// recurrenceID returns the RECURRENCE-ID line tying an instance of a
+// recurring event to its place in the series, which shares its UID.
+func recurrenceID(ce calendarEvent) (string, bool) {
+	orig := ce.Event.OriginalStartTime
+	if orig.Date != "" {
+		d, err := time.Parse("2006-01-02", orig.Date)
+		if err != nil {
+			return "", false
+		}
+		return "RECURRENCE-ID;VALUE=DATE:" + d.Format(icsDate), true
+	}
+	t, err := time.Parse(time.RFC3339, orig.DateTime)
+	if err != nil {
+		return "", false
+	}
+	if loc := eventLocation(ce); loc != time.UTC {
+		return "RECURRENCE-ID;TZID=" + loc.String() + ":" + t.In(loc).Format(icsDateTime), true
+	}
+	return "RECURRENCE-ID:" + t.UTC().Format(icsDateTime) + "Z", true
+}
+
+// writeVTimezone writes a VTIMEZONE for loc covering the offset transitions
+// between from and to. Each transition gets its own STANDARD or DAYLIGHT
+// component; zones without transitions get a single fixed STANDARD one.
+func writeVTimezone(b *strings.Builder, loc *time.Location, from, to time.Time) {
+	writeICSLine(b, "BEGIN:VTIMEZONE")
+	writeICSLine(b, "TZID:"+loc.String())
+
+	transitions := zoneTransitions(loc, from, to)
+	if len(transitions) == 0 {
+		name, offset := from.In(loc).Zone()
+		writeICSLine(b, "BEGIN:STANDARD")
+		writeICSLine(b, "DTSTART:19700101T000000")
+		writeICSLine(b, "TZOFFSETFROM:"+icsOffset(offset))
+		writeICSLine(b, "TZOFFSETTO:"+icsOffset(offset))
+		writeICSLine(b, "TZNAME:"+name)
+		writeICSLine(b, "END:STANDARD")
+	}
+	for _, t := range transitions {
+		_, fromOffset := t.Add(-time.Second).In(loc).Zone()
+		name, toOffset := t.In(loc).Zone()
+		kind := "STANDARD"
+		if toOffset > fromOffset {
+			kind = "DAYLIGHT"
+		}
+		// DTSTART is the local time of the transition before it takes effect.
+		local := t.In(time.FixedZone("", fromOffset))
+		writeICSLine(b, "BEGIN:"+kind)
+		writeICSLine(b, "DTSTART:"+local.Format(icsDateTime))
+		writeICSLine(b, "TZOFFSETFROM:"+icsOffset(fromOffset))
+		writeICSLine(b, "TZOFFSETTO:"+icsOffset(toOffset))
+		writeICSLine(b, "TZNAME:"+name)
+		writeICSLine(b, "END:"+kind)
+	}
+	writeICSLine(b, "END:VTIMEZONE")
+}
+
+// zoneTransitions returns the instants in [from, to) at which loc's UTC
+// offset changes, found by stepping a day at a time and then narrowing each
+// change down to the second.
+func zoneTransitions(loc *time.Location, from, to time.Time) []time.Time {
+	transitions := make([]time.Time, 0)
+	_, prev := from.In(loc).Zone()
+	for t := from; t.Before(to); t = t.Add(24 * time.Hour) {
+		next := t.Add(24 * time.Hour)
+		_, offset := next.In(loc).Zone()
+		if offset == prev {
+			continue
+		}
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == prev {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		transitions = append(transitions, hi)
+		prev = offset
+	}
+	return transitions
+}
+
+// icsOffset formats a UTC offset in seconds as +HHMM or -HHMM.
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// writeICSLine writes a content line, folding it so no physical line exceeds
+// 75 octets as RFC 5545 requires, without splitting multi-byte characters.
+// Continuation lines start with a space, leaving 74 octets of content.
+func writeICSLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// isRuneStart reports whether c begins a UTF-8 encoded rune.
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
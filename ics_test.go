@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWriteICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{"short", "SUMMARY:Standup", []string{"SUMMARY:Standup"}},
+		{"exactly 75", strings.Repeat("a", 75), []string{strings.Repeat("a", 75)}},
+		{"folded", strings.Repeat("a", 200), []string{strings.Repeat("a", 75), " " + strings.Repeat("a", 74), " " + strings.Repeat("a", 51)}},
+		// A three-byte rune straddling octet 75 moves to the next line whole.
+		{"multi-byte", strings.Repeat("a", 73) + "€€", []string{strings.Repeat("a", 73), " €€"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			writeICSLine(&b, tt.line)
+			lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+			if strings.Join(lines, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("folded into %q, want %q", lines, tt.want)
+			}
+			for _, line := range lines {
+				if len(line) > 75 || !utf8.ValidString(line) {
+					t.Errorf("line %q is %d octets or splits a rune", line, len(line))
+				}
+			}
+		})
+	}
+}
+
+func TestRenderICS(t *testing.T) {
+	setNow(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	utcEvent := timedEvent("utc", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z")
+	zoned := timedEvent("zoned", "Planning, Q2", "2024-03-05T14:00:00Z", "2024-03-05T15:00:00Z")
+	zoned.Start.TimeZone = "America/New_York"
+	long := timedEvent("long", "Quarterly review, all regions", "2024-03-06T09:00:00Z", "2024-03-06T10:00:00Z")
+
+	tests := []struct {
+		name     string
+		events   []calendarEvent
+		q        eventQuery
+		want     []string
+		wantNone []string
+	}{
+		{"UTC", statsFixtures(ownedCalendar("work", "Work"), utcEvent), eventQuery{},
+			[]string{"DTSTART:20240304T090000Z", "DTEND:20240304T093000Z"},
+			[]string{"BEGIN:VTIMEZONE", "TZID"}},
+		{"named zone", statsFixtures(ownedCalendar("work", "Work"), zoned), eventQuery{}, []string{
+			"BEGIN:VTIMEZONE\r\nTZID:America/New_York",
+			"DTSTART;TZID=America/New_York:20240305T090000",
+			"DTEND;TZID=America/New_York:20240305T100000",
+			`SUMMARY:Planning\, Q2`,
+		}, nil},
+		// Truncated before escaping, so the comma is still escaped.
+		{"maxSummaryLen", statsFixtures(ownedCalendar("work", "Work"), long), eventQuery{MaxSummaryLen: 19},
+			[]string{"SUMMARY:Quarterly review\\, …\r\n"}, []string{"regions"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderICS(tt.events, tt.q)
+			if !strings.HasPrefix(got, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(got, "END:VCALENDAR\r\n") {
+				t.Errorf("renderICS() is not a VCALENDAR:\n%s", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("renderICS() lacks %q:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.wantNone {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("renderICS() has %q:\n%s", unwanted, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/api/calendar/v3"
+)
+
+// blockingService holds every Events.List call until release is closed,
+// signalling entered as the first one arrives.
+type blockingService struct {
+	*fakeCalendarService
+	entered chan struct{}
+	once    sync.Once
+	release chan struct{}
+}
+
+func (s *blockingService) ListEvents(ctx context.Context, calendarID string, opts eventListOptions) (*calendar.Events, error) {
+	s.once.Do(func() { close(s.entered) })
+	<-s.release
+	return s.fakeCalendarService.ListEvents(ctx, calendarID, opts)
+}
+
+func TestConcurrentRequestsShareOneFetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+	}{
+		{"success", nil, http.StatusOK},
+		{"error reaches every waiter", errors.New("connection reset"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeService(primaryCalendar("me@example.com"))
+			fake.addEvents("me@example.com", timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"))
+			srv := &blockingService{fakeCalendarService: fake, entered: make(chan struct{}), release: make(chan struct{})}
+			api := newTestAPI(srv)
+			api.inflight = &singleflight.Group{}
+
+			const requests = 8
+			codes := make([]int, requests)
+			var wg sync.WaitGroup
+			for i := 0; i < requests; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					rec := httptest.NewRecorder()
+					api.CalendarHandler(rec, httptest.NewRequest(http.MethodGet, "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z", nil))
+					codes[i] = rec.Code
+				}(i)
+			}
+			<-srv.entered
+			// Give the other requests time to join the fetch in flight.
+			time.Sleep(50 * time.Millisecond)
+			fake.mu.Lock()
+			fake.err = tt.err
+			fake.mu.Unlock()
+			close(srv.release)
+			wg.Wait()
+
+			for i, code := range codes {
+				if code != tt.wantCode {
+					t.Errorf("request %d: status %d, want %d", i, code, tt.wantCode)
+				}
+			}
+			if got := len(fake.eventListCalls()); got != 1 {
+				t.Errorf("Events.List calls = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+type InsertEventRequest struct {
+	CalendarID  string   `json:"calendarId"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description,omitempty"`
+	Start       string   `json:"start"`
+	End         string   `json:"end"`
+	Attendees   []string `json:"attendees,omitempty"`
+	Recurrence  []string `json:"recurrence,omitempty"`
+}
+
+type InsertEventResponse struct {
+	ID       string `json:"id"`
+	HTMLLink string `json:"htmlLink"`
+}
+
+// recurrencePrefixes are the iCalendar properties Google accepts in an
+// event's recurrence.
+var recurrencePrefixes = []string{"RRULE:", "EXRULE:", "RDATE:", "RDATE;", "EXDATE:", "EXDATE;"}
+
+// validRecurrence reports whether line is an RRULE, EXRULE, RDATE or EXDATE
+// line.
+func validRecurrence(line string) bool {
+	for _, prefix := range recurrencePrefixes {
+		if strings.HasPrefix(line, prefix) && len(line) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertEventHandler creates an event from a JSON body of calendarId,
+// summary, RFC3339 start and end times and optionally a description,
+// attendee emails and recurrence lines. Writing needs the full calendar
+// scope, so a token authorized before the service requested it is reported
+// as unauthorized until the user goes through /oauth/login again.
+func (a *API) InsertEventHandler(w http.ResponseWriter, r *http.Request) {
+	var req InsertEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	calendarID, event, err := buildInsertEvent(req)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	created, err := a.createEvent(ctx, srv, calendarID, event)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(InsertEventResponse{ID: created.Id, HTMLLink: created.HtmlLink}); err != nil {
+		logger.Errorf("Error encoding created event %v", err)
+	}
+}
+
+// buildInsertEvent validates req and returns the calendar to create the
+// event in, defaulting to primary, and the event itself.
+func buildInsertEvent(req InsertEventRequest) (string, *calendar.Event, error) {
+	if req.CalendarID == "" {
+		req.CalendarID = "primary"
+	}
+	if !validCalendarID(req.CalendarID) {
+		return "", nil, fmt.Errorf("invalid calendarId %q", req.CalendarID)
+	}
+	if strings.TrimSpace(req.Summary) == "" {
+		return "", nil, errors.New("summary is required")
+	}
+	start, err := time.Parse(time.RFC3339, req.Start)
+	if err != nil {
+		return "", nil, errors.New("start must be an RFC3339 time")
+	}
+	end, err := time.Parse(time.RFC3339, req.End)
+	if err != nil {
+		return "", nil, errors.New("end must be an RFC3339 time")
+	}
+	if !start.Before(end) {
+		return "", nil, errors.New("start must be before end")
+	}
+	attendees := make([]*calendar.EventAttendee, 0, len(req.Attendees))
+	for _, email := range req.Attendees {
+		if email == "primary" || !validCalendarID(email) {
+			return "", nil, fmt.Errorf("invalid attendee %q: must be an email address", email)
+		}
+		attendees = append(attendees, &calendar.EventAttendee{Email: email})
+	}
+	for _, line := range req.Recurrence {
+		if !validRecurrence(line) {
+			return "", nil, fmt.Errorf("invalid recurrence %q: must be an RRULE, EXRULE, RDATE or EXDATE line", line)
+		}
+	}
+	return req.CalendarID, &calendar.Event{
+		Summary:     req.Summary,
+		Description: req.Description,
+		Start:       &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:         &calendar.EventDateTime{DateTime: end.Format(time.RFC3339)},
+		Attendees:   attendees,
+		Recurrence:  req.Recurrence,
+	}, nil
+}
+
+// createEvent inserts event into the calendar, once it is known to be
+// allowed, and drops the cached listings it changes.
+func (a *API) createEvent(ctx context.Context, srv CalendarService, calendarID string, event *calendar.Event) (*calendar.Event, error) {
+	target, err := a.writeTarget(ctx, srv, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	var created *calendar.Event
+	err = breaker.Do(func() (err error) {
+		created, err = srv.InsertEvent(ctx, calendarID, event)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create event in calendar %s: %w", calendarID, err)
+	}
+	a.events.Flush(accountFromContext(ctx), target)
+	a.responses.Flush()
+	return created, nil
+}
+
+// writeTarget checks a calendar about to be written to against the allowlist
+// and returns its calendar list ID, which cached events are keyed by. Only
+// the primary alias differs, so it is only looked up for the cache's sake.
+func (a *API) writeTarget(ctx context.Context, srv CalendarService, calendarID string) (string, error) {
+	if calendarAllowlist == nil && (a.events == nil || calendarID != "primary") {
+		return calendarID, nil
+	}
+	calendars, err := getCalendars(ctx, srv, []string{calendarID})
+	if err != nil {
+		return "", err
+	}
+	return calendars[0].Id, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval limits how often the key set is re-fetched.
+const jwksRefreshInterval = time.Hour
+
+// jwtAuthenticator accepts bearer JWTs signed with HS256 using a shared
+// secret, or RS256 using a key from a JWKS endpoint.
+type jwtAuthenticator struct {
+	secret   []byte
+	jwks     *jwksCache
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+func newJWTAuthenticator(secret, jwksURL, issuer, audience string) (*jwtAuthenticator, error) {
+	if secret == "" && jwksURL == "" {
+		return nil, errors.New("jwt auth requires -jwt-secret or -jwks-url")
+	}
+	a := &jwtAuthenticator{secret: []byte(secret), issuer: issuer, audience: audience, now: time.Now}
+	if jwksURL != "" {
+		a.jwks = &jwksCache{url: jwksURL, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return a, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return Principal{}, errUnauthenticated
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: claims.Subject, Method: "jwt"}, nil
+}
+
+// verify checks the token's signature and standard claims.
+func (a *jwtAuthenticator) verify(token string) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed JWT")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("invalid JWT header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("invalid JWT signature encoding: %v", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if len(a.secret) == 0 {
+			return claims, errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return claims, errors.New("invalid JWT signature")
+		}
+	case "RS256":
+		if a.jwks == nil {
+			return claims, errors.New("RS256 tokens are not accepted")
+		}
+		key, err := a.jwks.key(header.Kid)
+		if err != nil {
+			return claims, err
+		}
+		hashed := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+			return claims, errors.New("invalid JWT signature")
+		}
+	default:
+		return claims, fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("invalid JWT claims: %v", err)
+	}
+	now := a.now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt {
+		return claims, errors.New("JWT is expired")
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return claims, errors.New("JWT is not yet valid")
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return claims, fmt.Errorf("unexpected JWT issuer %q", claims.Issuer)
+	}
+	if a.audience != "" && !hasAudience(claims.Audience, a.audience) {
+		return claims, errors.New("JWT audience does not match")
+	}
+	// The subject picks the account requests act as; an empty one would
+	// act as the server's own.
+	if claims.Subject == "" {
+		return claims, errors.New("JWT has no subject")
+	}
+	return claims, nil
+}
+
+// decodeJWTSegment decodes a base64url JSON segment of a JWT into v.
+func decodeJWTSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// hasAudience reports whether the aud claim, a string or array of strings,
+// contains want.
+func hasAudience(raw json.RawMessage, want string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == want
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, aud := range many {
+			if aud == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwksCache fetches RSA signing keys from a JWKS endpoint, re-fetching when
+// an unknown key ID is seen, at most once per jwksRefreshInterval.
+type jwksCache struct {
+	url     string
+	client  *http.Client
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (c *jwksCache) key(kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(c.fetched) < jwksRefreshInterval && c.keys != nil {
+		return nil, fmt.Errorf("unknown JWT key ID %q", kid)
+	}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown JWT key ID %q", kid)
+}
+
+// refresh replaces the cached keys with the endpoint's current set.
+func (c *jwksCache) refresh() error {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("unable to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch JWKS: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("unable to decode JWKS: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	c.keys = keys
+	c.fetched = time.Now()
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signJWT builds a token over header and claims, signed by sign.
+func signJWT(t *testing.T, header, claims map[string]interface{}, sign func([]byte) []byte) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := segment(header) + "." + segment(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(b []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+}
+
+func TestJWTAuthenticatorHS256(t *testing.T) {
+	at := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	a, err := newJWTAuthenticator("s3cret", "", "https://issuer.example.com", "caltracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return at }
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "alice@example.com",
+			"iss": "https://issuer.example.com",
+			"aud": "caltracker",
+			"exp": at.Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	hs := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", signJWT(t, hs, claims(nil), hs256("s3cret")), false},
+		{"audience list", signJWT(t, hs, claims(map[string]interface{}{"aud": []string{"other", "caltracker"}}), hs256("s3cret")), false},
+		{"wrong secret", signJWT(t, hs, claims(nil), hs256("guess")), true},
+		{"expired", signJWT(t, hs, claims(map[string]interface{}{"exp": at.Add(-time.Minute).Unix()}), hs256("s3cret")), true},
+		{"no expiry", signJWT(t, hs, claims(map[string]interface{}{"exp": nil}), hs256("s3cret")), true},
+		{"not yet valid", signJWT(t, hs, claims(map[string]interface{}{"nbf": at.Add(time.Minute).Unix()}), hs256("s3cret")), true},
+		{"wrong issuer", signJWT(t, hs, claims(map[string]interface{}{"iss": "https://evil.example.com"}), hs256("s3cret")), true},
+		{"wrong audience", signJWT(t, hs, claims(map[string]interface{}{"aud": "other"}), hs256("s3cret")), true},
+		{"no subject", signJWT(t, hs, claims(map[string]interface{}{"sub": nil}), hs256("s3cret")), true},
+		{"alg none", signJWT(t, map[string]interface{}{"alg": "none"}, claims(nil), func([]byte) []byte { return nil }), true},
+		{"RS256 without a JWKS", signJWT(t, map[string]interface{}{"alg": "RS256"}, claims(nil), hs256("s3cret")), true},
+		{"malformed", "not-a-jwt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/calendar", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			p, err := a.Authenticate(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() = %+v, %v; want error %v", p, err, tt.wantErr)
+			}
+			if err == nil && p.Subject != "alice@example.com" {
+				t.Errorf("subject = %q, want alice@example.com", p.Subject)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	a, err := newJWTAuthenticator("", jwks.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256 := func(b []byte) []byte {
+		hashed := sha256.Sum256(b)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	claims := map[string]interface{}{"sub": "bob@example.com", "exp": time.Now().Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "key-1"}, claims, rs256), false},
+		{"unknown key", signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "key-2"}, claims, rs256), true},
+		{"HS256 without a secret", signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, hs256("")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.verify(tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("verify() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
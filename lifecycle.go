@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle owns the background work started alongside the HTTP server.
+var lifecycle = newLifecycleManager()
+
+// lifecycleManager hands background workers a root context that is
+// cancelled at shutdown, tracks them so shutdown can wait for them, and runs
+// shutdown hooks, such as persisting state, once they have finished.
+type lifecycleManager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+}
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func newLifecycleManager() *lifecycleManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycleManager{ctx: ctx, cancel: cancel}
+}
+
+// Context returns the root context, cancelled when shutdown begins.
+func (l *lifecycleManager) Context() context.Context {
+	return l.ctx
+}
+
+// Go runs fn in a goroutine that shutdown waits for. fn should return
+// promptly once its context is cancelled.
+func (l *lifecycleManager) Go(fn func(ctx context.Context)) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		fn(l.ctx)
+	}()
+}
+
+// OnShutdown registers fn to run after the workers have drained. Hooks run
+// in the reverse of the order they were registered.
+func (l *lifecycleManager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Shutdown cancels the root context, waits for the workers until ctx is
+// done, then runs the shutdown hooks with ctx, logging any that fail. Hooks
+// still run when the workers didn't drain in time.
+func (l *lifecycleManager) Shutdown(ctx context.Context) {
+	l.cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		logger.Warn("background workers did not finish before the graceful timeout")
+	}
+
+	l.mu.Lock()
+	hooks := l.hooks
+	l.mu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(ctx); err != nil {
+			logger.Errorf("Shutdown step %s failed: %v", hooks[i].name, err)
+		}
+	}
+}
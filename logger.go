@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logger writes JSON log lines, at the level set by the -log-level flag.
+var logger = newLogger(zapcore.InfoLevel)
+
+func newLogger(level zapcore.Level) *zap.SugaredLogger {
+	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(level)
+	config.EncoderConfig.TimeKey = "time"
+	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	l, err := config.Build()
+	if err != nil {
+		panic(fmt.Sprintf("unable to build logger: %v", err))
+	}
+	return l.Sugar()
+}
+
+// parseLogLevel validates the -log-level flag.
+func parseLogLevel(v string) (zapcore.Level, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(v)); err != nil {
+		return level, fmt.Errorf("invalid log-level %q: must be debug, info, warn or error", v)
+	}
+	return level, nil
+}
+
+type requestIDKey struct{}
+
+// requestIDHeader carries the request ID in both directions, so a caller's
+// own ID is kept and returned.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits caller-supplied IDs to something safe to log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestIDFromContext returns the ID of the request ctx belongs to, or "".
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// loggerFor returns the logger tagged with ctx's request ID, if any.
+func loggerFor(ctx context.Context) *zap.SugaredLogger {
+	if id := requestIDFromContext(ctx); id != "" {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
+
+// assignRequestIDs gives each request an ID, taken from its X-Request-ID
+// header when valid, stores it in the request context and echoes it back.
+func assignRequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			var err error
+			if id, err = randomToken(); err != nil {
+				id = fmt.Sprintf("%d", time.Now().UnixNano())
+			}
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// apiLogTransport logs every call to the Google API with the ID of the
+// request that made it.
+type apiLogTransport struct {
+	base http.RoundTripper
+}
+
+func (t *apiLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	l := loggerFor(req.Context()).With(
+		"method", req.Method,
+		"url", req.URL.Host+req.URL.Path,
+		"duration", time.Since(start),
+	)
+	if err != nil {
+		l.Warnw("google api call failed", "error", err)
+		return resp, err
+	}
+	l.Infow("google api call", "status", resp.StatusCode)
+	return resp, nil
+}
+
+// withAPILogging returns a copy of client whose calls are logged.
+func withAPILogging(client *http.Client) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	logged := *client
+	logged.Transport = &apiLogTransport{base: base}
+	return &logged
+}
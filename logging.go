@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Flush passes flushes through, so streamed responses aren't held back.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, so handlers can reach methods the
+// recorder doesn't pass through, such as deadlines.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logRequests logs one structured line per request with its ID, method,
+// path, remote address, response status and duration, and records the
+// request's latency and, for /calendar, its status in the metrics.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		elapsed := time.Since(start)
+
+		route := routeTemplate(r)
+		requestDuration.WithLabelValues(route, r.Method).Observe(elapsed.Seconds())
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		if route == "/calendar" {
+			calendarRequests.WithLabelValues(strconv.Itoa(rec.status)).Inc()
+		}
+		loggerFor(r.Context()).Infow("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote", r.RemoteAddr,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", elapsed,
+		)
+	})
+}
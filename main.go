@@ -1,62 +1,111 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/option"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type SummaryEvent struct {
-	Calendar       string  `json:"calendar"`
-	Summary        string  `json:"summary"`
-	Created        string  `json:"created"`
-	RecurringEvent bool    `json:"recurringEvent"`
-	EventTime      float64 `json:"eventTime"`
+	ID       string `json:"id"`
+	Calendar string `json:"calendar"`
+	// Calendars lists every calendar a deduplicated event is on, when it
+	// is on more than one.
+	Calendars       []string          `json:"calendars,omitempty"`
+	CalendarColor   string            `json:"calendarColor"`
+	Summary         string            `json:"summary"`
+	Created         string            `json:"created"`
+	Updated         string            `json:"updated"`
+	RecurringEvent  bool              `json:"recurringEvent"`
+	RecurringMaster bool              `json:"recurringMaster"`
+	RecurringID     string            `json:"recurringEventId,omitempty"`
+	Recurrence      []string          `json:"recurrence,omitempty"`
+	InstanceCount   int               `json:"instanceCount,omitempty"`
+	TotalTime       float64           `json:"totalTime,omitempty"`
+	Start           string            `json:"start"`
+	End             string            `json:"end"`
+	TimeZone        string            `json:"timeZone"`
+	EventTime       float64           `json:"eventTime"`
+	AllDay          bool              `json:"allDay"`
+	DurationDays    float64           `json:"durationDays,omitempty"`
+	SpanDays        float64           `json:"spanDays,omitempty"`
+	Type            string            `json:"type,omitempty"`
+	Attendees       []SummaryAttendee `json:"attendees"`
+	AttendeeCount   int               `json:"attendeeCount"`
+	MeetingLink     string            `json:"meetingLink,omitempty"`
+	Conference      string            `json:"conference,omitempty"`
+	Overlapping     bool              `json:"overlapping,omitempty"`
+	OverlapsWith    []string          `json:"overlapsWith,omitempty"`
+	// Set with detail=full only.
+	Organizer   *SummaryAttendee `json:"organizer,omitempty"`
+	Location    string           `json:"location,omitempty"`
+	HangoutLink string           `json:"hangoutLink,omitempty"`
+	Visibility  string           `json:"visibility,omitempty"`
 }
 
-// Retrieve a token, saves the token, then returns the generated client.
-func getClient(config *oauth2.Config) *http.Client {
-	// The file token.json stores the user's access and refresh tokens, and is
-	// created automatically when the authorization flow completes for the first
-	// time.
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
-	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
-	}
-	return config.Client(context.Background(), tok)
+type SummaryAttendee struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName,omitempty"`
+	// Set with detail=full only.
+	ResponseStatus string `json:"responseStatus,omitempty"`
+	Optional       bool   `json:"optional,omitempty"`
+	Organizer      bool   `json:"organizer,omitempty"`
 }
 
-// Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+
-		"authorization code: \n%v\n", authURL)
+// breaker guards every call to the Google Calendar API.
+var breaker = newCircuitBreaker(5, 30*time.Second)
+
+// credentialsFile holds the OAuth client secret, set by the -credentials flag
+// or GOOGLE_CALENDAR_CREDENTIALS.
+var credentialsFile = filepath.Join("resources", "credentials.json")
 
-	var authCode string
-	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+// tokenFile stores the user's access and refresh tokens, set by the -token
+// flag or GOOGLE_CALENDAR_TOKEN. It is created when the authorization flow at
+// /oauth/login completes for the first time. With API authentication on,
+// each caller's token is stored next to it.
+var tokenFile = "token.json"
+
+// envOr returns the environment variable key, or def when it is unset.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
 	}
+	return def
+}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+// Retrieve the user's stored token, then returns the generated client.
+// Refreshed tokens are saved back to the token store.
+func getClient(config *oauth2.Config, user string) (*http.Client, error) {
+	tok, err := tokenStore.Get(user)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		logger.Warnf("No usable token for user %q: %v", user, err)
+		return nil, errNotAuthorized
 	}
-	return tok
+	if err := checkTokenScopes(config, tok); err != nil {
+		logger.Error(err)
+		return nil, errNotAuthorized
+	}
+	ctx := context.Background()
+	ts := newRetryTokenSource(config.TokenSource(ctx, tok), tokenRefreshAttempts, tokenRefreshBackoff)
+	return oauth2.NewClient(ctx, newSavingTokenSource(ts, user, tok)), nil
 }
 
 // Retrieves a token from a local file.
@@ -66,48 +115,407 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 		return nil, err
 	}
 	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+	st := storedToken{Token: &oauth2.Token{}}
+	if err := json.NewDecoder(f).Decode(&st); err != nil {
+		return nil, err
+	}
+	return st.Token.WithExtra(map[string]interface{}{"scope": st.Scope}), nil
 }
 
 // Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
+func saveToken(path string, token *oauth2.Token) error {
+	logger.Infof("Saving credential file to: %s", path)
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		return fmt.Errorf("unable to cache oauth token: %w", err)
 	}
 	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	return json.NewEncoder(f).Encode(storedToken{Token: token, Scope: strings.Join(grantedScopes(token), " ")})
 }
 
 func main() {
 
 	var wait time.Duration
+	var addr string
+	var readTimeout, idleTimeout time.Duration
+	var breakerThreshold int
+	var breakerCooldown time.Duration
+	var jsonNaming string
+	var tlsCert, tlsKey, tlsMinVersion, tlsCiphers string
+	var authOpts authOptions
+	var allowlist string
+	var cacheTTL time.Duration
+	var skippedLogSize int
+	var adminKey string
+	var palette string
+	var dedupe bool
+	var tokenStoreKind, tokenKey string
+	var credMode string
+	var webhooks string
+	var responseTTL time.Duration
+	var configPath, scopes string
+	var logLevel string
+	flag.StringVar(&configPath, "config", os.Getenv(envPrefix+"CONFIG"), "path to a YAML or JSON settings file keyed by flag name; CALTRACKER_* environment variables and flags override it (env CALTRACKER_CONFIG)")
+	flag.StringVar(&scopes, "scopes", strings.Join(oauthScopes, ","), "comma-separated OAuth scopes requested from Google")
+	flag.StringVar(&credentialsFile, "credentials", envOr("GOOGLE_CALENDAR_CREDENTIALS", credentialsFile), "path to the OAuth client secret file (env GOOGLE_CALENDAR_CREDENTIALS)")
+	flag.StringVar(&tokenFile, "token", envOr("GOOGLE_CALENDAR_TOKEN", tokenFile), "path the OAuth token is stored at (env GOOGLE_CALENDAR_TOKEN)")
+	flag.StringVar(&credMode, "credential-mode", envOr("GOOGLE_CALENDAR_CREDENTIAL_MODE", credentialOAuth), "how to authenticate to Google - oauth (user consent via /oauth/login) or service-account (a key file given by -credentials) (env GOOGLE_CALENDAR_CREDENTIAL_MODE)")
+	flag.StringVar(&impersonateSubject, "impersonate", os.Getenv("GOOGLE_CALENDAR_IMPERSONATE"), "Workspace user a service account acts as via domain-wide delegation (env GOOGLE_CALENDAR_IMPERSONATE)")
+	flag.StringVar(&tokenStoreKind, "token-store", "file", "where OAuth tokens are kept - file (the -token file, plus one per user beside it), encrypted (the same files sealed with -token-key; plaintext ones are converted on read) or memory")
+	flag.StringVar(&tokenKey, "token-key", "", "base64-encoded 32-byte AES key for -token-store encrypted, or @file to read it from a file; prefer env CALTRACKER_TOKEN_KEY to passing it on the command line")
 	flag.DurationVar(&wait, "graceful-timeout", time.Second*15, "the duration for which the server gracefully wait for existing connections to finish - e.g. 15s or 1m")
-	flag.Parse()
+	flag.StringVar(&addr, "addr", ":8080", "address the server listens on, e.g. 127.0.0.1:9000")
+	flag.DurationVar(&readTimeout, "read-timeout", time.Second*15, "maximum duration for reading an entire request")
+	flag.DurationVar(&writeTimeout, "write-timeout", writeTimeout, "maximum duration before timing out writes of a response; /calendar/stream is exempt")
+	flag.DurationVar(&idleTimeout, "idle-timeout", time.Second*60, "maximum time to wait for the next request on a keep-alive connection")
+	flag.BoolVar(&autoOpenBrowser, "open-browser", false, "open the /oauth/login page in the default browser at startup when no token is stored")
+	flag.IntVar(&breakerThreshold, "breaker-threshold", 5, "consecutive Google API failures before the circuit breaker opens")
+	flag.DurationVar(&breakerCooldown, "breaker-cooldown", time.Second*30, "how long the circuit breaker stays open before probing Google again")
+	flag.IntVar(&apiRetryAttempts, "api-retry-attempts", apiRetryAttempts, "attempts made for each Google Calendar API call that fails transiently or is rate limited")
+	flag.DurationVar(&apiRetryBackoff, "api-retry-backoff", apiRetryBackoff, "initial backoff between Google Calendar API attempts, doubled after each failure and jittered")
+	flag.Float64Var(&apiQuota, "api-quota", 0, "Calendar API queries per minute the whole project may make, from its Google Cloud quota; calls beyond it wait (default 0, unlimited)")
+	flag.Float64Var(&apiUserQuota, "api-user-quota", 0, "Calendar API queries per minute each user may make, from the per-user quota (default 0, unlimited)")
+	flag.IntVar(&tokenRefreshAttempts, "token-refresh-attempts", 3, "attempts made to refresh the OAuth token when the network fails")
+	flag.DurationVar(&tokenRefreshBackoff, "token-refresh-backoff", time.Millisecond*500, "initial delay between OAuth token refresh attempts, doubled after each failure")
+	flag.StringVar(&jsonNaming, "json-naming", camelCase, "key naming for event JSON output - camelCase or snake_case")
+	flag.StringVar(&grpcAddr, "grpc-addr", "", "address the gRPC API listens on, e.g. :9090 (default gRPC off)")
+	flag.StringVar(&tlsCert, "tls-cert", "", "path to a TLS certificate; serves HTTPS when set together with -tls-key")
+	flag.StringVar(&tlsKey, "tls-key", "", "path to the TLS certificate's private key")
+	flag.StringVar(&tlsMinVersion, "tls-min-version", "1.2", "minimum TLS version accepted - 1.0, 1.1, 1.2 or 1.3")
+	flag.StringVar(&tlsCiphers, "tls-cipher-suites", "", "comma-separated TLS 1.2 cipher suites to allow, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (default Go's secure set)")
+	flag.StringVar(&authOpts.Mode, "auth", "none", "authentication for the HTTP API - none, apikey or jwt")
+	flag.StringVar(&authOpts.APIKeys, "api-keys", "", "comma-separated API keys accepted in the X-API-Key header, optionally as name=key")
+	flag.StringVar(&authOpts.JWTSecret, "jwt-secret", "", "shared secret for verifying HS256 bearer JWTs")
+	flag.StringVar(&authOpts.JWKSURL, "jwks-url", "", "JWKS endpoint for verifying RS256 bearer JWTs")
+	flag.StringVar(&authOpts.JWTIssuer, "jwt-issuer", "", "required iss claim of bearer JWTs")
+	flag.StringVar(&authOpts.JWTAudience, "jwt-audience", "", "required aud claim of bearer JWTs")
+	flag.Float64Var(&rateLimit, "rate-limit", 0, "requests per second each authenticated API principal may make (default 0, unlimited)")
+	flag.IntVar(&rateLimitBurst, "rate-limit-burst", rateLimitBurst, "requests a principal may make at once before -rate-limit applies")
+	flag.StringVar(&allowlist, "calendar-allowlist", "", "comma-separated calendar IDs the service may read, or @file to read them from a file (default all)")
+	flag.Int64Var(&calendarPageSize, "calendar-page-size", 100, "calendars fetched per page when listing the user's calendars (max 250)")
+	flag.StringVar(&invertedEvents, "inverted-events", invertedClamp, "handling of events that end before they start - clamp (duration 0) or skip")
+	flag.DurationVar(&upstreamTimeout, "upstream-timeout", upstreamTimeout, "how long a request waits on the Google Calendar API before failing with 504 (0 for no limit)")
+	flag.DurationVar(&defaultWindow, "default-window", defaultWindow, "how far back requests without a window look, ending now - e.g. 168h")
+	flag.DurationVar(&cacheTTL, "event-cache-ttl", 0, "how long fetched events are reused while their calendar's etag is unchanged - e.g. 5m (default 0, disabled)")
+	flag.BoolVar(&dedupe, "dedupe-requests", true, "share one Google fetch between identical concurrent requests")
+	flag.DurationVar(&responseTTL, "response-cache-ttl", 0, "how long /calendar and /stats responses are reused for the same user and query - e.g. 1m (default 0, disabled)")
+	flag.IntVar(&fetchConcurrency, "fetch-concurrency", fetchConcurrency, "how many calendars' events are fetched from Google at once per request")
+	flag.IntVar(&skippedLogSize, "skipped-log-size", 200, "number of recently skipped malformed events kept for /debug/skipped")
+	flag.StringVar(&adminKey, "admin-api-key", "", "API key required in the X-API-Key header for /admin routes (default admin API disabled)")
+	flag.StringVar(&palette, "calendar-palette", defaultPalette, "comma-separated #rrggbb colors calendars are assigned from by hashing their ID")
+	flag.BoolVar(&dashboardEnabled, "dashboard", false, "serve a status dashboard at / instead of the plain greeting")
+	flag.StringVar(&notificationURL, "notification-url", "", "public HTTPS URL of this service's /notifications route; when set, calendars are watched for changes (default push notifications off)")
+	flag.DurationVar(&watchTTL, "watch-ttl", watchTTL, "lifetime requested for each watch channel before it is renewed")
+	flag.StringVar(&webhooks, "webhooks", "", "comma-separated URLs that change notifications are posted to")
+	flag.DurationVar(&syncHorizon, "sync-horizon", 0, "keep each calendar's events from this far back onwards synced locally with sync tokens, e.g. 2160h (default 0, disabled)")
+	flag.StringVar(&syncStateFile, "sync-state", "", "file synced calendars are saved to at shutdown and restored from at startup (default not persisted)")
+	flag.StringVar(&syncStoreURL, "sync-store", "", "database synced calendars are kept in so history survives restarts - sqlite:path or a postgres:// URL (default memory only)")
+	flag.DurationVar(&syncInterval, "sync-interval", syncInterval, "how often a synced calendar is checked for changes when read")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum level logged - debug, info, warn or error")
+	cmd, args, err := splitCommand(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		commandUsage(os.Stderr)
+		os.Exit(2)
+	}
+	var cliOpts cliOptions
+	fs := commandFlagSet(cmd, &cliOpts)
+	fs.Parse(args)
+
+	var cfg Config
+	if configPath != "" {
+		loaded, err := loadConfig(configPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg = loaded
+	}
+	if err := applyConfig(fs, cfg); err != nil {
+		logger.Fatal(err)
+	}
+	level, err := parseLogLevel(logLevel)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger = newLogger(level)
+	defer logger.Sync()
+	if oauthScopes = normalizeScopes(strings.Split(scopes, ",")); len(oauthScopes) == 0 {
+		logger.Fatal("scopes must list at least one scope")
+	}
+
+	naming, err := parseFieldNaming(jsonNaming)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fieldNaming = naming
+
+	breaker = newCircuitBreaker(breakerThreshold, breakerCooldown)
+
+	if calendarPageSize < 1 || calendarPageSize > 250 {
+		logger.Fatalf("invalid -calendar-page-size %d: must be between 1 and 250", calendarPageSize)
+	}
+	if invertedEvents != invertedClamp && invertedEvents != invertedSkip {
+		logger.Fatalf("invalid -inverted-events %q: must be %s or %s", invertedEvents, invertedClamp, invertedSkip)
+	}
+
+	tlsConfig, err := newTLSConfig(tlsMinVersion, tlsCiphers)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	authenticator, err := newAuthenticator(authOpts)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	authEnabled = authenticator != nil
+	if rateLimit < 0 || rateLimitBurst < 1 {
+		logger.Fatalf("rate-limit must not be negative and rate-limit-burst must be at least 1, got %v and %d", rateLimit, rateLimitBurst)
+	}
+	var limiter *rateLimiter
+	if rateLimit > 0 {
+		if !authEnabled {
+			logger.Fatal("rate-limit requires -auth to identify principals")
+		}
+		limiter = newRateLimiter(rateLimit, rateLimitBurst)
+	}
+
+	if tokenStore, err = newTokenStore(tokenStoreKind, tokenKey); err != nil {
+		logger.Fatal(err)
+	}
+	if credentialMode, err = parseCredentialMode(credMode); err != nil {
+		logger.Fatal(err)
+	}
+	api := newAPI(newServiceCache())
+	if impersonateSubject != "" && credentialMode != credentialServiceAccount {
+		logger.Fatal("impersonate requires credential-mode service-account")
+	}
+
+	if calendarAllowlist, err = parseCalendarAllowlist(allowlist); err != nil {
+		logger.Fatal(err)
+	}
+
+	if calendarPalette, err = parsePalette(palette); err != nil {
+		logger.Fatal(err)
+	}
+
+	if apiRetryAttempts < 1 {
+		logger.Fatalf("api-retry-attempts must be at least 1, got %d", apiRetryAttempts)
+	}
+
+	if apiQuota < 0 || apiUserQuota < 0 {
+		logger.Fatalf("api-quota and api-user-quota must not be negative, got %v and %v", apiQuota, apiUserQuota)
+	}
+	projectQuotaLimiter = newQuotaLimiter(apiQuota)
+	userQuotaLimiter = newQuotaLimiter(apiUserQuota)
+
+	if fetchConcurrency < 1 {
+		logger.Fatalf("fetch-concurrency must be at least 1, got %d", fetchConcurrency)
+	}
+
+	if defaultWindow <= 0 {
+		logger.Fatalf("default-window must be positive, got %v", defaultWindow)
+	}
+
+	// The other commands share the settings above but none of the server's.
+	switch cmd {
+	case "events":
+		err = runEvents(api, cliOpts)
+	case "auth login":
+		err = runAuthLogin(cliOpts)
+	}
+	if cmd != "serve" {
+		logger.Sync()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cacheTTL > 0 {
+		api.events = newEventCache(cacheTTL)
+	}
+	if responseTTL > 0 {
+		api.responses = newRenderedCache(responseTTL)
+	}
+	if dedupe {
+		api.inflight = &singleflight.Group{}
+	}
+	if syncHorizon > 0 {
+		syncer = newEventSyncer(newMemoryEventStore())
+		if syncStateFile != "" && syncStoreURL != "" {
+			logger.Fatal("sync-state and sync-store can't be combined")
+		}
+		if syncStoreURL != "" {
+			storage, err := openSyncStorage(syncStoreURL)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			if err := syncer.UseStorage(storage); err != nil {
+				logger.Fatal(err)
+			}
+			lifecycle.OnShutdown("close sync store", func(context.Context) error {
+				return storage.Close()
+			})
+		}
+		if syncStateFile != "" {
+			if err := syncer.Load(syncStateFile); err != nil {
+				logger.Fatal(err)
+			}
+			lifecycle.OnShutdown("save sync state", func(context.Context) error {
+				return syncer.Save(syncStateFile)
+			})
+		}
+	} else if syncStateFile != "" || syncStoreURL != "" {
+		logger.Fatal("sync-state and sync-store require -sync-horizon")
+	}
+	skippedEvents = newSkippedLog(skippedLogSize)
+
+	digests, err := newDigests(cfg.Digests, cfg.SMTP)
+	if err != nil {
+		logger.Fatalf("invalid digest config: %v", err)
+	}
+
+	if webhookURLs, err = parseWebhookURLs(webhooks); err != nil {
+		logger.Fatal(err)
+	}
+	if notificationURL != "" {
+		if watchTTL <= watchRenewBefore {
+			logger.Fatalf("watch-ttl must be longer than %v, got %v", watchRenewBefore, watchTTL)
+		}
+		watcher = newWatchManager(api.services)
+	}
+
+	if adminKey != "" {
+		if adminAuth, err = newAPIKeyAuthenticator("admin=" + adminKey); err != nil {
+			logger.Fatal(err)
+		}
+	}
 
 	r := mux.NewRouter()
 	r.HandleFunc("/", SayHelloFunc).Methods(http.MethodGet)
-	r.HandleFunc("/calendar", CalendarHandler).Methods(http.MethodGet)
+	r.HandleFunc("/calendar", api.cacheResponses(api.CalendarHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/calendar.ics", api.cacheResponses(api.CalendarICSHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/calendar/stream", api.CalendarStreamHandler).Methods(http.MethodGet)
+	r.HandleFunc("/calendar", api.InsertEventHandler).Methods(http.MethodPost)
+	r.HandleFunc("/events", api.InsertEventHandler).Methods(http.MethodPost)
+	r.HandleFunc("/calendars/{calendarId}/events/{eventId}", api.PatchEventHandler).Methods(http.MethodPatch)
+	r.HandleFunc("/calendars/{calendarId}/events/{eventId}", api.DeleteEventHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/calendars", api.CalendarsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/calendar/counts", api.CountsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/stats", api.cacheResponses(api.StatsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/stats/reminders", api.ReminderStatsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/heatmap", api.HeatmapHandler).Methods(http.MethodGet)
+	r.HandleFunc("/busiest", api.BusiestHandler).Methods(http.MethodGet)
+	r.HandleFunc("/compare", api.CompareHandler).Methods(http.MethodGet)
+	r.HandleFunc("/travel", api.TravelHandler).Methods(http.MethodGet)
+	r.HandleFunc("/slots", api.SlotsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/freebusy", api.FreeBusyHandler).Methods(http.MethodGet)
+	r.HandleFunc("/suggest", api.SuggestHandler).Methods(http.MethodGet)
+	r.HandleFunc("/next/countdown", api.CountdownHandler).Methods(http.MethodGet)
+	r.HandleFunc("/events/recent", api.RecentHandler).Methods(http.MethodGet)
+	r.HandleFunc("/events/check", api.ConflictCheckHandler).Methods(http.MethodPost)
+	r.HandleFunc("/conflicts", api.ConflictsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", HealthHandler).Methods(http.MethodGet)
+	r.HandleFunc("/health", HealthHandler).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", api.ReadinessHandler).Methods(http.MethodGet)
+	r.HandleFunc("/readiness", api.ReadinessHandler).Methods(http.MethodGet)
+	r.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+	r.HandleFunc("/oauth/login", OAuthLoginHandler).Methods(http.MethodGet)
+	r.HandleFunc("/oauth/callback", api.OAuthCallbackHandler).Methods(http.MethodGet)
+	r.HandleFunc("/auth/login", OAuthLoginHandler).Methods(http.MethodGet)
+	r.HandleFunc("/auth/callback", api.OAuthCallbackHandler).Methods(http.MethodGet)
+	r.HandleFunc("/debug/skipped", SkippedHandler).Methods(http.MethodGet)
+	r.HandleFunc("/notifications", api.NotificationsHandler).Methods(http.MethodPost)
+	r.HandleFunc("/admin/cache/flush", requireAdmin(api.FlushCacheHandler)).Methods(http.MethodPost)
+	openAPIRoute := r.Handle("/openapi.json", http.NotFoundHandler()).Methods(http.MethodGet)
+	r.MethodNotAllowedHandler = methodNotAllowed(r)
+	r.Use(assignRequestIDs, logRequests)
+	if authenticator != nil {
+		r.Use(authMiddleware(authenticator, limiter))
+	}
+	r.Use(validateRequests)
+	openAPI, err := openAPIHandler(r)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	openAPIRoute.Handler(openAPI)
 
 	srv := &http.Server{
-		Addr: ":8080",
+		Addr: addr,
 		// Good practice to set timeouts to avoid Slowloris attacks.
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
+		WriteTimeout: writeTimeout,
+		ReadTimeout:  readTimeout,
+		IdleTimeout:  idleTimeout,
 		Handler:      r, // Pass our instance of gorilla/mux in.
+		TLSConfig:    tlsConfig,
+	}
+	srv.RegisterOnShutdown(func() { close(streamsClosing) })
+
+	// Check the service's own token before serving, so one that has to be
+	// re-authorized, e.g. after -scopes changed, is reported now rather
+	// than by 403s later.
+	loginURL := ""
+	if authenticator == nil && credentialMode == credentialOAuth {
+		if err := checkStoredToken(""); err != nil {
+			scheme := "http"
+			if tlsCert != "" && tlsKey != "" {
+				scheme = "https"
+			}
+			host, port, splitErr := net.SplitHostPort(srv.Addr)
+			if splitErr != nil || host == "" {
+				host = "localhost"
+			}
+			loginURL = scheme + "://" + net.JoinHostPort(host, port) + "/oauth/login"
+			if errors.Is(err, errTokenNotFound) {
+				logger.Infof("No stored token; authorize the service at %s", loginURL)
+			} else {
+				logger.Warnf("%v; authorize the service at %s", err, loginURL)
+			}
+		}
 	}
 
 	// Run our server in a goroutine so that it doesn't block.
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			log.Println(err)
+		var err error
+		if tlsCert != "" && tlsKey != "" {
+			err = srv.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			logger.Error(err)
 		}
 	}()
 
+	if loginURL != "" {
+		offerLogin(loginURL)
+	}
+
+	if grpcAddr != "" {
+		var opts []grpc.ServerOption
+		if tlsCert != "" && tlsKey != "" {
+			cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+			if err != nil {
+				logger.Fatalf("Unable to load TLS certificate for gRPC: %v", err)
+			}
+			grpcTLS := tlsConfig.Clone()
+			grpcTLS.Certificates = []tls.Certificate{cert}
+			opts = append(opts, grpc.Creds(credentials.NewTLS(grpcTLS)))
+		}
+		if err := serveGRPC(api, authenticator, limiter, opts...); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	startDigests(api, digests, cfg.SMTP)
+
+	if watcher != nil {
+		if err := watcher.Start(lifecycle.Context()); err != nil {
+			logger.Errorf("Unable to start watching calendars: %v", err)
+		}
+	}
+
 	c := make(chan os.Signal, 1)
 	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
 	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
@@ -122,88 +530,182 @@ func main() {
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline.
 	srv.Shutdown(ctx)
-	// Optionally, you could run srv.Shutdown in a goroutine and block on
-	// <-ctx.Done() if your application should wait for other services
-	// to finalize based on context cancellation.
-	log.Println("shutting down")
+	// With requests finished, stop the background workers and persist
+	// their state within what is left of the same deadline.
+	lifecycle.Shutdown(ctx)
+	logger.Info("shutting down")
+	logger.Sync()
 	os.Exit(0)
 }
 
-func CalendarHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		c := make([]SummaryEvent, 0)
+// CalendarICSHandler serves /calendar as an ICS feed, for calendar clients
+// that subscribe by URL and can't add a format parameter.
+func (a *API) CalendarICSHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	values.Set("format", "ics")
+	r.URL.RawQuery = values.Encode()
+	a.CalendarHandler(w, r)
+}
 
-		ctx := context.Background()
-		b, err := ioutil.ReadFile("resources\\credentials.json")
-		if err != nil {
-			log.Fatalf("Unable to read client secret file: %v", err)
-		}
+// CalendarHandler lists the selected calendars' events in the window, in the
+// format parameter's format.
+func (a *API) CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		// If modifying these scopes, delete your previously saved token.json.
-		config, err := google.ConfigFromJSON(b, calendar.CalendarReadonlyScope)
-		if err != nil {
-			log.Fatalf("Unable to parse client secret file to config: %v", err)
+	format := r.URL.Query().Get("format")
+	var slackOpts slackOptions
+	switch format {
+	case "", "json", "agenda", "totals", "ics", "xlsx", "csv", "ndjson":
+	case "slack":
+		if slackOpts, err = parseSlackOptions(r.URL.Query()); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		client := getClient(config)
-
-		srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
-		if err != nil {
-			log.Fatalf("Unable to retrieve Calendar client: %v", err)
+		// A digest announces what's coming, so without a window look
+		// ahead from now rather than back over the default window.
+		if !windowRequested(r.URL.Query()) {
+			t := now()
+			q.TimeMin, q.TimeMax = t.In(q.Location), t.Add(defaultWindow).In(q.Location)
 		}
+	default:
+		writeError(w, fmt.Sprintf("invalid format %q: must be json, ndjson, slack, agenda, totals, ics, xlsx or csv", format), http.StatusBadRequest)
+		return
+	}
 
-		cal, err := srv.CalendarList.List().MinAccessRole("owner").MaxResults(20).Do()
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		if err != nil {
-			log.Fatalf("Unable to retrieve users Calenders: %v", err)
-		}
+	if format == "ndjson" && (q.AnnotateOverlaps || !q.Expand || q.Descending || page.Limit > 0 || page.Offset > 0) {
+		writeError(w, "ndjson streams events as they are fetched, so it can't be combined with annotateOverlaps, expand=false, sort=desc, limit or offset", http.StatusBadRequest)
+		return
+	}
 
-		if len(cal.Items) == 0 {
-			fmt.Printf("No calendars found")
-		} else {
+	aggregate, err := parseBoolParam(r.URL.Query(), "aggregate", false)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if aggregate && format != "" && format != "json" {
+		writeError(w, "aggregate can only be combined with the json format", http.StatusBadRequest)
+		return
+	}
 
-			for _, userCalendar := range cal.Items {
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
 
-				events, err := srv.Events.List(userCalendar.Id).SingleEvents(true).ShowDeleted(false).TimeMin(time.Now().AddDate(0, -1, 0).Format(time.RFC3339)).TimeMax(time.Now().Format(time.RFC3339)).OrderBy("updated").Do()
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
 
-				if err != nil {
-					log.Fatalf("Unable to retrieve events from the Calendar %v", err)
-				} else {
-					for _, event := range events.Items {
-						summary := event.Summary
+	if aggregate {
+		totals, err := a.calendarTotals(ctx, srv, q)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(aggregateTotals(totals)); err != nil {
+			logger.Errorf("Error encoding aggregate %v", err)
+		}
+		return
+	}
 
-						endTime, err := time.Parse(time.RFC3339, event.End.DateTime)
-						if err != nil {
-							log.Fatalf("Error parsing time from event, %s", err)
-						}
+	if format == "ndjson" {
+		a.streamNDJSON(ctx, w, srv, q)
+		return
+	}
 
-						startTime, err := time.Parse(time.RFC3339, event.Start.DateTime)
-						if err != nil {
-							log.Fatalf("Error parsing time from event, %s", err)
-						}
+	if format == "totals" {
+		totals, err := a.calendarTotals(ctx, srv, q)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(totals); err != nil {
+			logger.Errorf("Error encoding totals %v", err)
+		}
+		return
+	}
 
-						time := endTime.Sub(startTime)
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
 
-						var calEvent = SummaryEvent{
-							Calendar:  userCalendar.Summary,
-							Summary:   summary,
-							Created:   event.Created,
-							EventTime: time.Minutes(),
-						}
+	switch format {
+	case "slack":
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(buildSlackMessage(events, q, slackOpts)); err != nil {
+			logger.Errorf("Error encoding slack message %v", err)
+		}
+		return
+	case "agenda":
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(renderAgenda(events, q)))
+		return
+	case "ics":
+		w.Header().Set("Content-Type", "text/calendar; charset=UTF-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="calendar.ics"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(renderICS(events, q)))
+		return
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="calendar.csv"`)
+		w.WriteHeader(http.StatusOK)
+		if err := writeCSV(w, events, q); err != nil {
+			logger.Errorf("Error writing CSV export %v", err)
+		}
+		return
+	case "xlsx":
+		var buf bytes.Buffer
+		if err := writeXLSX(&buf, events, q); err != nil {
+			logger.Error(err)
+			writeError(w, "unable to build spreadsheet", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", `attachment; filename="calendar.xlsx"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+		return
+	}
 
-						c = append(c, calEvent)
-					}
-				}
-			}
+	c, err := summarizeEvents(ctx, srv, events, q)
+	if err != nil {
+		logger.Error(err)
+		writeError(w, "unable to summarize events", http.StatusInternalServerError)
+		return
+	}
+	c = paginate(w, c, page)
 
-			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(c); err != nil {
-				log.Fatalf("Error parsing json from request %v", err)
-			}
-		}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		logger.Errorf("Error encoding events %v", err)
 	}
 }
 
+// SayHelloFunc greets, or serves the status dashboard when -dashboard is set.
 func SayHelloFunc(w http.ResponseWriter, r *http.Request) {
+	if dashboardEnabled {
+		serveDashboard(w)
+		return
+	}
 	w.Write([]byte("Hello!"))
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// methodNotAllowed answers requests whose path is routed but whose method
+// isn't, listing the methods the path does support in the Allow header.
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen := make(map[string]bool)
+		allowed := make([]string, 0)
+		router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			methods, err := route.GetMethods()
+			if err != nil {
+				return nil
+			}
+			for _, method := range methods {
+				probe := *r
+				probe.Method = method
+				if route.Match(&probe, &mux.RouteMatch{}) && !seen[method] {
+					seen[method] = true
+					allowed = append(allowed, method)
+				}
+			}
+			return nil
+		})
+		sort.Strings(allowed)
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, "method "+r.Method+" not allowed", http.StatusMethodNotAllowed)
+	})
+}
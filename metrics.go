@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	calendarRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "caltracker_calendar_requests_total",
+		Help: "Requests to /calendar by response status code.",
+	}, []string{"code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "caltracker_http_request_duration_seconds",
+		Help:    "Handler latency by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "caltracker_http_requests_total",
+		Help: "Requests by route, method and response status code.",
+	}, []string{"route", "method", "code"})
+
+	googleAPICalls = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "caltracker_google_api_calls_total",
+		Help: "Calls made to the Google Calendar API, excluding those the circuit breaker refused.",
+	})
+
+	googleRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "caltracker_google_api_rate_limited_total",
+		Help: "Google Calendar API calls rejected for exceeding a quota or rate limit.",
+	})
+
+	googleRateLimitRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "caltracker_google_api_rate_limit_retries_total",
+		Help: "Google Calendar API calls retried after a quota or rate limit response.",
+	})
+
+	googleQuotaWait = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "caltracker_google_api_quota_wait_seconds_total",
+		Help: "Time Google Calendar API calls spent waiting for the -api-quota or -api-user-quota limits.",
+	})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "caltracker_cache_lookups_total",
+		Help: "Cache lookups by cache (events or responses) and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	tokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "caltracker_token_refreshes_total",
+		Help: "OAuth token refresh attempts by result: success, retry or failure.",
+	}, []string{"result"})
+
+	googleAPIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "caltracker_google_api_errors_total",
+		Help: "Failed Google Calendar API calls by HTTP status code, or \"network\" when no response came back.",
+	}, []string{"code"})
+)
+
+func init() {
+	prometheus.MustRegister(calendarRequests, httpRequests, requestDuration, googleAPICalls, googleAPIErrors,
+		googleRateLimited, googleRateLimitRetries, googleQuotaWait, cacheLookups, tokenRefreshes)
+}
+
+// routeTemplate returns the path template of the route serving r, keeping
+// metric labels bounded however many distinct URLs are requested.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
+
+// recordGoogleAPIError counts a failed Google API call, and separately
+// those refused for quota or rate limits.
+func recordGoogleAPIError(err error) {
+	code := "network"
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		code = strconv.Itoa(apiErr.Code)
+		if isRateLimited(apiErr) {
+			googleRateLimited.Inc()
+		}
+	}
+	googleAPIErrors.WithLabelValues(code).Inc()
+}
+
+// isRateLimited reports whether Google refused a call for quota: a 429, or a
+// 403 with a rate limit reason.
+func isRateLimited(apiErr *googleapi.Error) bool {
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	if apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// recordCacheLookup counts a hit or miss on the named cache.
+func recordCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/api/calendar/v3"
+)
+
+// PatchEventRequest holds the fields to change on an event; omitted fields
+// are left as they are.
+type PatchEventRequest struct {
+	Summary   *string   `json:"summary"`
+	Start     *string   `json:"start"`
+	End       *string   `json:"end"`
+	Attendees *[]string `json:"attendees"`
+}
+
+type PatchEventResponse struct {
+	ID       string `json:"id"`
+	Etag     string `json:"etag"`
+	HTMLLink string `json:"htmlLink"`
+}
+
+// sendUpdateValues are the accepted sendUpdates parameter values.
+var sendUpdateValues = map[string]bool{"": true, "all": true, "externalOnly": true, "none": true}
+
+// eventTarget reads and checks the calendar and event IDs from the route and
+// the sendUpdates parameter.
+func eventTarget(r *http.Request) (calendarID, eventID, sendUpdates string, err error) {
+	vars := mux.Vars(r)
+	calendarID, eventID = vars["calendarId"], vars["eventId"]
+	if !validCalendarID(calendarID) {
+		return "", "", "", fmt.Errorf("invalid calendarId %q", calendarID)
+	}
+	sendUpdates = r.URL.Query().Get("sendUpdates")
+	if !sendUpdateValues[sendUpdates] {
+		return "", "", "", fmt.Errorf("invalid sendUpdates %q: must be all, externalOnly or none", sendUpdates)
+	}
+	return calendarID, eventID, sendUpdates, nil
+}
+
+// buildPatch turns a patch request into the event fields to send.
+func buildPatch(req PatchEventRequest) (*calendar.Event, error) {
+	patch := &calendar.Event{}
+	if req.Summary != nil {
+		patch.Summary = *req.Summary
+		if patch.Summary == "" {
+			patch.NullFields = append(patch.NullFields, "Summary")
+		}
+	}
+	if (req.Start == nil) != (req.End == nil) {
+		return nil, fmt.Errorf("start and end must be changed together")
+	}
+	if req.Start != nil {
+		start, err := time.Parse(time.RFC3339, *req.Start)
+		if err != nil {
+			return nil, fmt.Errorf("start must be an RFC3339 time")
+		}
+		end, err := time.Parse(time.RFC3339, *req.End)
+		if err != nil {
+			return nil, fmt.Errorf("end must be an RFC3339 time")
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("start must be before end")
+		}
+		patch.Start = &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)}
+		patch.End = &calendar.EventDateTime{DateTime: end.Format(time.RFC3339)}
+	}
+	if req.Attendees != nil {
+		patch.Attendees = make([]*calendar.EventAttendee, 0, len(*req.Attendees))
+		for _, email := range *req.Attendees {
+			if email == "primary" || !validCalendarID(email) {
+				return nil, fmt.Errorf("invalid attendee %q: must be an email address", email)
+			}
+			patch.Attendees = append(patch.Attendees, &calendar.EventAttendee{Email: email})
+		}
+		if len(patch.Attendees) == 0 {
+			patch.NullFields = append(patch.NullFields, "Attendees")
+		}
+	}
+	return patch, nil
+}
+
+// PatchEventHandler partially updates an event. An If-Match header carrying
+// the event's etag makes the update fail with 412 if the event changed since
+// the client read it.
+func (a *API) PatchEventHandler(w http.ResponseWriter, r *http.Request) {
+	calendarID, eventID, sendUpdates, err := eventTarget(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req PatchEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	patch, err := buildPatch(req)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	target, err := a.writeTarget(ctx, srv, calendarID)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	var updated *calendar.Event
+	err = breaker.Do(func() (err error) {
+		updated, err = srv.PatchEvent(ctx, calendarID, eventID, patch, sendUpdates, r.Header.Get("If-Match"))
+		return err
+	})
+	if err != nil {
+		writeUpstreamError(w, fmt.Errorf("unable to update event %s in calendar %s: %w", eventID, calendarID, err))
+		return
+	}
+	a.events.Flush(accountFromContext(ctx), target)
+	a.responses.Flush()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", updated.Etag)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(PatchEventResponse{ID: updated.Id, Etag: updated.Etag, HTMLLink: updated.HtmlLink}); err != nil {
+		logger.Errorf("Error encoding updated event %v", err)
+	}
+}
+
+// DeleteEventHandler deletes an event, honouring If-Match like
+// PatchEventHandler.
+func (a *API) DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	calendarID, eventID, sendUpdates, err := eventTarget(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	target, err := a.writeTarget(ctx, srv, calendarID)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	err = breaker.Do(func() error {
+		return srv.DeleteEvent(ctx, calendarID, eventID, sendUpdates, r.Header.Get("If-Match"))
+	})
+	if err != nil {
+		writeUpstreamError(w, fmt.Errorf("unable to delete event %s from calendar %s: %w", eventID, calendarID, err))
+		return
+	}
+	a.events.Flush(accountFromContext(ctx), target)
+	a.responses.Flush()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode"
+)
+
+const (
+	camelCase = "camelCase"
+	snakeCase = "snake_case"
+)
+
+// fieldNaming is the key style used when encoding SummaryEvent, set by the
+// -json-naming flag.
+var fieldNaming = camelCase
+
+// parseFieldNaming validates a -json-naming value.
+func parseFieldNaming(v string) (string, error) {
+	switch v {
+	case camelCase, snakeCase:
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid json naming %q: must be %s or %s", v, camelCase, snakeCase)
+}
+
+// MarshalJSON encodes the event using its camelCase tags, renaming the keys
+// when another naming strategy is configured.
+func (e SummaryEvent) MarshalJSON() ([]byte, error) {
+	type plain SummaryEvent
+	b, err := json.Marshal(plain(e))
+	if err != nil || fieldNaming != snakeCase {
+		return b, err
+	}
+	return renameKeys(b, toSnakeCase)
+}
+
+// toSnakeCase converts a camelCase name such as "eventTime" or "htmlURL" to
+// "event_time" or "html_url".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b bytes.Buffer
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// renameKeys rewrites every object key in the JSON document data, keeping
+// key order and values intact.
+func renameKeys(data []byte, rename func(string) string) ([]byte, error) {
+	type level struct {
+		object bool
+		n      int // keys and values written so far
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out bytes.Buffer
+	var levels []*level
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var parent *level
+		if len(levels) > 0 {
+			parent = levels[len(levels)-1]
+		}
+
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			out.WriteRune(rune(d))
+			levels = levels[:len(levels)-1]
+			continue
+		}
+
+		isKey := false
+		if parent != nil {
+			if parent.n > 0 {
+				if parent.object && parent.n%2 == 1 {
+					out.WriteByte(':')
+				} else {
+					out.WriteByte(',')
+				}
+			}
+			isKey = parent.object && parent.n%2 == 0
+			parent.n++
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			out.WriteRune(rune(t))
+			levels = append(levels, &level{object: t == '{'})
+		case string:
+			if isKey {
+				t = rename(t)
+			}
+			b, err := json.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		default:
+			b, err := json.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		}
+	}
+	return out.Bytes(), nil
+}
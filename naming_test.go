@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestToSnakeCase(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"id", "id"},
+		{"eventTime", "event_time"},
+		{"recurringEventId", "recurring_event_id"},
+		{"htmlURL", "html_url"},
+		{"URLPath", "url_path"},
+		{"day2Time", "day2_time"},
+	}
+	for _, tt := range tests {
+		if got := toSnakeCase(tt.in); got != tt.want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSummaryEventNaming(t *testing.T) {
+	saved := fieldNaming
+	defer func() { fieldNaming = saved }()
+
+	event := SummaryEvent{
+		ID:        "a",
+		EventTime: 30,
+		Attendees: []SummaryAttendee{{Email: "bob@example.com", DisplayName: "Bob"}},
+	}
+	tests := []struct {
+		naming  string
+		want    []string
+		notWant []string
+	}{
+		{camelCase, []string{`"eventTime":30`, `"calendarColor":""`, `"displayName":"Bob"`}, []string{`"event_time"`}},
+		{snakeCase, []string{`"event_time":30`, `"calendar_color":""`, `"display_name":"Bob"`, `"attendee_count":0`}, []string{`"eventTime"`, `"displayName"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.naming, func(t *testing.T) {
+			fieldNaming = tt.naming
+			b, err := json.Marshal([]SummaryEvent{event})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(b), want) {
+					t.Errorf("%s missing %s", b, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(b), notWant) {
+					t.Errorf("%s contains %s", b, notWant)
+				}
+			}
+			if !json.Valid(b) {
+				t.Errorf("invalid JSON %s", b)
+			}
+		})
+	}
+}
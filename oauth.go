@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// errNotAuthorized is returned while no usable token is stored.
+var errNotAuthorized = errors.New("calendar access not authorized: visit /oauth/login")
+
+// oauthStateTTL is how long a login attempt has to complete.
+const oauthStateTTL = 10 * time.Minute
+
+// oauthStates holds the state values of login attempts in progress, so the
+// callback only accepts codes from flows this server started, and stores the
+// token for the user who started it.
+var oauthStates = &stateStore{states: make(map[string]pendingLogin), now: time.Now}
+
+type pendingLogin struct {
+	user   string
+	issued time.Time
+}
+
+type stateStore struct {
+	mu     sync.Mutex
+	states map[string]pendingLogin
+	now    func() time.Time
+}
+
+// New issues a random state value for user's login, dropping any expired
+// ones.
+func (s *stateStore) New(user string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for st, login := range s.states {
+		if s.now().Sub(login.issued) >= oauthStateTTL {
+			delete(s.states, st)
+		}
+	}
+	s.states[state] = pendingLogin{user: user, issued: s.now()}
+	return state, nil
+}
+
+// Consume returns the user whose login issued state, and whether it was
+// issued and hasn't expired. Each state is only accepted once.
+func (s *stateStore) Consume(state string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	login, ok := s.states[state]
+	delete(s.states, state)
+	return login.user, ok && s.now().Sub(login.issued) < oauthStateTTL
+}
+
+// oauthRedirectURL returns the callback URL Google redirects back to, on the
+// host the login request came in on. The flow is also served under /auth/,
+// but the callback stays on /oauth/ so only one redirect URI needs
+// registering with Google.
+func oauthRedirectURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/oauth/callback"
+}
+
+// OAuthLoginHandler starts the authorization flow by redirecting the browser
+// to Google's consent page. With API authentication on, the login is for the
+// authenticated caller's own account.
+func OAuthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if credentialMode == credentialServiceAccount {
+		writeError(w, "authorization isn't needed with service account credentials", http.StatusNotFound)
+		return
+	}
+	config, err := loadOAuthConfig()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	config.RedirectURL = oauthRedirectURL(r)
+
+	state, err := oauthStates.New(accountFromContext(r.Context()))
+	if err != nil {
+		logger.Error(err)
+		writeError(w, "unable to start authorization", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, config.AuthCodeURL(state, oauth2.AccessTypeOffline), http.StatusFound)
+}
+
+// OAuthCallbackHandler completes the authorization flow: it checks the state
+// issued by OAuthLoginHandler, exchanges the code for a token, stores it for
+// the user who logged in and redirects back to /.
+func (a *API) OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	user, ok := oauthStates.Consume(values.Get("state"))
+	if !ok {
+		writeError(w, "invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	if reason := values.Get("error"); reason != "" {
+		writeError(w, "authorization denied: "+reason, http.StatusForbidden)
+		return
+	}
+	code := values.Get("code")
+	if code == "" {
+		writeError(w, "missing code", http.StatusBadRequest)
+		return
+	}
+
+	config, err := loadOAuthConfig()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	config.RedirectURL = oauthRedirectURL(r)
+
+	tok, err := config.Exchange(context.Background(), code)
+	if err != nil {
+		logger.Errorf("Unable to exchange authorization code: %v", err)
+		writeError(w, "unable to exchange authorization code", http.StatusBadGateway)
+		return
+	}
+	if err := tokenStore.Save(user, tok); err != nil {
+		logger.Error(err)
+		writeError(w, "unable to store token", http.StatusInternalServerError)
+		return
+	}
+	a.services.Reset(user)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
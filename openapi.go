@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// paramSpec describes one query, path or body field. It feeds both the
+// OpenAPI document and the validation middleware, so they can't disagree.
+type paramSpec struct {
+	Name string
+	// Type is string, integer, number, boolean or, for body fields only,
+	// array (of strings).
+	Type        string
+	Enum        []string
+	Required    bool
+	Description string
+}
+
+// operationSpec describes a route for one method.
+type operationSpec struct {
+	Summary string
+	Params  []paramSpec
+	// Body lists the fields of a JSON object request body.
+	Body []paramSpec
+	// Response is the schema of the JSON success response, where it is
+	// described.
+	Response map[string]interface{}
+}
+
+func stringParam(name, description string) paramSpec {
+	return paramSpec{Name: name, Type: "string", Description: description}
+}
+
+func intParam(name, description string) paramSpec {
+	return paramSpec{Name: name, Type: "integer", Description: description}
+}
+
+func boolParam(name, description string) paramSpec {
+	return paramSpec{Name: name, Type: "boolean", Description: description}
+}
+
+func enumParam(name, description string, values ...string) paramSpec {
+	return paramSpec{Name: name, Type: "string", Enum: values, Description: description}
+}
+
+func requiredParam(p paramSpec) paramSpec {
+	p.Required = true
+	return p
+}
+
+// joinParams joins parameter lists.
+func joinParams(lists ...[]paramSpec) []paramSpec {
+	all := make([]paramSpec, 0)
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// withoutParam returns params less the one named name.
+func withoutParam(params []paramSpec, name string) []paramSpec {
+	kept := make([]paramSpec, 0, len(params))
+	for _, p := range params {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// windowParams select the time window, read by parseWindow and parseLocation.
+var windowParams = []paramSpec{
+	stringParam("from", "window start: RFC3339, a date, now, or an offset such as -7d"),
+	stringParam("to", "window end, as from"),
+	stringParam("timeMin", "alias of from"),
+	stringParam("timeMax", "alias of to"),
+	intParam("days", "window length in days ending at to"),
+	stringParam("window", "lastWeek, thisWeek, nextWeek or start/end in RFC3339"),
+	stringParam("tz", "IANA time zone results are reported in"),
+}
+
+// eventParams are read by parseEventValues, shared by every event listing.
+var eventParams = joinParams(windowParams, []paramSpec{
+	boolParam("singleEvents", "expand recurring events into instances (default true)"),
+	boolParam("onlyMultiDay", "only events spanning several days"),
+	boolParam("includeTasks", "include Google Tasks"),
+	boolParam("internalOnly", "only events organized within the user's domain"),
+	intParam("maxSummaryLen", "truncate summaries to this many characters"),
+	enumParam("orderBy", "order Google returns each calendar's events in", "startTime", "updated"),
+	enumParam("sort", "direction of the result", "asc", "desc"),
+	stringParam("calendar", "only the calendar with this ID or name"),
+	stringParam("calendars", "comma-separated calendar IDs"),
+	boolParam("includePrimary", "always include the primary calendar with calendars (default true)"),
+	boolParam("includeSubscribed", "include calendars the user can only read"),
+	enumParam("minAccessRole", "least access the user needs to a listed calendar", "reader", "writer", "owner"),
+	stringParam("excludeCalendars", "comma-separated calendar IDs to leave out"),
+	stringParam("room", "only events booking this room"),
+	intParam("maxAttendees", "attendees listed per event (default 50)"),
+	boolParam("onlyVideo", "only events with a video conference"),
+	boolParam("annotateOverlaps", "mark events overlapping another"),
+	boolParam("foldRecurring", "one agenda line per recurring series"),
+	boolParam("useGoogleColors", "report calendars' own colors"),
+	boolParam("dedupe", "merge copies of an event found on several calendars, listing them"),
+	stringParam("delegateFor", "attendee whose meetings are listed"),
+	enumParam("responseStatus", "only events with this response", "accepted", "declined", "tentative", "needsAction"),
+	stringParam("q", "free-text search"),
+	boolParam("expand", "list each instance of a series (default true)"),
+	stringParam("attendee", "only events with this attendee; a trailing @ matches a prefix"),
+	stringParam("organizer", "only events with this organizer; a trailing @ matches a prefix"),
+	enumParam("detail", "summary or full detail per event", "summary", "full"),
+})
+
+var pagingParams = []paramSpec{
+	intParam("limit", "events per page"),
+	intParam("offset", "events skipped before the page"),
+}
+
+var eventPathParams = []paramSpec{
+	requiredParam(stringParam("calendarId", "calendar ID")),
+	requiredParam(stringParam("eventId", "event ID")),
+}
+
+// apiSpec describes each route by "METHOD /path", with the path as the
+// router's template.
+var apiSpec = map[string]operationSpec{
+	"GET /": {Summary: "Greeting, or the status dashboard with -dashboard"},
+	"GET /calendar": {Summary: "List events", Params: joinParams(eventParams, pagingParams, []paramSpec{
+		enumParam("format", "response format", "json", "ndjson", "slack", "agenda", "totals", "ics", "xlsx", "csv"),
+		boolParam("aggregate", "time totals across all calendars"),
+		stringParam("slackHeading", "heading of a Slack message"),
+		intParam("slackLimit", "events in a Slack message"),
+	})},
+	"GET /calendar.ics":    {Summary: "Events as an iCalendar feed", Params: eventParams},
+	"GET /calendar/stream": {Summary: "Server-sent events for changes to events", Params: eventParams},
+	"POST /calendar":       {Summary: "Create an event", Body: insertEventBody},
+	"POST /events":         {Summary: "Create an event", Body: insertEventBody},
+	"PATCH /calendars/{calendarId}/events/{eventId}": {Summary: "Update an event", Params: joinParams(eventPathParams, []paramSpec{
+		enumParam("sendUpdates", "who Google notifies", "all", "externalOnly", "none"),
+	}), Body: []paramSpec{
+		stringParam("summary", "new title"),
+		stringParam("start", "new RFC3339 start"),
+		stringParam("end", "new RFC3339 end"),
+		{Name: "attendees", Type: "array", Description: "new attendee emails"},
+	}},
+	"DELETE /calendars/{calendarId}/events/{eventId}": {Summary: "Delete an event", Params: joinParams(eventPathParams, []paramSpec{
+		enumParam("sendUpdates", "who Google notifies", "all", "externalOnly", "none"),
+	})},
+	"GET /calendars":       {Summary: "List calendars", Params: eventParams},
+	"GET /calendar/counts": {Summary: "Event counts per calendar", Params: eventParams},
+	"GET /stats": {Summary: "Time spent by group", Params: joinParams(eventParams, []paramSpec{
+		enumParam("groupBy", "grouping", "calendar", "organizer", "weekday", "week", "attendeeDomain", "category", "title"),
+		boolParam("normalizeTitles", "group titles ignoring case and spacing"),
+	})},
+	"GET /stats/reminders": {Summary: "Reminder settings across events", Params: eventParams},
+	"GET /heatmap":         {Summary: "Event counts and minutes per date in the window", Params: eventParams, Response: heatmapResponse},
+	"GET /busiest": {Summary: "Busiest days", Params: joinParams(withoutParam(eventParams, "days"), []paramSpec{
+		intParam("days", "length of the busiest period in days (default 7); the window is set by from and to"),
+	})},
+	"GET /compare": {Summary: "Compare two windows", Params: joinParams(eventParams, []paramSpec{
+		stringParam("previous", "earlier window (default lastWeek)"),
+		stringParam("current", "later window (default thisWeek)"),
+	})},
+	"GET /travel": {Summary: "Back-to-back events without travel time", Params: joinParams(eventParams, []paramSpec{
+		stringParam("minBuffer", "least gap between events, e.g. 15m"),
+	})},
+	"GET /slots": {Summary: "Free slots", Params: joinParams(eventParams, []paramSpec{
+		stringParam("slotSize", "slot length, e.g. 30m"),
+	})},
+	"GET /freebusy": {Summary: "Busy and free time of calendars", Params: joinParams(windowParams, []paramSpec{
+		requiredParam(stringParam("emails", "comma-separated calendar emails")),
+	})},
+	"GET /suggest": {Summary: "Meeting times all attendees are free", Params: []paramSpec{
+		requiredParam(stringParam("attendees", "comma-separated attendee emails")),
+		stringParam("duration", "meeting length, e.g. 30m"),
+		stringParam("window", "how far ahead to look, e.g. 5d"),
+		stringParam("workStart", "start of working hours, HH:MM"),
+		stringParam("workEnd", "end of working hours, HH:MM"),
+		intParam("limit", "most suggestions returned"),
+		stringParam("tz", "IANA time zone results are reported in"),
+	}},
+	"GET /next/countdown": {Summary: "Time until the next event", Params: eventParams},
+	"GET /events/recent": {Summary: "Recently changed events", Params: joinParams(eventParams, []paramSpec{
+		stringParam("since", "earliest change listed: RFC3339 or an offset such as -7d (default the default window before now); the window parameters are ignored"),
+		enumParam("by", "change ordering", "updated", "created"),
+		intParam("limit", "events returned"),
+	})},
+	"POST /events/check": {Summary: "Events conflicting with a proposed time", Body: []paramSpec{
+		stringParam("calendarId", "calendar checked (default primary)"),
+		requiredParam(stringParam("start", "RFC3339 start")),
+		requiredParam(stringParam("end", "RFC3339 end")),
+	}},
+	"GET /conflicts": {Summary: "Overlapping events across calendars", Params: joinParams(eventParams, []paramSpec{
+		boolParam("onlyAccepted", "only events the user accepted"),
+	})},
+	"GET /healthz":        {Summary: "Liveness"},
+	"GET /health":         {Summary: "Liveness"},
+	"GET /readyz":         {Summary: "Readiness with per-check status"},
+	"GET /readiness":      {Summary: "Readiness with per-check status"},
+	"GET /metrics":        {Summary: "Prometheus metrics"},
+	"GET /oauth/login":    {Summary: "Start Google authorization"},
+	"GET /oauth/callback": {Summary: "Google authorization callback"},
+	"GET /auth/login":     {Summary: "Start Google authorization"},
+	"GET /auth/callback":  {Summary: "Google authorization callback"},
+	"GET /debug/skipped":  {Summary: "Events skipped as malformed"},
+	"POST /notifications": {Summary: "Google push notifications"},
+	"POST /admin/cache/flush": {Summary: "Flush caches", Params: []paramSpec{
+		stringParam("calendarId", "only this calendar's cached events"),
+	}},
+	"GET /openapi.json": {Summary: "This document"},
+}
+
+// heatmapResponse describes Heatmap: every date in the window, YYYY-MM-DD,
+// mapped to its event count and minutes.
+var heatmapResponse = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"counts": map[string]interface{}{
+			"type":                 "object",
+			"description":          "events starting on each date, keyed YYYY-MM-DD; dates without events are 0",
+			"additionalProperties": map[string]interface{}{"type": "integer"},
+		},
+		"minutes": map[string]interface{}{
+			"type":                 "object",
+			"description":          "minutes of events starting on each date, keyed YYYY-MM-DD",
+			"additionalProperties": map[string]interface{}{"type": "number"},
+		},
+	},
+}
+
+var insertEventBody = []paramSpec{
+	stringParam("calendarId", "calendar to create the event in (default primary)"),
+	requiredParam(stringParam("summary", "title")),
+	stringParam("description", "description"),
+	requiredParam(stringParam("start", "RFC3339 start")),
+	requiredParam(stringParam("end", "RFC3339 end")),
+	{Name: "attendees", Type: "array", Description: "attendee emails"},
+	{Name: "recurrence", Type: "array", Description: "RRULE, EXRULE, RDATE or EXDATE lines"},
+}
+
+// FieldError is one invalid parameter in a 400 response.
+type FieldError struct {
+	Field   string `json:"field"`
+	In      string `json:"in"`
+	Message string `json:"message"`
+}
+
+// checkValue reports what is wrong with v as a value of p, or "".
+func checkValue(p paramSpec, v string) string {
+	switch p.Type {
+	case "integer":
+		if _, err := strconv.Atoi(v); err != nil {
+			return "must be an integer"
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return "must be a number"
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(v); err != nil {
+			return "must be true or false"
+		}
+	}
+	if len(p.Enum) > 0 {
+		for _, allowed := range p.Enum {
+			if v == allowed {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(p.Enum, ", ")
+	}
+	return ""
+}
+
+// checkBodyValue reports what is wrong with a decoded JSON value of p, or "".
+func checkBodyValue(p paramSpec, v interface{}) string {
+	switch p.Type {
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return "must be a string"
+		}
+		return checkValue(p, s)
+	case "integer", "number":
+		if _, ok := v.(float64); !ok {
+			return "must be a number"
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return "must be true or false"
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return "must be an array of strings"
+		}
+		for _, item := range items {
+			if _, ok := item.(string); !ok {
+				return "must be an array of strings"
+			}
+		}
+	}
+	return ""
+}
+
+// validateRequest checks r's query, path and body against op. The body is
+// read and replaced so the handler can still decode it.
+func validateRequest(r *http.Request, op operationSpec) []FieldError {
+	errs := make([]FieldError, 0)
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	for _, p := range op.Params {
+		in, v, given := "query", query.Get(p.Name), query.Get(p.Name) != ""
+		if pv, ok := vars[p.Name]; ok {
+			in, v, given = "path", pv, true
+		}
+		if !given {
+			if p.Required {
+				errs = append(errs, FieldError{Field: p.Name, In: in, Message: "is required"})
+			}
+			continue
+		}
+		if msg := checkValue(p, v); msg != "" {
+			errs = append(errs, FieldError{Field: p.Name, In: in, Message: msg})
+		}
+	}
+
+	if len(op.Body) == 0 || r.Body == nil {
+		return errs
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return errs
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return append(errs, FieldError{Field: "", In: "body", Message: "must be a JSON object"})
+	}
+	for _, p := range op.Body {
+		v, ok := body[p.Name]
+		if !ok || v == nil {
+			if p.Required {
+				errs = append(errs, FieldError{Field: p.Name, In: "body", Message: "is required"})
+			}
+			continue
+		}
+		if msg := checkBodyValue(p, v); msg != "" {
+			errs = append(errs, FieldError{Field: p.Name, In: "body", Message: msg})
+		}
+	}
+	return errs
+}
+
+// routeSpec returns the spec of the route r matched.
+func routeSpec(r *http.Request) (operationSpec, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return operationSpec{}, false
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return operationSpec{}, false
+	}
+	op, ok := apiSpec[r.Method+" "+path]
+	return op, ok
+}
+
+// validateRequests rejects requests whose parameters don't match the route's
+// spec with 400 and an error per field. Parameters the spec doesn't list are
+// left to the handler.
+func validateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, ok := routeSpec(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if errs := validateRequest(r, op); len(errs) > 0 {
+			writeFieldErrors(w, errs)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// openAPISchema renders p as an OpenAPI parameter or property schema.
+func openAPISchema(p paramSpec) map[string]interface{} {
+	schema := map[string]interface{}{"type": p.Type}
+	if p.Type == "array" {
+		schema["items"] = map[string]interface{}{"type": "string"}
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	if p.Description != "" {
+		schema["description"] = p.Description
+	}
+	return schema
+}
+
+// buildOpenAPI describes every route registered on router, taking their
+// parameters from apiSpec. Routes without a spec are still listed, and
+// logged so the gap gets filled.
+func buildOpenAPI(router *mux.Router) (map[string]interface{}, error) {
+	paths := make(map[string]map[string]interface{})
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			op, ok := apiSpec[method+" "+path]
+			if !ok {
+				logger.Warnf("Route %s %s has no OpenAPI description", method, path)
+			}
+			operation := map[string]interface{}{
+				"summary": op.Summary,
+				"responses": map[string]interface{}{
+					"default": map[string]interface{}{"description": "response"},
+					"400": map[string]interface{}{
+						"description": "invalid parameters",
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/ErrorResponse"}},
+						},
+					},
+				},
+			}
+			parameters := make([]map[string]interface{}, 0, len(op.Params))
+			for _, p := range op.Params {
+				in := "query"
+				if strings.Contains(path, "{"+p.Name+"}") {
+					in = "path"
+				}
+				parameters = append(parameters, map[string]interface{}{
+					"name":     p.Name,
+					"in":       in,
+					"required": p.Required || in == "path",
+					"schema":   openAPISchema(p),
+				})
+			}
+			if len(parameters) > 0 {
+				operation["parameters"] = parameters
+			}
+			if op.Response != nil {
+				operation["responses"].(map[string]interface{})["200"] = map[string]interface{}{
+					"description": "success",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": op.Response}},
+				}
+			}
+			if len(op.Body) > 0 {
+				properties := make(map[string]interface{})
+				requiredFields := make([]string, 0)
+				for _, p := range op.Body {
+					properties[p.Name] = openAPISchema(p)
+					if p.Required {
+						requiredFields = append(requiredFields, p.Name)
+					}
+				}
+				schema := map[string]interface{}{"type": "object", "properties": properties}
+				if len(requiredFields) > 0 {
+					schema["required"] = requiredFields
+				}
+				operation["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+				}
+			}
+			if paths[path] == nil {
+				paths[path] = make(map[string]interface{})
+			}
+			paths[path][strings.ToLower(method)] = operation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Flag spec entries left behind by removed routes too.
+	keys := make([]string, 0, len(apiSpec))
+	for key := range apiSpec {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		method, path := key[:strings.Index(key, " ")], key[strings.Index(key, " ")+1:]
+		if _, ok := paths[path][strings.ToLower(method)]; !ok {
+			logger.Warnf("OpenAPI description for %s matches no route", key)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "caltracker", "version": "1.0.0"},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"ErrorResponse": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"code":    map[string]interface{}{"type": "integer"},
+						"message": map[string]interface{}{"type": "string"},
+						"details": map[string]interface{}{"type": "string"},
+						"fields": map[string]interface{}{
+							"type": "array",
+							"items": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"field":   map[string]interface{}{"type": "string"},
+									"in":      map[string]interface{}{"type": "string"},
+									"message": map[string]interface{}{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// openAPIHandler serves the document built from router once at startup.
+func openAPIHandler(router *mux.Router) (http.HandlerFunc, error) {
+	doc, err := buildOpenAPI(router)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build OpenAPI document: %w", err)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode OpenAPI document: %w", err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+	}, nil
+}
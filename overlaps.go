@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// annotateOverlaps sets Overlapping and OverlapsWith on each summary, where
+// summaries[i] describes events[i]. All-day events only overlap other all-day
+// events, since they usually mark days (holidays, leave) rather than time
+// that clashes with meetings. Tasks never overlap.
+func annotateOverlaps(events []calendarEvent, summaries []SummaryEvent, loc *time.Location) {
+	type interval struct {
+		index      int
+		start, end time.Time
+		allDay     bool
+	}
+
+	intervals := make([]interval, 0, len(events))
+	for i, ce := range events {
+		if isTask(ce.Event) {
+			continue
+		}
+		start, end, err := eventSpan(ce.Event, loc)
+		if err != nil {
+			continue
+		}
+		intervals = append(intervals, interval{index: i, start: start, end: end, allDay: isAllDay(ce.Event)})
+	}
+	sort.SliceStable(intervals, func(i, j int) bool { return intervals[i].start.Before(intervals[j].start) })
+
+	for i, a := range intervals {
+		for _, b := range intervals[i+1:] {
+			// Sorted by start, so nothing later can overlap a either.
+			if !b.start.Before(a.end) {
+				break
+			}
+			if a.allDay != b.allDay {
+				continue
+			}
+			sa, sb := &summaries[a.index], &summaries[b.index]
+			sa.Overlapping, sb.Overlapping = true, true
+			sa.OverlapsWith = append(sa.OverlapsWith, sb.ID)
+			sb.OverlapsWith = append(sb.OverlapsWith, sa.ID)
+		}
+	}
+}
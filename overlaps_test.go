@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotateOverlaps(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		timedEvent("standup", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"),
+		timedEvent("review", "Review", "2024-03-04T09:15:00Z", "2024-03-04T10:00:00Z"),
+		timedEvent("sync", "Sync", "2024-03-04T09:45:00Z", "2024-03-04T10:15:00Z"),
+		// Back to back with sync, which isn't an overlap.
+		timedEvent("lunch", "Lunch", "2024-03-04T10:15:00Z", "2024-03-04T11:00:00Z"),
+		allDayEvent("holiday", "Holiday", "2024-03-04", "2024-03-05"),
+		allDayEvent("leave", "Leave", "2024-03-04", "2024-03-06"),
+	)
+
+	events := listCalendar(t, newTestAPI(srv), "/calendar?annotateOverlaps=true&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+	want := map[string][]string{
+		"standup": {"review"},
+		"review":  {"standup", "sync"},
+		"sync":    {"review"},
+		"lunch":   nil,
+		"holiday": {"leave"},
+		"leave":   {"holiday"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("listed %v, want %d events", eventIDs(events), len(want))
+	}
+	for _, event := range events {
+		if !reflect.DeepEqual(event.OverlapsWith, want[event.ID]) || event.Overlapping != (want[event.ID] != nil) {
+			t.Errorf("%s: overlapping %v with %v, want %v", event.ID, event.Overlapping, event.OverlapsWith, want[event.ID])
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// pageParams selects a slice of the /calendar results. A zero Limit returns
+// everything from Offset on.
+type pageParams struct {
+	Limit  int
+	Offset int
+}
+
+// parsePage reads the optional limit and offset query parameters.
+func parsePage(values url.Values) (pageParams, error) {
+	var p pageParams
+	var err error
+	if p.Limit, err = parseIntParam(values, "limit", 0); err != nil {
+		return p, err
+	}
+	if p.Offset, err = parseIntParam(values, "offset", 0); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// paginate returns the requested page of events, reporting the unpaged total
+// in the X-Total-Count header so clients know when to stop.
+func paginate(w http.ResponseWriter, events []SummaryEvent, p pageParams) []SummaryEvent {
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(events)))
+	if p.Offset >= len(events) {
+		return events[:0]
+	}
+	events = events[p.Offset:]
+	if p.Limit > 0 && p.Limit < len(events) {
+		events = events[:p.Limit]
+	}
+	return events
+}
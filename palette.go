@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// defaultPalette is a colorblind-friendly set of colors for charting calendars.
+const defaultPalette = "#4e79a7,#f28e2b,#e15759,#76b7b2,#59a14f,#edc948,#b07aa1,#ff9da7,#9c755f,#bab0ac"
+
+// calendarPalette holds the colors calendars are hashed into, set by the
+// -calendar-palette flag.
+var calendarPalette = strings.Split(defaultPalette, ",")
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// parsePalette reads a comma-separated list of #rrggbb colors.
+func parsePalette(v string) ([]string, error) {
+	palette := make([]string, 0)
+	for _, color := range strings.Split(v, ",") {
+		color = strings.TrimSpace(color)
+		if color == "" {
+			continue
+		}
+		if !hexColor.MatchString(color) {
+			return nil, fmt.Errorf("invalid palette color %q, want #rrggbb", color)
+		}
+		palette = append(palette, strings.ToLower(color))
+	}
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("calendar palette is empty")
+	}
+	return palette, nil
+}
+
+// paletteColor picks a palette color for a calendar by hashing its ID, so a
+// calendar keeps the same color across requests.
+func paletteColor(calendarID string) string {
+	h := fnv.New32a()
+	h.Write([]byte(calendarID))
+	return calendarPalette[h.Sum32()%uint32(len(calendarPalette))]
+}
+
+// calendarColor returns the color to show a calendar in, preferring the
+// calendar's own Google color when useGoogle is set and it has one.
+func calendarColor(entry *calendar.CalendarListEntry, useGoogle bool) string {
+	if useGoogle && entry.BackgroundColor != "" {
+		return entry.BackgroundColor
+	}
+	return paletteColor(entry.Id)
+}
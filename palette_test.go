@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestParsePalette(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"#4E79A7, #f28e2b,", []string{"#4e79a7", "#f28e2b"}, false},
+		{"#fff", nil, true},
+		{"red", nil, true},
+		{" , ", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePalette(tt.in)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePalette(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCalendarColor(t *testing.T) {
+	const team = "team@group.calendar.google.com"
+	entry := ownedCalendar(team, "Team")
+	entry.BackgroundColor = "#9fe1e7"
+	plain := ownedCalendar("side@group.calendar.google.com", "Side")
+
+	tests := []struct {
+		entry     *calendar.CalendarListEntry
+		useGoogle bool
+		want      string
+	}{
+		{entry, true, "#9fe1e7"},
+		{entry, false, paletteColor(team)},
+		{plain, true, paletteColor(plain.Id)},
+	}
+	for _, tt := range tests {
+		if got := calendarColor(tt.entry, tt.useGoogle); got != tt.want {
+			t.Errorf("calendarColor(%s, %t) = %q, want %q", tt.entry.Id, tt.useGoogle, got, tt.want)
+		}
+	}
+
+	// The same calendar keeps its color across requests.
+	srv := newFakeService(primaryCalendar("me@example.com"), plain)
+	srv.addEvents(plain.Id,
+		timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"),
+		timedEvent("b", "Review", "2024-03-05T09:00:00Z", "2024-03-05T09:30:00Z"),
+	)
+	const target = "/calendar?calendars=side@group.calendar.google.com&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"
+	colors := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		for _, event := range listCalendar(t, newTestAPI(srv), target) {
+			colors[event.CalendarColor] = true
+		}
+	}
+	if len(colors) != 1 {
+		t.Errorf("calendar colors %v, want one", colors)
+	}
+	for color := range colors {
+		if !hexColor.MatchString(color) || color != paletteColor(plain.Id) {
+			t.Errorf("calendar color %q isn't the calendar's palette color", color)
+		}
+	}
+}
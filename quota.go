@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Calendar API quota, set by the -api-quota and -api-user-quota flags, in
+// queries per minute as the Google Cloud console shows them. Zero leaves
+// calls unpaced.
+var (
+	apiQuota     float64
+	apiUserQuota float64
+)
+
+// Limiters enforcing the quotas in main, or nil when they are off. The
+// project's calls share the "" bucket; each user has their own.
+var (
+	projectQuotaLimiter *rateLimiter
+	userQuotaLimiter    *rateLimiter
+)
+
+// newQuotaLimiter returns a limiter allowing perMinute calls a minute, with
+// a second's worth allowed at once, or nil for no limit.
+func newQuotaLimiter(perMinute float64) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return newRateLimiter(perMinute/60, int(math.Max(1, perMinute/60)))
+}
+
+// quotaTransport paces Calendar API calls to stay within the project's and
+// user's quotas, so a request fanning out over dozens of calendars waits its
+// turn rather than having calls rejected with rateLimitExceeded. The Go
+// client can't send batch requests, so the calls are spread out instead of
+// combined. Each retry is paced too, as Google counts it.
+type quotaTransport struct {
+	base http.RoundTripper
+	user string
+}
+
+func (t *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := waitForQuota(req.Context(), userQuotaLimiter, t.user); err != nil {
+		return nil, err
+	}
+	if err := waitForQuota(req.Context(), projectQuotaLimiter, ""); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// waitForQuota takes a token from key's bucket, waiting until one is free or
+// ctx ends.
+func waitForQuota(ctx context.Context, l *rateLimiter, key string) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		ok, wait := l.Allow(key)
+		if ok {
+			return nil
+		}
+		googleQuotaWait.Add(wait.Seconds())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// withQuota returns a copy of client whose calls for user are paced by the
+// quota limiters.
+func withQuota(client *http.Client, user string) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	paced := *client
+	paced.Transport = &quotaTransport{base: base, user: user}
+	return &paced
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Per-principal request limits, set by the -rate-limit and -rate-limit-burst
+// flags. A zero rate turns limiting off.
+var (
+	rateLimit      float64
+	rateLimitBurst = 20
+)
+
+// rateLimitSweepInterval is how often buckets idle long enough to have
+// refilled are dropped, so principals seen once don't stay in memory.
+const rateLimitSweepInterval = 10 * time.Minute
+
+// rateLimiter is a token bucket per principal: each holds up to burst
+// requests and refills at rate per second.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket. When it's empty it returns false
+// with how long until the next token.
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that would be full by now. Callers hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// retryAfterSeconds renders a wait as a whole-second Retry-After value.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// recentOrderings maps the by parameter of /events/recent to the event
+// timestamp it orders by.
+var recentOrderings = map[string]func(event *calendar.Event) string{
+	"updated": func(event *calendar.Event) string { return event.Updated },
+	"created": func(event *calendar.Event) string { return event.Created },
+}
+
+const defaultRecentLimit = 20
+
+// recentEvents returns up to limit events, most recently changed first by
+// the given ordering, regardless of when they start. Events without a
+// timestamp sort last.
+func recentEvents(events []calendarEvent, by string, limit int) []calendarEvent {
+	stamp := recentOrderings[by]
+	type stamped struct {
+		ce calendarEvent
+		at time.Time
+	}
+	byStamp := make([]stamped, 0, len(events))
+	for _, ce := range events {
+		at, _ := time.Parse(time.RFC3339, stamp(ce.Event))
+		byStamp = append(byStamp, stamped{ce: ce, at: at})
+	}
+	sort.SliceStable(byStamp, func(i, j int) bool { return byStamp[i].at.After(byStamp[j].at) })
+
+	sorted := make([]calendarEvent, 0, len(byStamp))
+	for _, s := range byStamp {
+		sorted = append(sorted, s.ce)
+	}
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+// listRecent lists the selected calendars' events changed since since,
+// whenever they start. They are read straight from Google, by update time,
+// as the cache and syncer hold events by when they happen. Deleted events,
+// which Google always returns for an updatedMin query, are left out.
+func listRecent(ctx context.Context, srv CalendarService, q eventQuery, since time.Time) ([]calendarEvent, error) {
+	calendars, err := listCalendars(ctx, srv, q)
+	if err != nil {
+		return nil, err
+	}
+	if q.InternalOnly {
+		if q.UserDomain, err = userDomain(ctx, srv); err != nil {
+			return nil, err
+		}
+	}
+
+	events := make([]calendarEvent, 0)
+	for _, userCalendar := range calendars {
+		pageToken := ""
+		for {
+			var page *calendar.Events
+			err := breaker.Do(func() (err error) {
+				page, err = srv.ListEvents(ctx, userCalendar.Id, eventListOptions{
+					SingleEvents: q.SingleEvents,
+					UpdatedMin:   since,
+					OrderBy:      "updated",
+					Query:        q.Search,
+					PageToken:    pageToken,
+					MaxResults:   eventPageSize,
+				})
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to retrieve events from calendar %s: %w", userCalendar.Id, err)
+			}
+			for _, event := range page.Items {
+				if event.Status == "cancelled" || checkEvent(event) != "" || !matchesQuery(event, q) {
+					continue
+				}
+				events = append(events, calendarEvent{Calendar: userCalendar, Event: event})
+			}
+			if page.NextPageToken == "" {
+				break
+			}
+			pageToken = page.NextPageToken
+		}
+	}
+	return events, nil
+}
+
+// RecentHandler returns a "what changed" feed of the events changed since
+// the since parameter, most recently updated (or with by=created, created)
+// first, capped by limit. Unlike other listings it ignores when events
+// start.
+func (a *API) RecentHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	by := values.Get("by")
+	if by == "" {
+		by = "updated"
+	}
+	if _, ok := recentOrderings[by]; !ok {
+		writeError(w, "by must be one of updated, created", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseIntParam(values, "limit", defaultRecentLimit)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit < 1 {
+		writeError(w, "limit must be positive", http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t := now()
+	since := t.Add(-defaultWindow)
+	if v := values.Get("since"); v != "" {
+		if since, err = parseWindowTime(v, t); err != nil {
+			writeError(w, fmt.Sprintf("invalid since %q: %v", v, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := listRecent(ctx, srv, q, since)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	feed := make([]SummaryEvent, 0, limit)
+	for _, ce := range recentEvents(events, by, limit) {
+		summary, err := summarizeEvent(ce, q)
+		if err != nil {
+			logger.Error(err)
+			writeError(w, "unable to summarize events", http.StatusInternalServerError)
+			return
+		}
+		feed = append(feed, summary)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(feed); err != nil {
+		logger.Errorf("Error encoding recent events %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func changedAt(event *calendar.Event, created, updated string) *calendar.Event {
+	event.Created, event.Updated = created, updated
+	return event
+}
+
+func TestRecentHandler(t *testing.T) {
+	setNow(t, time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+	cancelled := changedAt(timedEvent("cancelled", "Dropped", "2024-03-12T09:00:00Z", "2024-03-12T10:00:00Z"), "2024-03-01T00:00:00Z", "2024-03-10T11:00:00Z")
+	cancelled.Status = "cancelled"
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		changedAt(timedEvent("next-year", "Offsite", "2025-01-10T09:00:00Z", "2025-01-10T17:00:00Z"), "2024-03-09T08:00:00Z", "2024-03-09T08:00:00Z"),
+		changedAt(timedEvent("past", "Retro", "2024-02-01T09:00:00Z", "2024-02-01T10:00:00Z"), "2024-01-15T00:00:00Z", "2024-03-10T09:00:00Z"),
+		changedAt(timedEvent("soon", "Planning", "2024-03-11T09:00:00Z", "2024-03-11T10:00:00Z"), "2024-03-05T00:00:00Z", "2024-03-08T00:00:00Z"),
+		// Changed before the default lookback.
+		changedAt(timedEvent("stale", "Standup", "2024-03-11T08:00:00Z", "2024-03-11T08:15:00Z"), "2023-12-01T00:00:00Z", "2023-12-01T00:00:00Z"),
+		cancelled,
+	)
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{"", http.StatusOK, []string{"past", "next-year", "soon"}},
+		{"by=created", http.StatusOK, []string{"next-year", "soon", "past"}},
+		{"limit=2", http.StatusOK, []string{"past", "next-year"}},
+		{"since=2024-03-09T12:00:00Z", http.StatusOK, []string{"past"}},
+		{"by=start", http.StatusBadRequest, nil},
+		{"limit=0", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).RecentHandler, "/events/recent?"+tt.query)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d; body %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var events []SummaryEvent
+			if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+				t.Fatal(err)
+			}
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("feed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+type ReminderBucket struct {
+	Minutes int64 `json:"minutes"`
+	Count   int   `json:"count"`
+}
+
+// ReminderStats summarizes reminder override lead times. Events relying on
+// the calendar's default reminders are counted separately, since their lead
+// times aren't part of the event data.
+type ReminderStats struct {
+	EventsWithOverrides int              `json:"eventsWithOverrides"`
+	EventsUsingDefaults int              `json:"eventsUsingDefaults"`
+	EventsWithoutAny    int              `json:"eventsWithoutReminders"`
+	Overrides           int              `json:"overrides"`
+	MinMinutes          int64            `json:"minMinutes"`
+	MedianMinutes       float64          `json:"medianMinutes"`
+	MaxMinutes          int64            `json:"maxMinutes"`
+	Distribution        []ReminderBucket `json:"distribution"`
+}
+
+// reminderStats aggregates the reminder override lead times across events.
+func reminderStats(events []calendarEvent) ReminderStats {
+	stats := ReminderStats{Distribution: make([]ReminderBucket, 0)}
+	leadTimes := make([]int64, 0)
+	for _, ce := range events {
+		reminders := ce.Event.Reminders
+		switch {
+		case reminders == nil || reminders.UseDefault:
+			stats.EventsUsingDefaults++
+		case len(reminders.Overrides) == 0:
+			stats.EventsWithoutAny++
+		default:
+			stats.EventsWithOverrides++
+			for _, o := range reminders.Overrides {
+				leadTimes = append(leadTimes, o.Minutes)
+			}
+		}
+	}
+	if len(leadTimes) == 0 {
+		return stats
+	}
+
+	sort.Slice(leadTimes, func(i, j int) bool { return leadTimes[i] < leadTimes[j] })
+	stats.Overrides = len(leadTimes)
+	stats.MinMinutes = leadTimes[0]
+	stats.MaxMinutes = leadTimes[len(leadTimes)-1]
+	mid := len(leadTimes) / 2
+	if len(leadTimes)%2 == 0 {
+		stats.MedianMinutes = float64(leadTimes[mid-1]+leadTimes[mid]) / 2
+	} else {
+		stats.MedianMinutes = float64(leadTimes[mid])
+	}
+
+	for _, m := range leadTimes {
+		last := len(stats.Distribution) - 1
+		if last >= 0 && stats.Distribution[last].Minutes == m {
+			stats.Distribution[last].Count++
+			continue
+		}
+		stats.Distribution = append(stats.Distribution, ReminderBucket{Minutes: m, Count: 1})
+	}
+	return stats
+}
+
+// ReminderStatsHandler returns reminder lead-time statistics for the window.
+func (a *API) ReminderStatsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(reminderStats(events)); err != nil {
+		logger.Errorf("Error encoding reminder stats response %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func withReminders(event *calendar.Event, reminders *calendar.EventReminders) *calendar.Event {
+	event.Reminders = reminders
+	return event
+}
+
+func overrides(minutes ...int64) *calendar.EventReminders {
+	r := &calendar.EventReminders{}
+	for _, m := range minutes {
+		r.Overrides = append(r.Overrides, &calendar.EventReminder{Method: "popup", Minutes: m})
+	}
+	return r
+}
+
+func TestReminderStats(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	tests := []struct {
+		name   string
+		events []*calendar.Event
+		want   ReminderStats
+	}{
+		{"none", nil, ReminderStats{Distribution: []ReminderBucket{}}},
+		{"defaults and disabled", []*calendar.Event{
+			timedEvent("a", "A", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+			withReminders(timedEvent("b", "B", "2024-03-04T11:00:00Z", "2024-03-04T12:00:00Z"), &calendar.EventReminders{UseDefault: true}),
+			withReminders(timedEvent("c", "C", "2024-03-04T13:00:00Z", "2024-03-04T14:00:00Z"), overrides()),
+		}, ReminderStats{EventsUsingDefaults: 2, EventsWithoutAny: 1, Distribution: []ReminderBucket{}}},
+		{"odd count", []*calendar.Event{
+			withReminders(timedEvent("a", "A", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"), overrides(30, 10)),
+			withReminders(timedEvent("b", "B", "2024-03-04T11:00:00Z", "2024-03-04T12:00:00Z"), overrides(10)),
+		}, ReminderStats{
+			EventsWithOverrides: 2, Overrides: 3, MinMinutes: 10, MedianMinutes: 10, MaxMinutes: 30,
+			Distribution: []ReminderBucket{{Minutes: 10, Count: 2}, {Minutes: 30, Count: 1}},
+		}},
+		{"even count", []*calendar.Event{
+			withReminders(timedEvent("a", "A", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"), overrides(5, 60)),
+			withReminders(timedEvent("b", "B", "2024-03-04T11:00:00Z", "2024-03-04T12:00:00Z"), overrides(15, 1440)),
+		}, ReminderStats{
+			EventsWithOverrides: 2, Overrides: 4, MinMinutes: 5, MedianMinutes: 37.5, MaxMinutes: 1440,
+			Distribution: []ReminderBucket{{Minutes: 5, Count: 1}, {Minutes: 15, Count: 1}, {Minutes: 60, Count: 1}, {Minutes: 1440, Count: 1}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reminderStats(statsFixtures(cal, tt.events...)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reminderStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
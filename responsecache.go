@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+	etag   string
+	stored time.Time
+}
+
+// renderedCache stores successful responses by user and request URL for ttl.
+type renderedCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedResponse
+	now     func() time.Time
+}
+
+func newRenderedCache(ttl time.Duration) *renderedCache {
+	return &renderedCache{ttl: ttl, entries: make(map[string]cachedResponse), now: time.Now}
+}
+
+// Get returns the response stored under key and how long it stays fresh.
+func (c *renderedCache) Get(key string) (cachedResponse, time.Duration, bool) {
+	if c == nil {
+		return cachedResponse{}, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return cachedResponse{}, 0, false
+	}
+	remaining := c.ttl - c.now().Sub(entry.stored)
+	if remaining <= 0 {
+		delete(c.entries, key)
+		return cachedResponse{}, 0, false
+	}
+	return entry, remaining, true
+}
+
+// Put stores a response, evicting the oldest when the cache is full.
+func (c *renderedCache) Put(key string, resp cachedResponse) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for k, entry := range c.entries {
+			if oldestKey == "" || entry.stored.Before(oldest) {
+				oldestKey, oldest = k, entry.stored
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	resp.stored = c.now()
+	c.entries[key] = resp
+}
+
+// Flush drops every stored response and returns how many there were.
+// Responses span calendars, so any change invalidates all of them.
+func (c *renderedCache) Flush() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[string]cachedResponse)
+	return n
+}
+
+// bufferedResponse captures a handler's response so it can be tagged and
+// stored before being sent.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// responseCacheKey identifies a response by the user it was rendered for and
+// its path and query, with the parameters in a fixed order.
+func responseCacheKey(r *http.Request) string {
+	return accountFromContext(r.Context()) + "|" + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCached sends a stored response, or 304 when the client already has it.
+func writeCached(w http.ResponseWriter, r *http.Request, resp cachedResponse, maxAge time.Duration) {
+	for name, values := range resp.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("ETag", resp.etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge/time.Second)))
+	if etagMatches(r.Header.Get("If-None-Match"), resp.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.body)
+}
+
+// cacheResponses serves repeated requests from the response cache and tags
+// every successful response with an ETag, answering matching If-None-Match
+// requests with 304 Not Modified.
+func (a *API) cacheResponses(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Streams are written as they are fetched, not rendered whole.
+		if r.URL.Query().Get("format") == "ndjson" {
+			next(w, r)
+			return
+		}
+		key := responseCacheKey(r)
+		if a.responses != nil {
+			resp, remaining, ok := a.responses.Get(key)
+			recordCacheLookup("responses", ok)
+			if ok {
+				writeCached(w, r, resp, remaining)
+				return
+			}
+		}
+
+		buf := &bufferedResponse{header: make(http.Header)}
+		next(buf, r)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+		if buf.status != http.StatusOK {
+			for name, values := range buf.header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(buf.body.Bytes())
+		resp := cachedResponse{header: buf.header, body: buf.body.Bytes(), etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+		var maxAge time.Duration
+		if a.responses != nil {
+			a.responses.Put(key, resp)
+			maxAge = a.responses.ttl
+		}
+		writeCached(w, r, resp, maxAge)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Calendar API retry settings, set by the -api-retry-* flags.
+var (
+	apiRetryAttempts = 4
+	apiRetryBackoff  = 500 * time.Millisecond
+)
+
+// maxRetryDelay caps both the backoff and any Retry-After Google asks for.
+const maxRetryDelay = 30 * time.Second
+
+// retryTransport retries Calendar API requests that fail transiently,
+// backing off exponentially with full jitter, or as long as Retry-After
+// says. Rate-limited requests are retried whatever their method since Google
+// didn't act on them; other failures only for idempotent methods.
+type retryTransport struct {
+	base     http.RoundTripper
+	attempts int
+	backoff  time.Duration
+}
+
+// rateLimitReasons are the 403 error reasons Google uses for quota limits.
+var rateLimitReasons = [][]byte{[]byte("rateLimitExceeded"), []byte("userRateLimitExceeded"), []byte("quotaExceeded")}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay := t.backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		retry, rateLimited := t.shouldRetry(req, resp, err)
+		if !retry || attempt >= t.attempts {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		wait := time.Duration(rand.Int63n(int64(delay) + 1))
+		if after, ok := retryAfter(resp); ok {
+			wait = after
+		}
+		if wait > maxRetryDelay {
+			wait = maxRetryDelay
+		}
+		if resp != nil {
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if rateLimited {
+			googleRateLimitRetries.Inc()
+		}
+		loggerFor(req.Context()).Infow("retrying google api call",
+			"url", req.URL.Host+req.URL.Path, "attempt", attempt, "wait", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// shouldRetry reports whether a response or error is worth retrying, and
+// whether it was a rate limit.
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) (retry, rateLimited bool) {
+	if err != nil {
+		return req.Context().Err() == nil && idempotent(req.Method), false
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true, true
+	case resp.StatusCode == http.StatusForbidden:
+		if isRateLimitResponse(resp) {
+			return true, true
+		}
+		return false, false
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return idempotent(req.Method), false
+	}
+	return false, false
+}
+
+// isRateLimitResponse reports whether a 403 names a rate limit reason. The
+// body is read and replaced so the caller can still decode it.
+func isRateLimitResponse(resp *http.Response) bool {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	for _, reason := range rateLimitReasons {
+		if bytes.Contains(body, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotent reports whether repeating a request with method is safe.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryAfter reads a Retry-After header given in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// withRetries returns a copy of client whose requests are retried.
+func withRetries(client *http.Client) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retrying := *client
+	retrying.Transport = &retryTransport{base: base, attempts: apiRetryAttempts, backoff: apiRetryBackoff}
+	return &retrying
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a five-field cron expression: minute, hour, day of month,
+// month and day of week (0 or 7 is Sunday). Fields take *, numbers, ranges
+// such as 1-5, lists and steps such as */15.
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// domAny and dowAny record a * day field. As in cron, when both day
+	// fields are restricted a time matching either runs.
+	domAny, dowAny bool
+}
+
+// cronFields are each field's name and range, in order.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: want 5 fields, got %d", spec, len(parts))
+	}
+	sets := make([]map[int]bool, len(parts))
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %s: %v", spec, cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField expands one field into the values it matches.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", item)
+			}
+			step, item = n, item[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			bounds := strings.SplitN(item, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid range %q", item)
+			}
+		default:
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is outside %d-%d", item, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// matchesDay reports whether the day fields allow t's date.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first minute after t the schedule runs in, in t's
+// location, or the zero time if it never does within a few years (such as
+// for February 30th).
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case !s.month[int(m)]:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
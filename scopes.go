@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+)
+
+// oauthScopes are the scopes requested from Google, set by the -scopes flag.
+// The full calendar scope is needed to create events.
+var oauthScopes = []string{calendar.CalendarScope}
+
+// storedToken is the token file format: the OAuth token plus the scopes it
+// was granted, which oauth2.Token doesn't persist on its own.
+type storedToken struct {
+	*oauth2.Token
+	Scope string `json:"scope,omitempty"`
+}
+
+// grantedScopes returns the scopes recorded for tok, or nil when unknown
+// (e.g. a token file written before scopes were stored).
+func grantedScopes(tok *oauth2.Token) []string {
+	s, _ := tok.Extra("scope").(string)
+	return strings.Fields(s)
+}
+
+// normalizeScopes removes blank and duplicate scopes, keeping order.
+func normalizeScopes(scopes []string) []string {
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		out = append(out, scope)
+	}
+	return out
+}
+
+// scopeCovers reports whether a granted scope includes want. Google scopes
+// nest by suffix, so ".../auth/calendar" covers ".../auth/calendar.readonly".
+func scopeCovers(granted, want string) bool {
+	return granted == want || strings.HasPrefix(want, granted+".")
+}
+
+// missingScopes returns the configured scopes not covered by any granted scope.
+func missingScopes(configured, granted []string) []string {
+	missing := make([]string, 0)
+	for _, want := range normalizeScopes(configured) {
+		covered := false
+		for _, g := range granted {
+			if scopeCovers(g, want) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			missing = append(missing, want)
+		}
+	}
+	return missing
+}
+
+// checkTokenScopes returns an error naming the missing scopes when tok was
+// granted fewer scopes than config requests. A token that doesn't record its
+// scopes, such as one saved before they were stored, can't be shown to cover
+// them, so it has to be re-authorized too.
+func checkTokenScopes(config *oauth2.Config, tok *oauth2.Token) error {
+	granted := grantedScopes(tok)
+	if len(granted) == 0 {
+		return errors.New("stored token doesn't record its scopes and must be re-authorized")
+	}
+	if missing := missingScopes(config.Scopes, granted); len(missing) > 0 {
+		return fmt.Errorf("stored token is missing scopes %s and must be re-authorized", strings.Join(missing, " "))
+	}
+	return nil
+}
+
+// checkStoredToken checks that user has a stored token covering the
+// configured scopes, returning errTokenNotFound when there is none.
+func checkStoredToken(user string) error {
+	tok, err := tokenStore.Get(user)
+	if err != nil {
+		return err
+	}
+	config, err := loadOAuthConfig()
+	if err != nil {
+		return err
+	}
+	return checkTokenScopes(config, tok)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	calendarScope         = "https://www.googleapis.com/auth/calendar"
+	calendarReadonlyScope = "https://www.googleapis.com/auth/calendar.readonly"
+	calendarEventsScope   = "https://www.googleapis.com/auth/calendar.events"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	got := normalizeScopes([]string{calendarScope, " ", " " + calendarScope, calendarEventsScope})
+	want := []string{calendarScope, calendarEventsScope}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeScopes() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckTokenScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured []string
+		granted    string
+		wantErr    bool
+	}{
+		{"same scope", []string{calendarScope}, calendarScope, false},
+		{"broader grant covers narrower", []string{calendarReadonlyScope, calendarEventsScope}, calendarScope, false},
+		{"duplicates configured", []string{calendarReadonlyScope, calendarReadonlyScope}, calendarReadonlyScope + " " + calendarEventsScope, false},
+		{"narrower grant", []string{calendarScope}, calendarReadonlyScope, true},
+		{"one missing", []string{calendarReadonlyScope, calendarEventsScope}, calendarReadonlyScope, true},
+		{"nothing recorded", []string{calendarReadonlyScope}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := &oauth2.Token{AccessToken: "token"}
+			if tt.granted != "" {
+				tok = tok.WithExtra(map[string]interface{}{"scope": tt.granted})
+			}
+			err := checkTokenScopes(&oauth2.Config{Scopes: tt.configured}, tok)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkTokenScopes() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMissingScopes(t *testing.T) {
+	got := missingScopes([]string{calendarReadonlyScope, calendarEventsScope, calendarEventsScope}, []string{calendarReadonlyScope})
+	if want := []string{calendarEventsScope}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingScopes() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// collapseSeries replaces the instances of each recurring series in
+// summaries (parallel to events) with one entry at the first instance's
+// position, carrying the series ID, its recurrence rules, the number of
+// instances and their total minutes.
+func collapseSeries(ctx context.Context, srv CalendarService, events []calendarEvent, summaries []SummaryEvent) []SummaryEvent {
+	collapsed := make([]SummaryEvent, 0, len(summaries))
+	index := make(map[string]int)
+	for i, summary := range summaries {
+		series := events[i].Event.RecurringEventId
+		if series == "" {
+			collapsed = append(collapsed, summary)
+			continue
+		}
+		j, ok := index[series]
+		if !ok {
+			j = len(collapsed)
+			index[series] = j
+			summary.ID = series
+			summary.Recurrence = seriesRecurrence(ctx, srv, events[i].Calendar.Id, series)
+			collapsed = append(collapsed, summary)
+		}
+		collapsed[j].InstanceCount++
+		collapsed[j].TotalTime += summary.EventTime
+	}
+	return collapsed
+}
+
+// seriesRecurrence fetches the RRULE, EXDATE and RDATE lines of a recurring
+// series from its master event, or nil if it can't be read.
+func seriesRecurrence(ctx context.Context, srv CalendarService, calendarID, seriesID string) []string {
+	var master *calendar.Event
+	err := breaker.Do(func() (err error) {
+		master, err = srv.GetEvent(ctx, calendarID, seriesID)
+		return err
+	})
+	if err != nil {
+		logger.Errorf("Unable to read recurrence of series %s: %v", seriesID, err)
+		return nil
+	}
+	return master.Recurrence
+}
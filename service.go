@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// CalendarService is the part of the Calendar API caltracker uses. Handlers
+// only reach Google through it, so tests can substitute a fake.
+type CalendarService interface {
+	// ListCalendars returns a page of the user's calendar list, limited to
+	// calendars they have at least minAccessRole on when it is set.
+	ListCalendars(ctx context.Context, minAccessRole, pageToken string, maxResults int64) (*calendar.CalendarList, error)
+	// GetCalendarListEntry looks up a calendar, or the primary alias, in the
+	// user's calendar list.
+	GetCalendarListEntry(ctx context.Context, calendarID string) (*calendar.CalendarListEntry, error)
+	// GetCalendar reads a calendar's metadata, which works for calendars
+	// that aren't in the user's list.
+	GetCalendar(ctx context.Context, calendarID string) (*calendar.Calendar, error)
+	ListEvents(ctx context.Context, calendarID string, opts eventListOptions) (*calendar.Events, error)
+	GetEvent(ctx context.Context, calendarID, eventID string) (*calendar.Event, error)
+	InsertEvent(ctx context.Context, calendarID string, event *calendar.Event) (*calendar.Event, error)
+	// PatchEvent and DeleteEvent notify attendees per sendUpdates and, when
+	// ifMatch is set, only change an event still at that etag.
+	PatchEvent(ctx context.Context, calendarID, eventID string, patch *calendar.Event, sendUpdates, ifMatch string) (*calendar.Event, error)
+	DeleteEvent(ctx context.Context, calendarID, eventID, sendUpdates, ifMatch string) error
+	WatchEvents(ctx context.Context, calendarID string, channel *calendar.Channel) (*calendar.Channel, error)
+	StopChannel(ctx context.Context, channel *calendar.Channel) error
+	QueryFreeBusy(ctx context.Context, req *calendar.FreeBusyRequest) (*calendar.FreeBusyResponse, error)
+}
+
+// eventListOptions are the Events.List parameters caltracker sets. Zero
+// values are left unset.
+type eventListOptions struct {
+	SingleEvents bool
+	ShowDeleted  bool
+	TimeMin      time.Time
+	TimeMax      time.Time
+	UpdatedMin   time.Time
+	OrderBy      string
+	Query        string
+	SyncToken    string
+	PageToken    string
+	MaxResults   int64
+	// Fields limits the response to these fields, e.g. items(id) when only
+	// counting.
+	Fields []googleapi.Field
+}
+
+// googleCalendarService is CalendarService over the Google API client.
+type googleCalendarService struct {
+	srv *calendar.Service
+}
+
+func (g *googleCalendarService) ListCalendars(ctx context.Context, minAccessRole, pageToken string, maxResults int64) (*calendar.CalendarList, error) {
+	call := g.srv.CalendarList.List().MaxResults(maxResults)
+	if minAccessRole != "" {
+		call = call.MinAccessRole(minAccessRole)
+	}
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
+	return call.Context(ctx).Do()
+}
+
+func (g *googleCalendarService) GetCalendarListEntry(ctx context.Context, calendarID string) (*calendar.CalendarListEntry, error) {
+	return g.srv.CalendarList.Get(calendarID).Context(ctx).Do()
+}
+
+func (g *googleCalendarService) GetCalendar(ctx context.Context, calendarID string) (*calendar.Calendar, error) {
+	return g.srv.Calendars.Get(calendarID).Context(ctx).Do()
+}
+
+func (g *googleCalendarService) ListEvents(ctx context.Context, calendarID string, opts eventListOptions) (*calendar.Events, error) {
+	call := g.srv.Events.List(calendarID).SingleEvents(opts.SingleEvents).ShowDeleted(opts.ShowDeleted)
+	if !opts.TimeMin.IsZero() {
+		call = call.TimeMin(opts.TimeMin.Format(time.RFC3339))
+	}
+	if !opts.TimeMax.IsZero() {
+		call = call.TimeMax(opts.TimeMax.Format(time.RFC3339))
+	}
+	if !opts.UpdatedMin.IsZero() {
+		call = call.UpdatedMin(opts.UpdatedMin.Format(time.RFC3339))
+	}
+	if opts.OrderBy != "" {
+		call = call.OrderBy(opts.OrderBy)
+	}
+	if opts.Query != "" {
+		call = call.Q(opts.Query)
+	}
+	if opts.SyncToken != "" {
+		call = call.SyncToken(opts.SyncToken)
+	}
+	if opts.PageToken != "" {
+		call = call.PageToken(opts.PageToken)
+	}
+	if opts.MaxResults > 0 {
+		call = call.MaxResults(opts.MaxResults)
+	}
+	if len(opts.Fields) > 0 {
+		call = call.Fields(opts.Fields...)
+	}
+	return call.Context(ctx).Do()
+}
+
+func (g *googleCalendarService) GetEvent(ctx context.Context, calendarID, eventID string) (*calendar.Event, error) {
+	return g.srv.Events.Get(calendarID, eventID).Context(ctx).Do()
+}
+
+func (g *googleCalendarService) InsertEvent(ctx context.Context, calendarID string, event *calendar.Event) (*calendar.Event, error) {
+	return g.srv.Events.Insert(calendarID, event).Context(ctx).Do()
+}
+
+func (g *googleCalendarService) PatchEvent(ctx context.Context, calendarID, eventID string, patch *calendar.Event, sendUpdates, ifMatch string) (*calendar.Event, error) {
+	call := g.srv.Events.Patch(calendarID, eventID, patch)
+	if sendUpdates != "" {
+		call = call.SendUpdates(sendUpdates)
+	}
+	if ifMatch != "" {
+		call.Header().Set("If-Match", ifMatch)
+	}
+	return call.Context(ctx).Do()
+}
+
+func (g *googleCalendarService) DeleteEvent(ctx context.Context, calendarID, eventID, sendUpdates, ifMatch string) error {
+	call := g.srv.Events.Delete(calendarID, eventID)
+	if sendUpdates != "" {
+		call = call.SendUpdates(sendUpdates)
+	}
+	if ifMatch != "" {
+		call.Header().Set("If-Match", ifMatch)
+	}
+	return call.Context(ctx).Do()
+}
+
+func (g *googleCalendarService) WatchEvents(ctx context.Context, calendarID string, channel *calendar.Channel) (*calendar.Channel, error) {
+	return g.srv.Events.Watch(calendarID, channel).Context(ctx).Do()
+}
+
+func (g *googleCalendarService) StopChannel(ctx context.Context, channel *calendar.Channel) error {
+	return g.srv.Channels.Stop(channel).Context(ctx).Do()
+}
+
+func (g *googleCalendarService) QueryFreeBusy(ctx context.Context, req *calendar.FreeBusyRequest) (*calendar.FreeBusyResponse, error) {
+	return g.srv.Freebusy.Query(req).Context(ctx).Do()
+}
+
+// serviceProvider hands out the CalendarService for a user.
+type serviceProvider interface {
+	Get(ctx context.Context, user string) (CalendarService, error)
+	Reset(user string)
+}
+
+func newServiceCache() *serviceCache {
+	return &serviceCache{services: make(map[string]*cachedService)}
+}
+
+// serviceCache builds a user's Calendar API client on first use and keeps it
+// for later requests. Its token source refreshes the access token as it
+// expires, so the client stays usable however long it lives.
+type serviceCache struct {
+	mu       sync.Mutex
+	services map[string]*cachedService
+}
+
+// cachedService is built once, by whichever request for the user comes
+// first; concurrent requests wait for it rather than building their own.
+type cachedService struct {
+	once sync.Once
+	srv  CalendarService
+	err  error
+}
+
+// Get returns the user's cached client, building it if there is none yet.
+// Failures aren't cached, so a request after the user authorizes succeeds.
+func (c *serviceCache) Get(ctx context.Context, user string) (CalendarService, error) {
+	c.mu.Lock()
+	cached, ok := c.services[user]
+	if !ok {
+		cached = &cachedService{}
+		c.services[user] = cached
+	}
+	c.mu.Unlock()
+
+	cached.once.Do(func() {
+		cached.srv, cached.err = newCalendarService(ctx, user)
+	})
+	if cached.err != nil {
+		c.mu.Lock()
+		if c.services[user] == cached {
+			delete(c.services, user)
+		}
+		c.mu.Unlock()
+		return nil, cached.err
+	}
+	return cached.srv, nil
+}
+
+// Reset drops the user's cached client so the next request rebuilds it,
+// e.g. after a new token is stored.
+func (c *serviceCache) Reset(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.services, user)
+}
+
+// calendarService returns the Calendar API client for the account the
+// request in ctx acts as. A service account is one account for everyone.
+func (a *API) calendarService(ctx context.Context) (CalendarService, error) {
+	if credentialMode == credentialServiceAccount {
+		return a.services.Get(ctx, "")
+	}
+	return a.services.Get(ctx, accountFromContext(ctx))
+}
+
+// newCalendarService builds a Calendar API client from the user's stored
+// credentials, or from the service account key in service account mode.
+func newCalendarService(ctx context.Context, user string) (CalendarService, error) {
+	var client *http.Client
+	if credentialMode == credentialServiceAccount {
+		var err error
+		if client, err = serviceAccountClient(); err != nil {
+			return nil, err
+		}
+	} else {
+		config, err := loadOAuthConfig()
+		if err != nil {
+			return nil, err
+		}
+		if client, err = getClient(config, user); err != nil {
+			return nil, err
+		}
+	}
+
+	srv, err := calendar.NewService(ctx, option.WithHTTPClient(withRetries(withQuota(withAPILogging(client), user))))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Calendar client: %w", err)
+	}
+	return &googleCalendarService{srv: srv}, nil
+}
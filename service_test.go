@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// fakeCalendarService is an in-memory CalendarService for handler tests.
+// Listings are split into pages of pageSize items when it is set, or of the
+// requested size for calendar lists, and every call's options are recorded.
+type fakeCalendarService struct {
+	mu        sync.Mutex
+	calendars []*calendar.CalendarListEntry
+	events    map[string][]*calendar.Event
+	pageSize  int
+	// err, when set, fails every call.
+	err error
+
+	calendarListCalls []int64
+	listCalls         []eventListOptions
+	inserted          []*calendar.Event
+}
+
+func newFakeService(calendars ...*calendar.CalendarListEntry) *fakeCalendarService {
+	return &fakeCalendarService{calendars: calendars, events: make(map[string][]*calendar.Event)}
+}
+
+// addEvents puts events on the calendar with ID calendarID.
+func (f *fakeCalendarService) addEvents(calendarID string, events ...*calendar.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events[calendarID] = append(f.events[calendarID], events...)
+}
+
+// eventListCalls returns the options of the Events.List calls made so far.
+func (f *fakeCalendarService) eventListCalls() []eventListOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]eventListOptions(nil), f.listCalls...)
+}
+
+var accessRoleRanks = map[string]int{"freeBusyReader": 1, "reader": 2, "writer": 3, "owner": 4}
+
+// page returns the bounds of the page of n items starting at pageToken, of
+// at most size items, and the token of the page after.
+func page(n, size int, pageToken string) (int, int, string) {
+	start, _ := strconv.Atoi(pageToken)
+	end := n
+	if size > 0 && start+size < n {
+		end = start + size
+	}
+	next := ""
+	if end < n {
+		next = strconv.Itoa(end)
+	}
+	return start, end, next
+}
+
+func (f *fakeCalendarService) ListCalendars(_ context.Context, minAccessRole, pageToken string, maxResults int64) (*calendar.CalendarList, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calendarListCalls = append(f.calendarListCalls, maxResults)
+	if f.err != nil {
+		return nil, f.err
+	}
+	matched := make([]*calendar.CalendarListEntry, 0, len(f.calendars))
+	for _, entry := range f.calendars {
+		if minAccessRole == "" || accessRoleRanks[entry.AccessRole] >= accessRoleRanks[minAccessRole] {
+			matched = append(matched, entry)
+		}
+	}
+	size := f.pageSize
+	if maxResults > 0 && (size == 0 || int(maxResults) < size) {
+		size = int(maxResults)
+	}
+	start, end, next := page(len(matched), size, pageToken)
+	return &calendar.CalendarList{Items: matched[start:end], NextPageToken: next}, nil
+}
+
+func (f *fakeCalendarService) entry(calendarID string) (*calendar.CalendarListEntry, error) {
+	for _, entry := range f.calendars {
+		if entry.Id == calendarID || (calendarID == "primary" && entry.Primary) {
+			return entry, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "Not Found"}
+}
+
+func (f *fakeCalendarService) GetCalendarListEntry(_ context.Context, calendarID string) (*calendar.CalendarListEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.entry(calendarID)
+}
+
+func (f *fakeCalendarService) GetCalendar(_ context.Context, calendarID string) (*calendar.Calendar, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	entry, err := f.entry(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	return &calendar.Calendar{Id: entry.Id, Summary: entry.Summary, TimeZone: entry.TimeZone}, nil
+}
+
+// ListEvents returns the calendar's events overlapping TimeMin to TimeMax
+// and updated since UpdatedMin, in the order they were added.
+func (f *fakeCalendarService) ListEvents(_ context.Context, calendarID string, opts eventListOptions) (*calendar.Events, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listCalls = append(f.listCalls, opts)
+	if f.err != nil {
+		return nil, f.err
+	}
+	entry, err := f.entry(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*calendar.Event, 0)
+	for _, event := range f.events[entry.Id] {
+		if !opts.UpdatedMin.IsZero() {
+			updated, err := time.Parse(time.RFC3339, event.Updated)
+			if err != nil || updated.Before(opts.UpdatedMin) {
+				continue
+			}
+		}
+		if start, end, err := eventTimes(event); err == nil {
+			if (!opts.TimeMin.IsZero() && !end.After(opts.TimeMin)) || (!opts.TimeMax.IsZero() && !start.Before(opts.TimeMax)) {
+				continue
+			}
+		}
+		matched = append(matched, event)
+	}
+	start, end, next := page(len(matched), f.pageSize, opts.PageToken)
+	return &calendar.Events{Items: matched[start:end], NextPageToken: next, TimeZone: entry.TimeZone}, nil
+}
+
+func (f *fakeCalendarService) GetEvent(_ context.Context, calendarID, eventID string) (*calendar.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if entry, err := f.entry(calendarID); err == nil {
+		calendarID = entry.Id
+	}
+	for _, event := range f.events[calendarID] {
+		if event.Id == eventID {
+			return event, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "Not Found"}
+}
+
+func (f *fakeCalendarService) InsertEvent(_ context.Context, calendarID string, event *calendar.Event) (*calendar.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	created := *event
+	created.Id = fmt.Sprintf("created%d", len(f.inserted)+1)
+	f.inserted = append(f.inserted, &created)
+	f.events[calendarID] = append(f.events[calendarID], &created)
+	return &created, nil
+}
+
+func (f *fakeCalendarService) PatchEvent(ctx context.Context, calendarID, eventID string, patch *calendar.Event, _, _ string) (*calendar.Event, error) {
+	event, err := f.GetEvent(ctx, calendarID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if patch.Summary != "" {
+		event.Summary = patch.Summary
+	}
+	return event, nil
+}
+
+func (f *fakeCalendarService) DeleteEvent(ctx context.Context, calendarID, eventID, _, _ string) error {
+	_, err := f.GetEvent(ctx, calendarID, eventID)
+	return err
+}
+
+func (f *fakeCalendarService) WatchEvents(_ context.Context, _ string, channel *calendar.Channel) (*calendar.Channel, error) {
+	return channel, f.err
+}
+
+func (f *fakeCalendarService) StopChannel(context.Context, *calendar.Channel) error {
+	return f.err
+}
+
+// QueryFreeBusy reports each requested calendar's events as busy.
+func (f *fakeCalendarService) QueryFreeBusy(ctx context.Context, req *calendar.FreeBusyRequest) (*calendar.FreeBusyResponse, error) {
+	resp := &calendar.FreeBusyResponse{Calendars: make(map[string]calendar.FreeBusyCalendar)}
+	for _, item := range req.Items {
+		timeMin, _ := time.Parse(time.RFC3339, req.TimeMin)
+		timeMax, _ := time.Parse(time.RFC3339, req.TimeMax)
+		events, err := f.ListEvents(ctx, item.Id, eventListOptions{SingleEvents: true, TimeMin: timeMin, TimeMax: timeMax})
+		if err != nil {
+			return nil, err
+		}
+		var busy []*calendar.TimePeriod
+		for _, event := range events.Items {
+			busy = append(busy, &calendar.TimePeriod{Start: event.Start.DateTime, End: event.End.DateTime})
+		}
+		resp.Calendars[item.Id] = calendar.FreeBusyCalendar{Busy: busy}
+	}
+	return resp, nil
+}
+
+// fakeProvider hands every user the same service.
+type fakeProvider struct {
+	srv CalendarService
+}
+
+func (p fakeProvider) Get(context.Context, string) (CalendarService, error) { return p.srv, nil }
+func (p fakeProvider) Reset(string)                                         {}
+
+// newTestAPI returns an API over srv with a fresh circuit breaker, so a
+// failing test can't trip it for the next.
+func newTestAPI(srv CalendarService) *API {
+	breaker = newCircuitBreaker(5, 30*time.Second)
+	return newAPI(fakeProvider{srv: srv})
+}
+
+// setNow fixes the clock at t for the rest of the test.
+func setNow(t *testing.T, at time.Time) {
+	t.Helper()
+	saved := now
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = saved })
+}
+
+// serve runs handler on a GET of target and returns the recorded response.
+func serve(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func ownedCalendar(id, summary string) *calendar.CalendarListEntry {
+	return &calendar.CalendarListEntry{Id: id, Summary: summary, AccessRole: "owner", TimeZone: "UTC", Etag: `"` + id + `"`}
+}
+
+func primaryCalendar(id string) *calendar.CalendarListEntry {
+	entry := ownedCalendar(id, id)
+	entry.Primary = true
+	return entry
+}
+
+// timedEvent returns an event between two RFC3339 times.
+func timedEvent(id, summary, start, end string) *calendar.Event {
+	return &calendar.Event{
+		Id: id, Summary: summary, Status: "confirmed", Updated: start,
+		Start: &calendar.EventDateTime{DateTime: start},
+		End:   &calendar.EventDateTime{DateTime: end},
+	}
+}
+
+// allDayEvent returns an event from start's date until end's, exclusive.
+func allDayEvent(id, summary, start, end string) *calendar.Event {
+	return &calendar.Event{
+		Id: id, Summary: summary, Status: "confirmed",
+		Start: &calendar.EventDateTime{Date: start},
+		End:   &calendar.EventDateTime{Date: end},
+	}
+}
+
+func TestHandlersUseInjectedService(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar("team", "Team"))
+	api := newTestAPI(srv)
+
+	rec := serve(api.CalendarsHandler, "/calendars")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if len(srv.calendarListCalls) != 1 {
+		t.Errorf("CalendarList calls = %d, want 1", len(srv.calendarListCalls))
+	}
+}
+
+func TestServiceCacheDoesNotKeepFailures(t *testing.T) {
+	saved := credentialsFile
+	credentialsFile = filepath.Join(t.TempDir(), "missing.json")
+	defer func() { credentialsFile = saved }()
+
+	cache := newServiceCache()
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get(context.Background(), "alice"); err == nil {
+			t.Fatalf("Get %d succeeded without credentials", i)
+		}
+	}
+	if len(cache.services) != 0 {
+		t.Errorf("cached %d failed services, want none", len(cache.services))
+	}
+}
+
+func TestServiceCacheBuildsOncePerUser(t *testing.T) {
+	cache := newServiceCache()
+	built := &fakeCalendarService{}
+	cache.services["alice"] = &cachedService{srv: built}
+	cache.services["alice"].once.Do(func() {})
+
+	var wg sync.WaitGroup
+	got := make([]CalendarService, 8)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i], _ = cache.Get(context.Background(), "alice")
+		}(i)
+	}
+	wg.Wait()
+	for i, srv := range got {
+		if srv != built {
+			t.Errorf("request %d got a different client", i)
+		}
+	}
+
+	cache.Reset("alice")
+	if _, ok := cache.services["alice"]; ok {
+		t.Error("Reset left the client cached")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/oauth2/google"
+)
+
+// Credential modes selectable with the -credential-mode flag.
+const (
+	credentialOAuth          = "oauth"
+	credentialServiceAccount = "service-account"
+)
+
+// credentialMode selects how the service authenticates to Google: a user's
+// OAuth token, or a service account key read from -credentials.
+var credentialMode = credentialOAuth
+
+// impersonateSubject is the Workspace user a service account acts as through
+// domain-wide delegation, set by the -impersonate flag. Empty uses the
+// service account's own calendars.
+var impersonateSubject string
+
+// parseCredentialMode validates the -credential-mode flag.
+func parseCredentialMode(mode string) (string, error) {
+	switch mode {
+	case credentialOAuth, credentialServiceAccount:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid credential-mode %q: must be %s or %s", mode, credentialOAuth, credentialServiceAccount)
+	}
+}
+
+// serviceAccountClient builds an HTTP client from the service account key in
+// the credentials file, impersonating impersonateSubject when set. The client
+// outlives any one request, so its token source isn't tied to one.
+func serviceAccountClient() (*http.Client, error) {
+	b, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account key: %w", err)
+	}
+	config, err := google.JWTConfigFromJSON(b, oauthScopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse service account key: %w", err)
+	}
+	config.Subject = impersonateSubject
+	return config.Client(context.Background()), nil
+}
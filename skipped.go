@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// skippedEvents records events dropped because they were malformed. Its size
+// is set by the -skipped-log-size flag.
+var skippedEvents = newSkippedLog(200)
+
+type SkippedEvent struct {
+	CalendarID string    `json:"calendarId"`
+	EventID    string    `json:"eventId"`
+	Reason     string    `json:"reason"`
+	At         time.Time `json:"at"`
+}
+
+type SkippedReport struct {
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+	Recent []SkippedEvent `json:"recent"`
+}
+
+// skippedLog keeps running counts of skipped events per reason and the most
+// recent max entries.
+type skippedLog struct {
+	mu      sync.Mutex
+	max     int
+	total   int
+	counts  map[string]int
+	entries []SkippedEvent
+	now     func() time.Time
+}
+
+func newSkippedLog(max int) *skippedLog {
+	return &skippedLog{max: max, counts: make(map[string]int), now: time.Now}
+}
+
+// Record notes a skipped event, dropping the oldest entry when full.
+func (l *skippedLog) Record(calendarID, eventID, reason string) {
+	logger.Infow("skipped event", "calendar", calendarID, "event", eventID, "reason", reason)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total++
+	l.counts[reason]++
+	if l.max <= 0 {
+		return
+	}
+	if len(l.entries) >= l.max {
+		l.entries = l.entries[1:]
+	}
+	l.entries = append(l.entries, SkippedEvent{CalendarID: calendarID, EventID: eventID, Reason: reason, At: l.now()})
+}
+
+// Report returns the counts and recent entries, newest first.
+func (l *skippedLog) Report() SkippedReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := SkippedReport{Total: l.total, Counts: make(map[string]int), Recent: make([]SkippedEvent, 0, len(l.entries))}
+	for reason, n := range l.counts {
+		r.Counts[reason] = n
+	}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		r.Recent = append(r.Recent, l.entries[i])
+	}
+	return r
+}
+
+// SkippedHandler reports the events skipped as malformed since startup.
+func SkippedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(skippedEvents.Report()); err != nil {
+		logger.Errorf("Error encoding skipped report %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestSkippedReport(t *testing.T) {
+	saved, savedMode := skippedEvents, invertedEvents
+	skippedEvents = newSkippedLog(2)
+	invertedEvents = invertedSkip
+	defer func() { skippedEvents, invertedEvents = saved, savedMode }()
+
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		timedEvent("ok", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"),
+		&calendar.Event{Id: "no-start", Summary: "Broken", Status: "confirmed", End: &calendar.EventDateTime{DateTime: "2024-03-04T10:00:00Z"}},
+		timedEvent("garbled", "Garbled", "2024-03-04T11:00:00Z", "tomorrow"),
+		timedEvent("inverted", "Mis-synced", "2024-03-05T10:00:00Z", "2024-03-05T09:00:00Z"),
+	)
+	events := listCalendar(t, newTestAPI(srv), "/calendar?from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+	if got, want := eventIDs(events), []string{"ok"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+
+	rec := serve(SkippedHandler, "/debug/skipped")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var report SkippedReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 3 || len(report.Counts) != 3 {
+		t.Errorf("total %d with counts %v, want 3 across 3 reasons", report.Total, report.Counts)
+	}
+	if report.Counts["missing start time"] != 1 || report.Counts["ends before it starts"] != 1 {
+		t.Errorf("counts = %v", report.Counts)
+	}
+	// Only the two most recent entries are kept, newest first.
+	recent := make([]string, 0, len(report.Recent))
+	for _, entry := range report.Recent {
+		recent = append(recent, entry.EventID)
+	}
+	if want := []string{"inverted", "garbled"}; !reflect.DeepEqual(recent, want) {
+		t.Errorf("recent = %v, want %v", recent, want)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultSlackLimit = 5
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackBlock struct {
+	Type string     `json:"type"`
+	Text *SlackText `json:"text,omitempty"`
+}
+
+// SlackMessage is a Slack incoming-webhook payload. Teams and other tools
+// accepting Slack-compatible webhooks fall back to Text.
+type SlackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// slackOptions configures the message built for format=slack.
+type slackOptions struct {
+	Heading string
+	Limit   int
+}
+
+// parseSlackOptions reads the slackHeading and slackLimit query parameters.
+func parseSlackOptions(values url.Values) (slackOptions, error) {
+	opts := slackOptions{Heading: values.Get("slackHeading")}
+	if opts.Heading == "" {
+		opts.Heading = "Upcoming events"
+	}
+	limit, err := parseIntParam(values, "slackLimit", defaultSlackLimit)
+	if err != nil {
+		return opts, err
+	}
+	if limit == 0 {
+		return opts, fmt.Errorf("invalid slackLimit %q: must be at least 1", values.Get("slackLimit"))
+	}
+	opts.Limit = limit
+	return opts, nil
+}
+
+// buildSlackMessage summarizes the first events of the window, in start
+// order, as a Slack message ready to POST to a webhook.
+func buildSlackMessage(events []calendarEvent, q eventQuery, opts slackOptions) SlackMessage {
+	sorted := make([]calendarEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return eventStart(sorted[i].Event).Before(eventStart(sorted[j].Event))
+	})
+	if len(sorted) > opts.Limit {
+		sorted = sorted[:opts.Limit]
+	}
+
+	msg := SlackMessage{
+		Text: opts.Heading,
+		Blocks: []SlackBlock{
+			{Type: "header", Text: &SlackText{Type: "plain_text", Text: opts.Heading}},
+		},
+	}
+
+	lines := make([]string, 0, len(sorted))
+	for _, ce := range sorted {
+		lines = append(lines, slackLine(ce, q))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "_No events._")
+	}
+	msg.Blocks = append(msg.Blocks, SlackBlock{
+		Type: "section",
+		Text: &SlackText{Type: "mrkdwn", Text: strings.Join(lines, "\n")},
+	})
+	return msg
+}
+
+// slackLine formats one event as a bullet, e.g. "• *Mon Jan 2 09:00* Standup (Work)".
+func slackLine(ce calendarEvent, q eventQuery) string {
+	when := ce.Event.Start.Date + " (all day)"
+	if !isAllDay(ce.Event) {
+		if start, err := time.Parse(time.RFC3339, ce.Event.Start.DateTime); err == nil {
+			when = start.In(q.Location).Format("Mon Jan 2 15:04")
+		} else {
+			when = ce.Event.Start.DateTime
+		}
+	}
+	return fmt.Sprintf("• *%s* %s (%s)", when, truncateSummary(ce.Event.Summary, q.MaxSummaryLen), ce.Calendar.Summary)
+}
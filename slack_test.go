@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildSlackMessage(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	q := eventQuery{Location: time.UTC}
+	tests := []struct {
+		name   string
+		events []calendarEvent
+		opts   slackOptions
+		want   SlackMessage
+	}{
+		{
+			name: "events in start order up to the limit",
+			events: statsFixtures(cal,
+				timedEvent("b", "Review", "2024-03-05T14:00:00Z", "2024-03-05T15:00:00Z"),
+				allDayEvent("c", "Offsite", "2024-03-06", "2024-03-07"),
+				timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:15:00Z"),
+			),
+			opts: slackOptions{Heading: "This week", Limit: 2},
+			want: SlackMessage{
+				Text: "This week",
+				Blocks: []SlackBlock{
+					{Type: "header", Text: &SlackText{Type: "plain_text", Text: "This week"}},
+					{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "• *Mon Mar 4 09:00* Standup (Work)\n• *Tue Mar 5 14:00* Review (Work)"}},
+				},
+			},
+		},
+		{
+			name:   "all-day event",
+			events: statsFixtures(cal, allDayEvent("c", "Offsite", "2024-03-06", "2024-03-07")),
+			opts:   slackOptions{Heading: "Upcoming events", Limit: 5},
+			want: SlackMessage{
+				Text: "Upcoming events",
+				Blocks: []SlackBlock{
+					{Type: "header", Text: &SlackText{Type: "plain_text", Text: "Upcoming events"}},
+					{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "• *2024-03-06 (all day)* Offsite (Work)"}},
+				},
+			},
+		},
+		{
+			name: "no events",
+			opts: slackOptions{Heading: "Upcoming events", Limit: 5},
+			want: SlackMessage{
+				Text: "Upcoming events",
+				Blocks: []SlackBlock{
+					{Type: "header", Text: &SlackText{Type: "plain_text", Text: "Upcoming events"}},
+					{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "_No events._"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildSlackMessage(tt.events, q, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildSlackMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarHandlerSlack(t *testing.T) {
+	at := time.Date(2024, 3, 4, 9, 10, 0, 0, time.UTC)
+	setNow(t, at)
+	tests := []struct {
+		name        string
+		target      string
+		wantTimeMin time.Time
+		want        string
+	}{
+		// Without a window the digest looks ahead from now, so last
+		// week's meeting stays out of "Upcoming events".
+		{"default window looks ahead", "/calendar?format=slack", at,
+			"• *Tue Mar 5 14:00* Review (me@example.com)"},
+		{"requested window", "/calendar?format=slack&from=2024-02-26T00:00:00Z&to=2024-03-11T00:00:00Z", time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+			"• *Tue Feb 27 10:00* Retro (me@example.com)\n• *Tue Mar 5 14:00* Review (me@example.com)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeService(primaryCalendar("me@example.com"))
+			srv.addEvents("me@example.com",
+				timedEvent("retro", "Retro", "2024-02-27T10:00:00Z", "2024-02-27T11:00:00Z"),
+				timedEvent("review", "Review", "2024-03-05T14:00:00Z", "2024-03-05T15:00:00Z"),
+			)
+			rec := serve(newTestAPI(srv).CalendarHandler, tt.target)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			if calls := srv.eventListCalls(); len(calls) == 0 || !calls[0].TimeMin.Equal(tt.wantTimeMin) {
+				t.Errorf("Events.List calls = %+v, want TimeMin %v", calls, tt.wantTimeMin)
+			}
+			var got SlackMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Blocks) != 2 || got.Blocks[0].Text.Text != "Upcoming events" || got.Blocks[1].Text.Text != tt.want {
+				t.Errorf("message = %+v, want upcoming events %q", got, tt.want)
+			}
+		})
+	}
+}
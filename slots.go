@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultSlotSize = 30 * time.Minute
+	// maxSlots bounds the timeline so a tiny slot size over a long window
+	// can't produce an enormous response.
+	maxSlots = 10000
+)
+
+type SlotEvent struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+}
+
+type Slot struct {
+	Start  time.Time   `json:"start"`
+	End    time.Time   `json:"end"`
+	Busy   bool        `json:"busy"`
+	Events []SlotEvent `json:"events,omitempty"`
+}
+
+// buildSlots splits the query window into consecutive slots of size and
+// marks each busy if any event overlaps it, even partially. Events marked
+// free (transparent) don't occupy slots.
+func buildSlots(events []calendarEvent, q eventQuery, size time.Duration) []Slot {
+	slots := make([]Slot, 0)
+	for start := q.TimeMin.In(q.Location); start.Before(q.TimeMax); start = start.Add(size) {
+		end := start.Add(size)
+		if end.After(q.TimeMax) {
+			end = q.TimeMax.In(q.Location)
+		}
+		slots = append(slots, Slot{Start: start, End: end})
+	}
+
+	for _, ce := range events {
+		if isTask(ce.Event) || ce.Event.Transparency == "transparent" {
+			continue
+		}
+		start, end, err := eventSpan(ce.Event, q.Location)
+		if err != nil {
+			continue
+		}
+		for i := range slots {
+			if start.Before(slots[i].End) && end.After(slots[i].Start) {
+				slots[i].Busy = true
+				slots[i].Events = append(slots[i].Events, SlotEvent{ID: ce.Event.Id, Summary: ce.Event.Summary})
+			}
+		}
+	}
+	return slots
+}
+
+// SlotsHandler returns the window as fixed-size busy/free slots, sized by
+// the slotSize duration parameter (30m by default).
+func (a *API) SlotsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size := defaultSlotSize
+	if v := r.URL.Query().Get("slotSize"); v != "" {
+		if size, err = time.ParseDuration(v); err != nil || size < time.Minute {
+			writeError(w, fmt.Sprintf("invalid slotSize %q: must be a duration of at least 1m", v), http.StatusBadRequest)
+			return
+		}
+	}
+	if n := q.TimeMax.Sub(q.TimeMin) / size; n > maxSlots {
+		writeError(w, fmt.Sprintf("window holds %d slots of %v; the limit is %d", n, size, maxSlots), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(buildSlots(events, q, size)); err != nil {
+		logger.Errorf("Error encoding slots response %v", err)
+	}
+}
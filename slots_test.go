@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildSlots(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	free := timedEvent("focus", "Focus (free)", "2024-03-04T10:00:00Z", "2024-03-04T10:30:00Z")
+	free.Transparency = "transparent"
+	events := statsFixtures(cal,
+		timedEvent("standup", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:15:00Z"),
+		timedEvent("review", "Review", "2024-03-04T09:20:00Z", "2024-03-04T09:40:00Z"),
+		free,
+	)
+	q := eventQuery{
+		TimeMin:  time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC),
+		TimeMax:  time.Date(2024, 3, 4, 10, 45, 0, 0, time.UTC),
+		Location: time.UTC,
+	}
+
+	slots := buildSlots(events, q, 30*time.Minute)
+	type slot struct {
+		start  string
+		busy   bool
+		events []string
+	}
+	want := []slot{
+		{"09:00", true, []string{"standup", "review"}},
+		// Partly occupied by the review.
+		{"09:30", true, []string{"review"}},
+		{"10:00", false, nil},
+		// The window ends mid-slot.
+		{"10:30", false, nil},
+	}
+	got := make([]slot, 0, len(slots))
+	for _, s := range slots {
+		var ids []string
+		for _, e := range s.Events {
+			ids = append(ids, e.ID)
+		}
+		got = append(got, slot{s.Start.Format("15:04"), s.Busy, ids})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("slots = %+v, want %+v", got, want)
+	}
+	if end := slots[len(slots)-1].End; !end.Equal(q.TimeMax) {
+		t.Errorf("last slot ends %v, want the window's end %v", end, q.TimeMax)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// groupKeyFuncs extracts the group keys for an event for each supported
+// groupBy value, given its start in the query's time zone. An event may fall
+// into several groups (e.g. one per attendee domain).
+var groupKeyFuncs = map[string]func(ce calendarEvent, start time.Time) []string{
+	"calendar":       func(ce calendarEvent, _ time.Time) []string { return []string{ce.Calendar.Summary} },
+	"organizer":      func(ce calendarEvent, _ time.Time) []string { return []string{eventOrganizer(ce.Event)} },
+	"weekday":        func(_ calendarEvent, start time.Time) []string { return []string{start.Weekday().String()} },
+	"week":           func(_ calendarEvent, start time.Time) []string { return []string{isoWeek(start)} },
+	"attendeeDomain": func(ce calendarEvent, _ time.Time) []string { return attendeeDomains(ce.Event) },
+	"category":       func(ce calendarEvent, _ time.Time) []string { return []string{eventCategory(ce.Event)} },
+	"title":          func(ce calendarEvent, _ time.Time) []string { return []string{ce.Event.Summary} },
+}
+
+// eventColors maps Google's event colorId values to their names, which users
+// commonly use to categorise events.
+var eventColors = map[string]string{
+	"1":  "lavender",
+	"2":  "sage",
+	"3":  "grape",
+	"4":  "flamingo",
+	"5":  "banana",
+	"6":  "tangerine",
+	"7":  "peacock",
+	"8":  "graphite",
+	"9":  "blueberry",
+	"10": "basil",
+	"11": "tomato",
+}
+
+type StatsGroup struct {
+	Key          string  `json:"key"`
+	TotalMinutes float64 `json:"totalMinutes"`
+	Count        int     `json:"count"`
+	// Subscribed is only set when grouping by calendar.
+	Subscribed *bool `json:"subscribed,omitempty"`
+}
+
+type BusiestDay struct {
+	Date         string  `json:"date"`
+	TotalMinutes float64 `json:"totalMinutes"`
+}
+
+// StatsOverview summarises time spent across all events in the range.
+type StatsOverview struct {
+	TotalHours       float64     `json:"totalHours"`
+	Count            int         `json:"count"`
+	AverageMinutes   float64     `json:"averageMinutes"`
+	BusiestDay       *BusiestDay `json:"busiestDay,omitempty"`
+	RecurringPercent float64     `json:"recurringPercent"`
+}
+
+type StatsResponse struct {
+	GroupBy  string        `json:"groupBy"`
+	Groups   []StatsGroup  `json:"groups"`
+	Overview StatsOverview `json:"overview"`
+}
+
+// eventOrganizer returns the organizer's email, or "unknown" if it is missing.
+func eventOrganizer(event *calendar.Event) string {
+	if event.Organizer == nil || event.Organizer.Email == "" {
+		return "unknown"
+	}
+	return strings.ToLower(event.Organizer.Email)
+}
+
+// attendeeDomains returns the distinct email domains of an event's attendees.
+func attendeeDomains(event *calendar.Event) []string {
+	seen := make(map[string]bool)
+	domains := make([]string, 0)
+	for _, attendee := range event.Attendees {
+		domain := emailDomain(attendee.Email)
+		if domain == "" {
+			continue
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return []string{"none"}
+	}
+	return domains
+}
+
+// eventCategory names an event's category from its color, falling back to
+// "default" for events using the calendar color.
+func eventCategory(event *calendar.Event) string {
+	if name, ok := eventColors[event.ColorId]; ok {
+		return name
+	}
+	return "default"
+}
+
+// isoWeek names the ISO week containing t, e.g. 2024-W02.
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// normalizeTitle trims a title, collapses runs of whitespace and lowercases
+// it so titles differing only in case or spacing group together.
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// groupStats totals event minutes and counts per group key, placing events on
+// weekdays and weeks in loc, where all-day events start at local midnight.
+// With normalizeTitles, title keys are normalized
+// before grouping.
+func groupStats(events []calendarEvent, groupBy string, loc *time.Location, normalizeTitles bool) ([]StatsGroup, error) {
+	keysFor := groupKeyFuncs[groupBy]
+	totals := make(map[string]*StatsGroup)
+	for _, ce := range events {
+		if isTask(ce.Event) {
+			continue
+		}
+		start, end, err := eventSpan(ce.Event, loc)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing time from event %s: %w", ce.Event.Id, err)
+		}
+		for _, key := range keysFor(ce, start.In(loc)) {
+			if normalizeTitles && groupBy == "title" {
+				key = normalizeTitle(key)
+			}
+			g, ok := totals[key]
+			if !ok {
+				g = &StatsGroup{Key: key}
+				if groupBy == "calendar" {
+					subscribed := isSubscribed(ce.Calendar)
+					g.Subscribed = &subscribed
+				}
+				totals[key] = g
+			}
+			g.TotalMinutes += end.Sub(start).Minutes()
+			g.Count++
+		}
+	}
+
+	groups := make([]StatsGroup, 0, len(totals))
+	for _, g := range totals {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups, nil
+}
+
+// statsOverview totals the time spent in events, the average event length,
+// the day in loc with the most event time, and the share of time spent in
+// recurring events.
+func statsOverview(events []calendarEvent, loc *time.Location) (StatsOverview, error) {
+	var overview StatsOverview
+	var totalMinutes, recurringMinutes float64
+	perDay := make(map[string]float64)
+	for _, ce := range events {
+		if isTask(ce.Event) {
+			continue
+		}
+		start, end, err := eventSpan(ce.Event, loc)
+		if err != nil {
+			return StatsOverview{}, fmt.Errorf("error parsing time from event %s: %w", ce.Event.Id, err)
+		}
+		minutes := end.Sub(start).Minutes()
+		totalMinutes += minutes
+		overview.Count++
+		if ce.Event.RecurringEventId != "" || len(ce.Event.Recurrence) > 0 {
+			recurringMinutes += minutes
+		}
+		perDay[start.In(loc).Format("2006-01-02")] += minutes
+	}
+
+	overview.TotalHours = totalMinutes / 60
+	if overview.Count > 0 {
+		overview.AverageMinutes = totalMinutes / float64(overview.Count)
+	}
+	if totalMinutes > 0 {
+		overview.RecurringPercent = recurringMinutes / totalMinutes * 100
+	}
+	for date, minutes := range perDay {
+		b := overview.BusiestDay
+		if b == nil || minutes > b.TotalMinutes || (minutes == b.TotalMinutes && date < b.Date) {
+			overview.BusiestDay = &BusiestDay{Date: date, TotalMinutes: minutes}
+		}
+	}
+	return overview, nil
+}
+
+// StatsHandler returns total minutes and event counts per group, grouping by
+// the groupBy query parameter (calendar by default), with an overview of the
+// whole range.
+func (a *API) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	groupBy, err := parseGroupBy(r.URL.Query().Get("groupBy"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	normalizeTitles, err := parseBoolParam(r.URL.Query(), "normalizeTitles", false)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	resp, err := computeStats(events, q, groupBy, normalizeTitles)
+	if err != nil {
+		logger.Error(err)
+		writeError(w, "unable to compute stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Errorf("Error encoding stats response %v", err)
+	}
+}
+
+// parseGroupBy validates the groupBy parameter, defaulting to calendar.
+func parseGroupBy(groupBy string) (string, error) {
+	if groupBy == "" {
+		return "calendar", nil
+	}
+	if _, ok := groupKeyFuncs[groupBy]; !ok {
+		return "", errors.New("groupBy must be one of calendar, organizer, weekday, week, attendeeDomain, category, title")
+	}
+	return groupBy, nil
+}
+
+// computeStats groups the listed events and summarises the whole range.
+func computeStats(events []calendarEvent, q eventQuery, groupBy string, normalizeTitles bool) (StatsResponse, error) {
+	groups, err := groupStats(events, groupBy, q.Location, normalizeTitles)
+	if err != nil {
+		return StatsResponse{}, err
+	}
+	overview, err := statsOverview(events, q.Location)
+	if err != nil {
+		return StatsResponse{}, err
+	}
+	return StatsResponse{GroupBy: groupBy, Groups: groups, Overview: overview}, nil
+}
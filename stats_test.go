@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// statsFixtures returns calendarEvents on cal built from events.
+func statsFixtures(cal *calendar.CalendarListEntry, events ...*calendar.Event) []calendarEvent {
+	c := make([]calendarEvent, 0, len(events))
+	for _, event := range events {
+		c = append(c, calendarEvent{Calendar: cal, Event: event})
+	}
+	return c
+}
+
+func organizedBy(event *calendar.Event, email string) *calendar.Event {
+	event.Organizer = &calendar.EventOrganizer{Email: email}
+	return event
+}
+
+func TestGroupStats(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := statsFixtures(cal,
+		// Monday 09:00-10:00 UTC.
+		organizedBy(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"), "Alice@example.com"),
+		// Monday 16:00-16:30 UTC, already Tuesday in Tokyo.
+		organizedBy(timedEvent("b", "Review", "2024-03-04T16:00:00Z", "2024-03-04T16:30:00Z"), "alice@example.com"),
+		// Wednesday 12:00-12:15 UTC.
+		timedEvent("c", "Lunch", "2024-03-06T12:00:00Z", "2024-03-06T12:15:00Z"),
+	)
+
+	tests := []struct {
+		groupBy string
+		loc     *time.Location
+		want    []StatsGroup
+	}{
+		{"organizer", time.UTC, []StatsGroup{
+			{Key: "alice@example.com", TotalMinutes: 90, Count: 2},
+			{Key: "unknown", TotalMinutes: 15, Count: 1},
+		}},
+		{"weekday", time.UTC, []StatsGroup{
+			{Key: "Monday", TotalMinutes: 90, Count: 2},
+			{Key: "Wednesday", TotalMinutes: 15, Count: 1},
+		}},
+		{"weekday", tokyo, []StatsGroup{
+			{Key: "Monday", TotalMinutes: 60, Count: 1},
+			{Key: "Tuesday", TotalMinutes: 30, Count: 1},
+			{Key: "Wednesday", TotalMinutes: 15, Count: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.groupBy+" in "+tt.loc.String(), func(t *testing.T) {
+			got, err := groupStats(events, tt.groupBy, tt.loc, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "calendar", false},
+		{"organizer", "organizer", false},
+		{"weekday", "weekday", false},
+		{"month", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseGroupBy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseGroupBy(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGroupStatsNormalizeTitles(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	events := statsFixtures(cal,
+		timedEvent("a", "Standup ", "2024-03-04T09:00:00Z", "2024-03-04T09:15:00Z"),
+		timedEvent("b", "standup", "2024-03-05T09:00:00Z", "2024-03-05T09:15:00Z"),
+		timedEvent("c", "Design  Review", "2024-03-06T13:00:00Z", "2024-03-06T14:00:00Z"),
+	)
+	tests := []struct {
+		normalize bool
+		want      []StatsGroup
+	}{
+		{false, []StatsGroup{
+			{Key: "Design  Review", TotalMinutes: 60, Count: 1},
+			{Key: "Standup ", TotalMinutes: 15, Count: 1},
+			{Key: "standup", TotalMinutes: 15, Count: 1},
+		}},
+		{true, []StatsGroup{
+			{Key: "design review", TotalMinutes: 60, Count: 1},
+			{Key: "standup", TotalMinutes: 30, Count: 2},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := groupStats(events, "title", time.UTC, tt.normalize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalize=%t: groupStats() = %+v, want %+v", tt.normalize, got, tt.want)
+		}
+	}
+}
+
+func TestStatsOverview(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	weekly := timedEvent("standup_1", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z")
+	weekly.RecurringEventId = "standup"
+	tests := []struct {
+		name   string
+		events []calendarEvent
+		want   StatsOverview
+	}{
+		{"empty", nil, StatsOverview{}},
+		{"mixed", statsFixtures(cal,
+			weekly,
+			timedEvent("a", "Planning", "2024-03-04T13:00:00Z", "2024-03-04T14:00:00Z"),
+			timedEvent("b", "Offsite prep", "2024-03-05T09:00:00Z", "2024-03-05T11:00:00Z"),
+			timedEvent("c", "Review", "2024-03-06T10:00:00Z", "2024-03-06T10:30:00Z"),
+		), StatsOverview{
+			TotalHours: 4, Count: 4, AverageMinutes: 60,
+			BusiestDay:       &BusiestDay{Date: "2024-03-05", TotalMinutes: 120},
+			RecurringPercent: 12.5,
+		}},
+		// Ties go to the earlier day.
+		{"tied days", statsFixtures(cal,
+			timedEvent("a", "One", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"),
+			timedEvent("b", "Two", "2024-03-04T09:00:00Z", "2024-03-04T10:00:00Z"),
+		), StatsOverview{TotalHours: 2, Count: 2, AverageMinutes: 60, BusiestDay: &BusiestDay{Date: "2024-03-04", TotalMinutes: 60}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := statsOverview(tt.events, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statsOverview() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	const holidays = "holidays@group.v.calendar.google.com"
+	subscribed := ownedCalendar(holidays, "Holidays")
+	subscribed.AccessRole = "reader"
+	srv := newFakeService(primaryCalendar("me@example.com"), subscribed)
+	srv.addEvents("me@example.com",
+		organizedBy(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"), "alice@example.com"),
+		// Sunday of ISO week 10, then Monday of week 11.
+		timedEvent("b", "Prep", "2024-03-10T18:00:00Z", "2024-03-10T19:00:00Z"),
+		timedEvent("c", "Retro", "2024-03-11T15:00:00Z", "2024-03-11T16:00:00Z"),
+	)
+	srv.addEvents(holidays, allDayEvent("h", "Holiday", "2024-03-08", "2024-03-09"))
+	no, yes := false, true
+
+	tests := []struct {
+		query string
+		want  []StatsGroup
+	}{
+		{"calendars=" + holidays, []StatsGroup{
+			{Key: "Holidays", TotalMinutes: 1440, Count: 1, Subscribed: &yes},
+			{Key: "me@example.com", TotalMinutes: 150, Count: 3, Subscribed: &no},
+		}},
+		{"groupBy=week", []StatsGroup{
+			{Key: "2024-W10", TotalMinutes: 90, Count: 2},
+			{Key: "2024-W11", TotalMinutes: 60, Count: 1},
+		}},
+		{"groupBy=organizer", []StatsGroup{
+			{Key: "alice@example.com", TotalMinutes: 30, Count: 1},
+			{Key: "unknown", TotalMinutes: 120, Count: 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).StatsHandler, "/stats?"+tt.query+"&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			var resp StatsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resp.Groups, tt.want) {
+				t.Errorf("groups = %+v, want %+v", resp.Groups, tt.want)
+			}
+		})
+	}
+
+	if rec := serve(newTestAPI(srv).StatsHandler, "/stats?groupBy=month"); rec.Code != http.StatusBadRequest {
+		t.Errorf("groupBy=month: status %d, want 400", rec.Code)
+	}
+}
+
+func TestStatsAllDayInZone(t *testing.T) {
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	// Monday 4 March, the first day of ISO week 10.
+	srv.addEvents("me@example.com", allDayEvent("offsite", "Offsite", "2024-03-04", "2024-03-05"))
+	const window = "&tz=America/New_York&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z"
+
+	tests := []struct {
+		groupBy string
+		wantKey string
+	}{
+		{"weekday", "Monday"},
+		{"week", "2024-W10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).StatsHandler, "/stats?groupBy="+tt.groupBy+window)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			var resp StatsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Groups) != 1 || resp.Groups[0].Key != tt.wantKey {
+				t.Errorf("groups = %+v, want one %s group", resp.Groups, tt.wantKey)
+			}
+			if b := resp.Overview.BusiestDay; b == nil || b.Date != "2024-03-04" {
+				t.Errorf("busiest day = %+v, want 2024-03-04", b)
+			}
+		})
+	}
+}
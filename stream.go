@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// writeTimeout bounds writing each response, set by the -write-timeout flag.
+// Event streams lift it, and the read timeout, for their own request; where
+// the server can't, they end shortly before it rather than being cut off,
+// and clients reconnect.
+var writeTimeout = 15 * time.Second
+
+// streamsClosing is closed when the server starts shutting down, ending open
+// event streams so shutdown doesn't wait out its graceful timeout on them.
+var streamsClosing = make(chan struct{})
+
+// streamKeepAlive is how often an idle event stream sends a comment, so
+// proxies don't close it.
+const streamKeepAlive = 30 * time.Second
+
+// streamNDJSON writes the query's events as newline-delimited JSON, one
+// SummaryEvent per line, flushing each calendar's events as soon as they are
+// fetched instead of buffering the whole range. A failure once streaming has
+// begun ends the stream with an ErrorResponse line.
+func (a *API) streamNDJSON(ctx context.Context, w http.ResponseWriter, srv CalendarService, q eventQuery) {
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	started := false
+	var lastCalendar string
+	err := a.forEachEvent(ctx, srv, q, func(ce calendarEvent) error {
+		summary, err := summarizeEvent(ce, q)
+		if err != nil {
+			return err
+		}
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson; charset=UTF-8")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if flusher != nil && lastCalendar != "" && ce.Calendar.Id != lastCalendar {
+			flusher.Flush()
+		}
+		lastCalendar = ce.Calendar.Id
+		return enc.Encode(summary)
+	})
+	if err != nil && !started {
+		writeUpstreamError(w, err)
+		return
+	}
+	if err != nil {
+		logger.Errorf("Error streaming events %v", err)
+		enc.Encode(ErrorResponse{Code: http.StatusBadGateway, Message: "event stream ended early"})
+		return
+	}
+	if !started {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// writeSSE sends one server-sent event with data encoded as JSON.
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// DeletedEvent identifies an event removed from a calendar.
+type DeletedEvent struct {
+	ID       string `json:"id"`
+	Calendar string `json:"calendar"`
+}
+
+// deadlineWriter is implemented by the server's response writers, which let
+// a handler move its own request's deadlines.
+type deadlineWriter interface {
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+}
+
+// clearDeadlines removes the server's read and write timeouts from w's
+// request, unwrapping middleware to reach the server's writer, and reports
+// whether it could.
+func clearDeadlines(w http.ResponseWriter) bool {
+	for {
+		if d, ok := w.(deadlineWriter); ok {
+			return d.SetReadDeadline(time.Time{}) == nil && d.SetWriteDeadline(time.Time{}) == nil
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// CalendarStreamHandler pushes changes to the selected calendars' events as
+// server-sent events: "changed" with the SummaryEvent, or "deleted". It
+// syncs the calendars every -sync-interval, and changes found by other
+// requests' syncs are pushed too. Nothing is sent for the events as they
+// stand when the stream opens; list those with /calendar.
+func (a *API) CalendarStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if syncer == nil {
+		writeError(w, "event streaming is not enabled", http.StatusNotFound)
+		return
+	}
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	listCtx, cancel := withUpstreamTimeout(ctx)
+	calendars, err := listCalendars(listCtx, srv, q)
+	cancel()
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	selected := make(map[string]*calendar.CalendarListEntry, len(calendars))
+	for _, entry := range calendars {
+		selected[entry.Id] = entry
+	}
+
+	changes, unsubscribe := syncer.Subscribe(accountFromContext(ctx))
+	defer unsubscribe()
+	refresh := func() {
+		for _, entry := range calendars {
+			syncCtx, cancel := withUpstreamTimeout(ctx)
+			if err := syncer.Refresh(syncCtx, srv, entry.Id); err != nil {
+				loggerFor(ctx).Warnf("Unable to sync calendar %s for stream: %v", entry.Id, err)
+			}
+			cancel()
+		}
+	}
+	// Establish the baseline the first changes are measured against.
+	refresh()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 1000\n\n")
+	flusher.Flush()
+
+	var end <-chan time.Time
+	if !clearDeadlines(w) && writeTimeout > 2*time.Second {
+		end = time.After(writeTimeout - time.Second)
+	}
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-streamsClosing:
+			return
+		case <-end:
+			return
+		case <-syncTicker.C:
+			refresh()
+			continue
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case c := <-changes:
+			entry, ok := selected[c.CalendarID]
+			if !ok {
+				continue
+			}
+			if c.Deleted {
+				err = writeSSE(w, "deleted", DeletedEvent{ID: c.Event.Id, Calendar: entry.Summary})
+				break
+			}
+			if checkEvent(c.Event) != "" || !matchesQuery(c.Event, q) {
+				continue
+			}
+			summary, sumErr := summarizeEvent(calendarEvent{Calendar: entry, Event: c.Event}, q)
+			if sumErr != nil {
+				continue
+			}
+			err = writeSSE(w, "changed", summary)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
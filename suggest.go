@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	defaultSuggestWindow = 5 * 24 * time.Hour
+	// suggestStep aligns suggested start times, so meetings start on the
+	// quarter hour.
+	suggestStep         = 15 * time.Minute
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 100
+)
+
+// Working hours applied to every attendee in their own time zone, as minutes
+// after midnight, overridable with the workStart and workEnd parameters.
+var (
+	defaultWorkStart = 9 * 60
+	defaultWorkEnd   = 17 * 60
+)
+
+type SuggestResponse struct {
+	Duration    string            `json:"duration"`
+	TimeZones   map[string]string `json:"timeZones"`
+	Suggestions []Interval        `json:"suggestions"`
+	Errors      map[string]string `json:"errors,omitempty"`
+}
+
+// parseClock parses an HH:MM time of day into minutes after midnight.
+func parseClock(v, name string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be HH:MM", name, v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// workingIntervals returns the working hours, Monday to Friday in loc, that
+// fall within [start, end).
+func workingIntervals(loc *time.Location, start, end time.Time, workStart, workEnd int) []Interval {
+	intervals := make([]Interval, 0)
+	y, m, d := start.In(loc).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, loc); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			continue
+		}
+		from := time.Date(day.Year(), day.Month(), day.Day(), workStart/60, workStart%60, 0, 0, loc)
+		to := time.Date(day.Year(), day.Month(), day.Day(), workEnd/60, workEnd%60, 0, 0, loc)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if from.Before(to) {
+			intervals = append(intervals, Interval{Start: from, End: to})
+		}
+	}
+	return intervals
+}
+
+// intersectIntervals returns the time covered by both a and b, each sorted
+// and non-overlapping.
+func intersectIntervals(a, b []Interval) []Interval {
+	out := make([]Interval, 0)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := a[i].Start, a[i].End
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+		if start.Before(end) {
+			out = append(out, Interval{Start: start, End: end})
+		}
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
+
+// candidateSlots lists up to limit meetings of the given duration within the
+// available intervals, earliest first, starting on multiples of step.
+func candidateSlots(available []Interval, duration, step time.Duration, limit int) []Interval {
+	slots := make([]Interval, 0)
+	for _, iv := range available {
+		start := iv.Start.Truncate(step)
+		if start.Before(iv.Start) {
+			start = start.Add(step)
+		}
+		for ; !start.Add(duration).After(iv.End); start = start.Add(step) {
+			if len(slots) == limit {
+				return slots
+			}
+			slots = append(slots, Interval{Start: start, End: start.Add(duration)})
+		}
+	}
+	return slots
+}
+
+// attendeeLocation looks up the time zone of an attendee's calendar, falling
+// back to def when the calendar can't be read.
+func attendeeLocation(ctx context.Context, srv CalendarService, email string, def *time.Location) *time.Location {
+	var cal *calendar.Calendar
+	err := breaker.Do(func() (err error) {
+		cal, err = srv.GetCalendar(ctx, email)
+		return err
+	})
+	if err != nil || cal.TimeZone == "" {
+		return def
+	}
+	loc, err := time.LoadLocation(cal.TimeZone)
+	if err != nil {
+		return def
+	}
+	return loc
+}
+
+// SuggestHandler proposes meeting times of the requested duration when every
+// attendee is free and within their working hours, earliest first. The
+// search runs from now over window (5d by default).
+func (a *API) SuggestHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	loc, err := parseLocation(values)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attendees, err := parseEmails(values.Get("attendees"), "attendees")
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errCalendarForbidden) {
+			status = http.StatusForbidden
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+	duration := defaultSlotSize
+	if v := values.Get("duration"); v != "" {
+		if duration, err = time.ParseDuration(v); err != nil || duration < 5*time.Minute || duration > 24*time.Hour {
+			writeError(w, fmt.Sprintf("invalid duration %q: must be between 5m and 24h", v), http.StatusBadRequest)
+			return
+		}
+	}
+	start := now().Truncate(suggestStep)
+	end := start.Add(defaultSuggestWindow)
+	if v := values.Get("window"); v != "" {
+		if end, err = parseWindowTime(v, start); err != nil || !end.After(start) {
+			writeError(w, fmt.Sprintf("invalid window %q: must be a length such as 5d or 48h", v), http.StatusBadRequest)
+			return
+		}
+	}
+	workStart, err := parseClock(values.Get("workStart"), "workStart", defaultWorkStart)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	workEnd, err := parseClock(values.Get("workEnd"), "workEnd", defaultWorkEnd)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if workStart >= workEnd {
+		writeError(w, "workStart must be before workEnd", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSuggestLimit
+	if v := values.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxSuggestLimit {
+			writeError(w, fmt.Sprintf("invalid limit %q: must be between 1 and %d", v, maxSuggestLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	byCalendar, errs, err := queryBusy(ctx, srv, attendees, start, end)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	all := make([]Interval, 0)
+	for _, intervals := range byCalendar {
+		all = append(all, intervals...)
+	}
+	available := freeIntervals(mergeIntervals(all), start, end)
+
+	zones := make(map[string]string, len(attendees))
+	for _, email := range attendees {
+		attendeeLoc := attendeeLocation(ctx, srv, email, loc)
+		zones[email] = attendeeLoc.String()
+		available = intersectIntervals(available, workingIntervals(attendeeLoc, start, end, workStart, workEnd))
+	}
+
+	suggestions := candidateSlots(available, duration, suggestStep, limit)
+	for i := range suggestions {
+		suggestions[i].Start, suggestions[i].End = suggestions[i].Start.In(loc), suggestions[i].End.In(loc)
+	}
+	resp := SuggestResponse{Duration: duration.String(), TimeZones: zones, Suggestions: suggestions}
+	if len(errs) > 0 {
+		resp.Errors = errs
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Errorf("Error encoding suggestions %v", err)
+	}
+}
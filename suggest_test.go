@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWorkingIntervals(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		loc        *time.Location
+		start, end string
+		want       []Interval
+	}{
+		// Friday to Monday skips the weekend.
+		{"weekend", time.UTC, "2024-03-08T00:00:00Z", "2024-03-12T00:00:00Z", []Interval{
+			interval(t, "2024-03-08T09:00:00Z", "2024-03-08T17:00:00Z"),
+			interval(t, "2024-03-11T09:00:00Z", "2024-03-11T17:00:00Z"),
+		}},
+		{"clipped to the range", time.UTC, "2024-03-04T12:00:00Z", "2024-03-05T10:00:00Z", []Interval{
+			interval(t, "2024-03-04T12:00:00Z", "2024-03-04T17:00:00Z"),
+			interval(t, "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"),
+		}},
+		{"in the attendee's zone", newYork, "2024-03-04T00:00:00Z", "2024-03-05T00:00:00Z", []Interval{
+			interval(t, "2024-03-04T14:00:00Z", "2024-03-04T22:00:00Z"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := interval(t, tt.start, tt.end)
+			got := workingIntervals(tt.loc, r.Start, r.End, defaultWorkStart, defaultWorkEnd)
+			if len(got) != len(tt.want) {
+				t.Fatalf("workingIntervals() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Start.Equal(tt.want[i].Start) || !got[i].End.Equal(tt.want[i].End) {
+					t.Errorf("interval %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIntersectIntervals(t *testing.T) {
+	a := []Interval{
+		interval(t, "2024-03-04T09:00:00Z", "2024-03-04T12:00:00Z"),
+		interval(t, "2024-03-04T13:00:00Z", "2024-03-04T17:00:00Z"),
+	}
+	tests := []struct {
+		name string
+		b    []Interval
+		want []Interval
+	}{
+		{"disjoint", []Interval{interval(t, "2024-03-04T12:00:00Z", "2024-03-04T13:00:00Z")}, []Interval{}},
+		{"spanning both", []Interval{interval(t, "2024-03-04T11:00:00Z", "2024-03-04T14:00:00Z")}, []Interval{
+			interval(t, "2024-03-04T11:00:00Z", "2024-03-04T12:00:00Z"),
+			interval(t, "2024-03-04T13:00:00Z", "2024-03-04T14:00:00Z"),
+		}},
+		{"several inside one", []Interval{
+			interval(t, "2024-03-04T14:00:00Z", "2024-03-04T14:30:00Z"),
+			interval(t, "2024-03-04T16:00:00Z", "2024-03-04T18:00:00Z"),
+		}, []Interval{
+			interval(t, "2024-03-04T14:00:00Z", "2024-03-04T14:30:00Z"),
+			interval(t, "2024-03-04T16:00:00Z", "2024-03-04T17:00:00Z"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intersectIntervals(a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("intersectIntervals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCandidateSlots(t *testing.T) {
+	available := []Interval{
+		// Too short for a half-hour meeting once aligned to the quarter hour.
+		interval(t, "2024-03-04T09:10:00Z", "2024-03-04T09:40:00Z"),
+		interval(t, "2024-03-04T13:00:00Z", "2024-03-04T14:00:00Z"),
+	}
+	tests := []struct {
+		limit int
+		want  []Interval
+	}{
+		{10, []Interval{
+			interval(t, "2024-03-04T13:00:00Z", "2024-03-04T13:30:00Z"),
+			interval(t, "2024-03-04T13:15:00Z", "2024-03-04T13:45:00Z"),
+			interval(t, "2024-03-04T13:30:00Z", "2024-03-04T14:00:00Z"),
+		}},
+		{1, []Interval{interval(t, "2024-03-04T13:00:00Z", "2024-03-04T13:30:00Z")}},
+	}
+	for _, tt := range tests {
+		if got := candidateSlots(available, 30*time.Minute, suggestStep, tt.limit); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("candidateSlots(limit %d) = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestHandler(t *testing.T) {
+	setNow(t, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	alice := ownedCalendar("alice@example.com", "Alice")
+	bob := ownedCalendar("bob@example.com", "Bob")
+	bob.TimeZone = "America/New_York"
+	srv := newFakeService(alice, bob)
+	srv.addEvents("alice@example.com", timedEvent("a", "Lunch", "2024-03-04T12:00:00Z", "2024-03-04T13:00:00Z"))
+	srv.addEvents("bob@example.com", timedEvent("b", "Standup", "2024-03-04T14:00:00Z", "2024-03-04T15:00:00Z"))
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		// Bob's day starts at 14:00 UTC and his standup takes the first hour.
+		{"attendees=alice@example.com,bob@example.com&limit=2", http.StatusOK, []string{"15:00", "15:15"}},
+		{"attendees=alice@example.com&duration=1h&limit=3", http.StatusOK, []string{"09:00", "09:15", "09:30"}},
+		{"attendees=alice@example.com&duration=1m", http.StatusBadRequest, nil},
+		{"attendees=alice@example.com&workStart=17:00&workEnd=09:00", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).SuggestHandler, "/suggest?"+tt.query)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d; body %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp SuggestResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			starts := make([]string, 0, len(resp.Suggestions))
+			for _, s := range resp.Suggestions {
+				starts = append(starts, s.Start.UTC().Format("15:04"))
+			}
+			if !reflect.DeepEqual(starts, tt.want) {
+				t.Errorf("suggested %v, want %v", starts, tt.want)
+			}
+		})
+	}
+}
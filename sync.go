@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Incremental sync settings, set by the -sync-horizon, -sync-interval,
+// -sync-state and -sync-store flags.
+var (
+	syncHorizon  time.Duration
+	syncInterval = 30 * time.Second
+	// syncStateFile keeps synced calendars across restarts when set.
+	syncStateFile string
+	// syncStoreURL names the database synced calendars are written through
+	// to, as sqlite:path or a postgres:// URL.
+	syncStoreURL string
+)
+
+// syncer keeps calendars' events in step with Google using sync tokens, set
+// up when -sync-horizon is positive. A nil syncer fetches every window.
+var syncer *eventSyncer
+
+// syncedCalendar is the local copy of one calendar's expanded events from
+// syncHorizon ago to syncHorizon ahead, plus the token for fetching what
+// changed since.
+type syncedCalendar struct {
+	mu        sync.Mutex
+	events    map[string]*calendar.Event
+	syncToken string
+	synced    time.Time
+	// since is the start of the first full sync: events are complete from
+	// then on, which can be further back than syncHorizon once history has
+	// built up.
+	since time.Time
+	// until is the end of the last full sync's window. A full sync is
+	// repeated before it comes within half the horizon of now.
+	until time.Time
+	// stale forces the next read to sync, e.g. after a push notification.
+	stale bool
+}
+
+// EventStore holds the synced calendars being worked on by key. A
+// SyncStorage, when configured, keeps a durable copy of them.
+type EventStore interface {
+	Get(key string) (*syncedCalendar, bool)
+	Put(key string, sc *syncedCalendar)
+	Keys() []string
+}
+
+type memoryEventStore struct {
+	mu        sync.Mutex
+	calendars map[string]*syncedCalendar
+}
+
+func newMemoryEventStore() *memoryEventStore {
+	return &memoryEventStore{calendars: make(map[string]*syncedCalendar)}
+}
+
+func (s *memoryEventStore) Get(key string) (*syncedCalendar, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.calendars[key]
+	return sc, ok
+}
+
+func (s *memoryEventStore) Put(key string, sc *syncedCalendar) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calendars[key] = sc
+}
+
+func (s *memoryEventStore) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.calendars))
+	for key := range s.calendars {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type eventSyncer struct {
+	mu    sync.Mutex
+	store EventStore
+	// storage is written through to after every sync, or nil.
+	storage SyncStorage
+
+	subsMu sync.Mutex
+	subs   map[chan syncChange]string // subscriber -> user
+}
+
+func newEventSyncer(store EventStore) *eventSyncer {
+	return &eventSyncer{store: store, subs: make(map[chan syncChange]string)}
+}
+
+// syncChange is an event an incremental sync found added, changed or, when
+// Deleted, cancelled.
+type syncChange struct {
+	CalendarID string
+	Event      *calendar.Event
+	Deleted    bool
+}
+
+// subscriberBuffer is how many changes a subscriber can fall behind by
+// before further ones are dropped for it.
+const subscriberBuffer = 256
+
+// Subscribe returns the changes incremental syncs find in user's calendars
+// from now on, and a function that ends the subscription. A subscriber that
+// falls too far behind misses changes rather than holding up syncs.
+func (s *eventSyncer) Subscribe(user string) (<-chan syncChange, func()) {
+	ch := make(chan syncChange, subscriberBuffer)
+	s.subsMu.Lock()
+	s.subs[ch] = user
+	s.subsMu.Unlock()
+	return ch, func() {
+		s.subsMu.Lock()
+		delete(s.subs, ch)
+		s.subsMu.Unlock()
+	}
+}
+
+// publish hands changes to user's subscribers.
+func (s *eventSyncer) publish(user string, changes []syncChange) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for ch, subscriber := range s.subs {
+		if subscriber != user {
+			continue
+		}
+		for _, c := range changes {
+			select {
+			case ch <- c:
+			default:
+				logger.Warnf("Dropped change to event %s for a slow subscriber", c.Event.Id)
+			}
+		}
+	}
+}
+
+// syncKey identifies a calendar as seen by one user.
+func syncKey(user, calendarID string) string {
+	return user + "|" + calendarID
+}
+
+// entry returns the synced calendar for key, creating an empty one.
+func (s *eventSyncer) entry(key string) *syncedCalendar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.store.Get(key)
+	if !ok {
+		sc = &syncedCalendar{}
+		s.store.Put(key, sc)
+	}
+	return sc
+}
+
+// MarkStale makes the next read of calendarID sync, for every user.
+func (s *eventSyncer) MarkStale(calendarID string) {
+	if s == nil {
+		return
+	}
+	for _, key := range s.store.Keys() {
+		if sc, ok := s.store.Get(key); ok && strings.HasSuffix(key, "|"+calendarID) {
+			sc.mu.Lock()
+			sc.stale = true
+			sc.mu.Unlock()
+		}
+	}
+}
+
+// serves reports whether the syncer can answer q for the calendar: it only
+// keeps expanded instances, so series masters are still listed from Google,
+// and windows starting before its history are too.
+func (s *eventSyncer) serves(ctx context.Context, calendarID string, q eventQuery) bool {
+	if s == nil || !q.SingleEvents {
+		return false
+	}
+	// Refreshing keeps at least half the horizon ahead synced.
+	if q.TimeMax.After(now().Add(syncHorizon / 2)) {
+		return false
+	}
+	if !q.TimeMin.Before(now().Add(-syncHorizon)) {
+		return true
+	}
+	sc, ok := s.store.Get(syncKey(accountFromContext(ctx), calendarID))
+	if !ok {
+		return false
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.syncToken != "" && !sc.since.IsZero() && !q.TimeMin.Before(sc.since)
+}
+
+// Events returns the calendar's events in the query window from the local
+// copy, first syncing it if it is due.
+func (s *eventSyncer) Events(ctx context.Context, srv CalendarService, calendarID string, q eventQuery) ([]*calendar.Event, error) {
+	key := syncKey(accountFromContext(ctx), calendarID)
+	sc := s.entry(key)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if err := s.refresh(ctx, srv, key, sc, calendarID); err != nil {
+		return nil, err
+	}
+	items := make([]*calendar.Event, 0)
+	for _, event := range sc.events {
+		start, end, err := eventTimes(event)
+		// Unparseable events are passed on so they are reported as skipped.
+		if err != nil || (end.After(q.TimeMin) && start.Before(q.TimeMax)) {
+			items = append(items, event)
+		}
+	}
+	sortSyncedEvents(items, q.OrderBy)
+	return items, nil
+}
+
+// Refresh syncs the calendar if it is due, as a read would.
+func (s *eventSyncer) Refresh(ctx context.Context, srv CalendarService, calendarID string) error {
+	key := syncKey(accountFromContext(ctx), calendarID)
+	sc := s.entry(key)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return s.refresh(ctx, srv, key, sc, calendarID)
+}
+
+// refresh syncs sc if it has never been synced, was marked stale, was last
+// synced over syncInterval ago or its window needs extending, writes it
+// through to storage and publishes what changed. Callers hold sc.mu.
+func (s *eventSyncer) refresh(ctx context.Context, srv CalendarService, key string, sc *syncedCalendar, calendarID string) error {
+	if sc.syncToken != "" && !sc.stale && !sc.extending() && now().Sub(sc.synced) < syncInterval {
+		return nil
+	}
+	changes, full, err := sc.sync(ctx, srv, calendarID)
+	if err != nil {
+		return err
+	}
+	if s.storage != nil {
+		// The local copy is current either way; a failed write only costs
+		// a full sync after a restart.
+		if err := s.persist(key, sc, full, changes); err != nil {
+			loggerFor(ctx).Warnf("Unable to store synced calendar %s: %v", calendarID, err)
+		}
+	}
+	if len(changes) > 0 {
+		s.publish(accountFromContext(ctx), changes)
+	}
+	return nil
+}
+
+// sortSyncedEvents orders events as Google would for orderBy, falling back
+// to start time so results are stable.
+func sortSyncedEvents(items []*calendar.Event, orderBy string) {
+	if orderBy == "updated" {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Updated < items[j].Updated })
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool { return eventStart(items[i]).Before(eventStart(items[j])) })
+}
+
+// extending reports whether sc's window ends within half the horizon of now,
+// so the next sync has to be a full one over a later window. Callers hold
+// sc.mu.
+func (sc *syncedCalendar) extending() bool {
+	return now().Add(syncHorizon / 2).After(sc.until)
+}
+
+// sync applies the changes since the last sync, or performs a full sync from
+// syncHorizon ago to syncHorizon ahead when there is no token, Google has
+// expired it or the window needs extending. Every listing is bounded, as
+// other Events.List calls are. It
+// returns the changes an incremental sync found, and whether it was full; a
+// full sync reports no changes, having nothing to compare against. Events
+// from before a repeated full sync's window are kept, so history outlives
+// an expired token.
+func (sc *syncedCalendar) sync(ctx context.Context, srv CalendarService, calendarID string) ([]syncChange, bool, error) {
+	full := sc.syncToken == "" || sc.extending()
+	timeMin, timeMax := now().Add(-syncHorizon), now().Add(syncHorizon)
+	events, token := sc.events, sc.syncToken
+	if full {
+		events, token = make(map[string]*calendar.Event), ""
+	}
+
+	token, changed, err := listChanges(ctx, srv, calendarID, token, timeMin, timeMax, events)
+	var apiErr *googleapi.Error
+	if !full && errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+		// The sync token expired; start over.
+		full = true
+		events = make(map[string]*calendar.Event)
+		token, changed, err = listChanges(ctx, srv, calendarID, "", timeMin, timeMax, events)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to sync events from calendar %s: %w", calendarID, err)
+	}
+
+	if full {
+		for id, event := range sc.events {
+			if _, end, err := eventTimes(event); err == nil && end.Before(timeMin) {
+				if _, ok := events[id]; !ok {
+					events[id] = event
+				}
+			}
+		}
+		if sc.since.IsZero() || sc.since.After(timeMin) {
+			sc.since = timeMin
+		}
+		sc.until = timeMax
+	}
+	sc.events = events
+	sc.syncToken = token
+	sc.synced = now()
+	sc.stale = false
+	if full {
+		return nil, true, nil
+	}
+	changes := make([]syncChange, 0, len(changed))
+	for _, event := range changed {
+		changes = append(changes, syncChange{CalendarID: calendarID, Event: event, Deleted: event.Status == "cancelled"})
+	}
+	return changes, false, nil
+}
+
+// listChanges pages through Events.List, applying each returned event to
+// events and dropping cancelled ones, and returns the next sync token along
+// with the events returned. With no token it lists every expanded event
+// between timeMin and timeMax.
+func listChanges(ctx context.Context, srv CalendarService, calendarID, syncToken string, timeMin, timeMax time.Time, events map[string]*calendar.Event) (string, []*calendar.Event, error) {
+	pageToken := ""
+	changed := make([]*calendar.Event, 0)
+	for {
+		var page *calendar.Events
+		err := breaker.Do(func() (err error) {
+			opts := eventListOptions{SingleEvents: true, PageToken: pageToken, MaxResults: eventPageSize}
+			if syncToken != "" {
+				opts.SyncToken = syncToken
+			} else {
+				opts.TimeMin, opts.TimeMax = timeMin, timeMax
+			}
+			page, err = srv.ListEvents(ctx, calendarID, opts)
+			return err
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		for _, event := range page.Items {
+			if event.Status == "cancelled" {
+				delete(events, event.Id)
+			} else {
+				events[event.Id] = event
+			}
+		}
+		changed = append(changed, page.Items...)
+		if page.NextPageToken == "" {
+			return page.NextSyncToken, changed, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// persistedCalendar is a synced calendar as written to the sync state file.
+type persistedCalendar struct {
+	SyncToken string            `json:"syncToken"`
+	Synced    time.Time         `json:"synced"`
+	Since     time.Time         `json:"since,omitempty"`
+	Until     time.Time         `json:"until,omitempty"`
+	Events    []*calendar.Event `json:"events"`
+}
+
+// persisted copies sc for storage. Callers hold sc.mu.
+func (sc *syncedCalendar) persisted() persistedCalendar {
+	p := persistedCalendar{SyncToken: sc.syncToken, Synced: sc.synced, Since: sc.since, Until: sc.until, Events: make([]*calendar.Event, 0, len(sc.events))}
+	for _, event := range sc.events {
+		p.Events = append(p.Events, event)
+	}
+	return p
+}
+
+// restore puts the persisted calendars in the store.
+func (s *eventSyncer) restore(state map[string]persistedCalendar) {
+	for key, p := range state {
+		events := make(map[string]*calendar.Event, len(p.Events))
+		for _, event := range p.Events {
+			events[event.Id] = event
+		}
+		s.store.Put(key, &syncedCalendar{events: events, syncToken: p.SyncToken, synced: p.Synced, since: p.Since, until: p.Until})
+	}
+}
+
+// Save writes every synced calendar to path, replacing it atomically so a
+// crash mid-write leaves the previous state. Calendars never synced are left
+// out.
+func (s *eventSyncer) Save(path string) error {
+	state := make(map[string]persistedCalendar)
+	for _, key := range s.store.Keys() {
+		sc, ok := s.store.Get(key)
+		if !ok {
+			continue
+		}
+		sc.mu.Lock()
+		if sc.syncToken != "" {
+			state[key] = sc.persisted()
+		}
+		sc.mu.Unlock()
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("unable to encode sync state: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to write sync state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write sync state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write sync state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to write sync state: %w", err)
+	}
+	logger.Infof("Saved sync state for %d calendars to %s", len(state), path)
+	return nil
+}
+
+// Load restores the calendars saved to path. A missing file is no error.
+// Restored calendars sync incrementally on their next read.
+func (s *eventSyncer) Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read sync state: %w", err)
+	}
+	var state map[string]persistedCalendar
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("unable to parse sync state %s: %w", path, err)
+	}
+	s.restore(state)
+	logger.Infof("Restored sync state for %d calendars from %s", len(state), path)
+	return nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/api/calendar/v3"
+)
+
+// SyncStorage keeps a durable copy of synced calendars, written through
+// after every sync, so history survives restarts and windows older than
+// -sync-horizon can still be answered locally.
+type SyncStorage interface {
+	// Load returns every stored calendar by key.
+	Load() (map[string]persistedCalendar, error)
+	// Replace stores a calendar's whole event set, after a full sync.
+	Replace(key string, p persistedCalendar) error
+	// Apply stores the events an incremental sync returned, deleting the
+	// cancelled ones, along with p's token and times; p.Events is unused.
+	Apply(key string, p persistedCalendar, changed []*calendar.Event) error
+	Close() error
+}
+
+// persist writes sc through to storage after a sync. Callers hold sc.mu.
+func (s *eventSyncer) persist(key string, sc *syncedCalendar, full bool, changes []syncChange) error {
+	if full {
+		return s.storage.Replace(key, sc.persisted())
+	}
+	changed := make([]*calendar.Event, 0, len(changes))
+	for _, c := range changes {
+		changed = append(changed, c.Event)
+	}
+	return s.storage.Apply(key, persistedCalendar{SyncToken: sc.syncToken, Synced: sc.synced, Since: sc.since, Until: sc.until}, changed)
+}
+
+// UseStorage restores the calendars in storage and writes later syncs
+// through to it.
+func (s *eventSyncer) UseStorage(storage SyncStorage) error {
+	state, err := storage.Load()
+	if err != nil {
+		return fmt.Errorf("unable to load synced calendars: %w", err)
+	}
+	s.restore(state)
+	s.storage = storage
+	logger.Infof("Restored %d synced calendars from storage", len(state))
+	return nil
+}
+
+// openSyncStorage opens the -sync-store database: sqlite:path, or a
+// postgres:// or postgresql:// URL, bringing its schema up to date.
+func openSyncStorage(spec string) (SyncStorage, error) {
+	var driver, dsn string
+	switch {
+	case strings.HasPrefix(spec, "sqlite:"):
+		driver, dsn = "sqlite3", strings.TrimPrefix(spec, "sqlite:")
+		if dsn == "" {
+			return nil, fmt.Errorf("invalid sync-store %q: missing the database path", spec)
+		}
+	case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"):
+		driver, dsn = "postgres", spec
+	default:
+		return nil, fmt.Errorf("invalid sync-store %q: must be sqlite:path or a postgres:// URL", spec)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sync store: %w", err)
+	}
+	if driver == "sqlite3" {
+		// SQLite allows one writer at a time; queue writes here instead of
+		// failing with SQLITE_BUSY.
+		db.SetMaxOpenConns(1)
+	}
+	store := &sqlSyncStorage{db: db, postgres: driver == "postgres"}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// syncStoreMigrations bring the schema from each version to the next; the
+// database records how many have run. Append new ones, never edit old ones.
+var syncStoreMigrations = []string{
+	`CREATE TABLE sync_calendars (
+		calendar_key TEXT PRIMARY KEY,
+		sync_token TEXT NOT NULL,
+		synced TEXT NOT NULL,
+		since TEXT NOT NULL
+	);
+	CREATE TABLE sync_events (
+		calendar_key TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		PRIMARY KEY (calendar_key, event_id)
+	)`,
+	`ALTER TABLE sync_calendars ADD COLUMN until TEXT NOT NULL DEFAULT ''`,
+}
+
+// sqlSyncStorage stores synced calendars in SQLite or Postgres, one row per
+// calendar and one per event, each event as the JSON Google returned.
+type sqlSyncStorage struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// rebind rewrites ? placeholders as $1, $2, ... for Postgres.
+func (s *sqlSyncStorage) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migrate runs the migrations the database hasn't had yet, each in its own
+// transaction.
+func (s *sqlSyncStorage) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS sync_schema (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("unable to migrate sync store: %w", err)
+	}
+	var version int
+	err := s.db.QueryRow(`SELECT version FROM sync_schema`).Scan(&version)
+	if err == sql.ErrNoRows {
+		if _, err = s.db.Exec(`INSERT INTO sync_schema (version) VALUES (0)`); err != nil {
+			return fmt.Errorf("unable to migrate sync store: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("unable to read sync store schema version: %w", err)
+	}
+	if version > len(syncStoreMigrations) {
+		return fmt.Errorf("sync store schema version %d is newer than this build supports (%d)", version, len(syncStoreMigrations))
+	}
+
+	for i := version; i < len(syncStoreMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("unable to migrate sync store: %w", err)
+		}
+		for _, stmt := range strings.Split(syncStoreMigrations[i], ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("unable to apply sync store migration %d: %w", i+1, err)
+			}
+		}
+		if _, err := tx.Exec(s.rebind(`UPDATE sync_schema SET version = ?`), i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to apply sync store migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("unable to apply sync store migration %d: %w", i+1, err)
+		}
+		logger.Infof("Applied sync store migration %d", i+1)
+	}
+	return nil
+}
+
+func (s *sqlSyncStorage) Load() (map[string]persistedCalendar, error) {
+	state := make(map[string]persistedCalendar)
+	rows, err := s.db.Query(`SELECT calendar_key, sync_token, synced, since, until FROM sync_calendars`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key, token, synced, since, until string
+		if err := rows.Scan(&key, &token, &synced, &since, &until); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p := persistedCalendar{SyncToken: token, Events: make([]*calendar.Event, 0)}
+		// Unparseable times read as zero: a zero synced time syncs on the
+		// next read, a zero since limits the calendar to -sync-horizon and
+		// a zero until makes the next sync a full one.
+		p.Synced, _ = time.Parse(time.RFC3339Nano, synced)
+		p.Since, _ = time.Parse(time.RFC3339Nano, since)
+		p.Until, _ = time.Parse(time.RFC3339Nano, until)
+		state[key] = p
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT calendar_key, event FROM sync_events`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, body string
+		if err := rows.Scan(&key, &body); err != nil {
+			return nil, err
+		}
+		p, ok := state[key]
+		if !ok {
+			continue
+		}
+		event := &calendar.Event{}
+		if err := json.Unmarshal([]byte(body), event); err != nil {
+			return nil, fmt.Errorf("unable to parse stored event in %s: %w", key, err)
+		}
+		p.Events = append(p.Events, event)
+		state[key] = p
+	}
+	return state, rows.Err()
+}
+
+func (s *sqlSyncStorage) Replace(key string, p persistedCalendar) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM sync_events WHERE calendar_key = ?`), key); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.write(tx, key, p, p.Events); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlSyncStorage) Apply(key string, p persistedCalendar, changed []*calendar.Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := s.write(tx, key, p, changed); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// write upserts the calendar's row and events within tx, deleting cancelled
+// events.
+func (s *sqlSyncStorage) write(tx *sql.Tx, key string, p persistedCalendar, events []*calendar.Event) error {
+	_, err := tx.Exec(s.rebind(`INSERT INTO sync_calendars (calendar_key, sync_token, synced, since, until) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (calendar_key) DO UPDATE SET sync_token = excluded.sync_token, synced = excluded.synced, since = excluded.since, until = excluded.until`),
+		key, p.SyncToken, p.Synced.Format(time.RFC3339Nano), p.Since.Format(time.RFC3339Nano), p.Until.Format(time.RFC3339Nano))
+	if err != nil {
+		return err
+	}
+	upsert, err := tx.Prepare(s.rebind(`INSERT INTO sync_events (calendar_key, event_id, event) VALUES (?, ?, ?)
+		ON CONFLICT (calendar_key, event_id) DO UPDATE SET event = excluded.event`))
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+	remove, err := tx.Prepare(s.rebind(`DELETE FROM sync_events WHERE calendar_key = ? AND event_id = ?`))
+	if err != nil {
+		return err
+	}
+	defer remove.Close()
+	for _, event := range events {
+		if event.Status == "cancelled" {
+			if _, err := remove.Exec(key, event.Id); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := upsert.Exec(key, event.Id, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlSyncStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// tlsVersions maps -tls-min-version values to their crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion validates a -tls-min-version value such as "1.2".
+func parseTLSVersion(v string) (uint16, error) {
+	version, ok := tlsVersions[v]
+	if !ok {
+		return 0, fmt.Errorf("invalid TLS version %q: must be 1.0, 1.1, 1.2 or 1.3", v)
+	}
+	return version, nil
+}
+
+// parseCipherSuites resolves a comma-separated list of cipher suite names,
+// e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, accepting only the secure
+// suites crypto/tls implements.
+func parseCipherSuites(v string) ([]uint16, error) {
+	if v == "" {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// newTLSConfig builds the server's TLS configuration. Cipher suites only
+// restrict TLS 1.2 and below; TLS 1.3 suites are not configurable in Go.
+func newTLSConfig(minVersion, cipherSuites string) (*tls.Config, error) {
+	version, err := parseTLSVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := parseCipherSuites(cipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{MinVersion: version, CipherSuites: suites}, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSMinVersion(t *testing.T) {
+	config, err := newTLSConfig("1.2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(HealthHandler))
+	ts.TLS = config
+	// The rejected handshake is expected; keep it out of the test output.
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		version uint16
+		wantErr bool
+	}{
+		{"TLS 1.1", tls.VersionTLS11, true},
+		{"TLS 1.2", tls.VersionTLS12, false},
+		{"TLS 1.3", tls.VersionTLS13, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				MinVersion:         tt.version,
+				MaxVersion:         tt.version,
+			}}}
+			resp, err := client.Get(ts.URL + "/healthz")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GET over %s: %v, want error %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tests := []struct {
+		minVersion, suites string
+		wantErr            bool
+	}{
+		{"1.2", "", false},
+		{"1.3", "", false},
+		{"1.2", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", false},
+		{"1.4", "", true},
+		{"1.2", "TLS_RSA_WITH_RC4_128_SHA", true},
+		{"1.2", "TLS_NOT_A_SUITE", true},
+	}
+	for _, tt := range tests {
+		if _, err := newTLSConfig(tt.minVersion, tt.suites); (err != nil) != tt.wantErr {
+			t.Errorf("newTLSConfig(%q, %q) = %v, want error %v", tt.minVersion, tt.suites, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// encryptedTokenPrefix starts every encrypted token file, telling them apart
+// from plaintext ones written by the file store.
+var encryptedTokenPrefix = []byte("caltracker-aesgcm-v1:")
+
+// parseTokenKey decodes the -token-key flag: a base64 AES-256 key, or with a
+// leading "@" a file holding one.
+func parseTokenKey(v string) ([]byte, error) {
+	if strings.HasPrefix(v, "@") {
+		b, err := ioutil.ReadFile(v[1:])
+		if err != nil {
+			return nil, fmt.Errorf("unable to read token key: %w", err)
+		}
+		v = string(b)
+	}
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil, errors.New("token-store encrypted requires -token-key or CALTRACKER_TOKEN_KEY")
+	}
+	key, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid token key: must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// encryptedTokenStore keeps tokens in the same files as fileTokenStore,
+// sealed with AES-GCM. The user is bound in as additional data, so one
+// user's file can't be swapped in for another's. Plaintext files left from
+// the file store are read and rewritten encrypted.
+type encryptedTokenStore struct {
+	mu    sync.Mutex
+	files fileTokenStore
+	aead  cipher.AEAD
+}
+
+func newEncryptedTokenStore(key []byte) (*encryptedTokenStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token key: %w", err)
+	}
+	return &encryptedTokenStore{aead: aead}, nil
+}
+
+func (s *encryptedTokenStore) Get(user string) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.files.path(user)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(b, encryptedTokenPrefix) {
+		tok, err := tokenFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.write(user, tok); err != nil {
+			return nil, fmt.Errorf("unable to encrypt plaintext token: %w", err)
+		}
+		logger.Infof("Encrypted plaintext token file %s", path)
+		return tok, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b[len(encryptedTokenPrefix):])))
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("token file %s is corrupt", path)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(user))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token file %s: wrong key or tampered file", path)
+	}
+	st := storedToken{Token: &oauth2.Token{}}
+	if err := json.Unmarshal(plain, &st); err != nil {
+		return nil, err
+	}
+	return st.Token.WithExtra(map[string]interface{}{"scope": st.Scope}), nil
+}
+
+func (s *encryptedTokenStore) Save(user string, tok *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(user, tok)
+}
+
+// write seals tok and replaces the user's token file. Callers hold s.mu.
+func (s *encryptedTokenStore) write(user string, tok *oauth2.Token) error {
+	plain, err := json.Marshal(storedToken{Token: tok, Scope: strings.Join(grantedScopes(tok), " ")})
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, []byte(user))
+	out := append(append([]byte{}, encryptedTokenPrefix...), base64.StdEncoding.EncodeToString(sealed)...)
+	if err := ioutil.WriteFile(s.files.path(user), append(out, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to cache oauth token: %w", err)
+	}
+	return nil
+}
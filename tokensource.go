@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Token refresh retry settings, set by the -token-refresh-* flags. These are
+// separate from any retrying of Calendar API calls.
+var (
+	tokenRefreshAttempts = 3
+	tokenRefreshBackoff  = 500 * time.Millisecond
+)
+
+// retryTokenSource retries transient failures from an underlying token
+// source, doubling the delay between attempts.
+type retryTokenSource struct {
+	base     oauth2.TokenSource
+	attempts int
+	backoff  time.Duration
+	sleep    func(time.Duration)
+}
+
+func newRetryTokenSource(base oauth2.TokenSource, attempts int, backoff time.Duration) *retryTokenSource {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &retryTokenSource{base: base, attempts: attempts, backoff: backoff, sleep: time.Sleep}
+}
+
+// Token returns a token from the base source, retrying network errors.
+func (s *retryTokenSource) Token() (*oauth2.Token, error) {
+	delay := s.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var tok *oauth2.Token
+		tok, err = s.base.Token()
+		if err == nil {
+			return tok, nil
+		}
+		if attempt >= s.attempts || !isTransientRefreshError(err) {
+			tokenRefreshes.WithLabelValues("failure").Inc()
+			return nil, err
+		}
+		tokenRefreshes.WithLabelValues("retry").Inc()
+		logger.Warnf("Token refresh failed (attempt %d of %d), retrying in %v: %v", attempt, s.attempts, delay, err)
+		s.sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransientRefreshError reports whether a refresh failure is worth
+// retrying. Rejections from the token endpoint, such as a revoked refresh
+// token, are permanent unless the endpoint itself failed.
+func isTransientRefreshError(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return retrieveErr.Response != nil && retrieveErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// savingTokenSource writes each newly refreshed token back to the token store,
+// so a rotated refresh token survives a restart, and reports a refresh the
+// token endpoint rejects (e.g. a revoked grant) as errNotAuthorized.
+type savingTokenSource struct {
+	base  oauth2.TokenSource
+	user  string
+	mu    sync.Mutex
+	saved *oauth2.Token
+}
+
+func newSavingTokenSource(base oauth2.TokenSource, user string, current *oauth2.Token) *savingTokenSource {
+	return &savingTokenSource{base: base, user: user, saved: current}
+}
+
+// Token returns a token from the base source, saving it if it changed.
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		if isRejectedRefresh(err) {
+			return nil, fmt.Errorf("%w: token refresh rejected: %v", errNotAuthorized, err)
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved != nil && tok.AccessToken == s.saved.AccessToken {
+		return tok, nil
+	}
+	tokenRefreshes.WithLabelValues("success").Inc()
+	// Refresh responses don't always repeat the granted scopes.
+	if len(grantedScopes(tok)) == 0 && s.saved != nil {
+		if scope, ok := s.saved.Extra("scope").(string); ok {
+			tok = tok.WithExtra(map[string]interface{}{"scope": scope})
+		}
+	}
+	if err := tokenStore.Save(s.user, tok); err != nil {
+		logger.Errorf("Unable to save refreshed token: %v", err)
+	}
+	s.saved = tok
+	return tok, nil
+}
+
+// isRejectedRefresh reports whether the token endpoint refused to refresh,
+// meaning the user has to authorize again.
+func isRejectedRefresh(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && !isTransientRefreshError(err)
+}
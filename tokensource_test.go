@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// scriptedTokenSource fails with each of errs in turn, then succeeds.
+type scriptedTokenSource struct {
+	errs  []error
+	calls int
+}
+
+func (s *scriptedTokenSource) Token() (*oauth2.Token, error) {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return nil, s.errs[s.calls-1]
+	}
+	return &oauth2.Token{AccessToken: "fresh"}, nil
+}
+
+func TestRetryTokenSource(t *testing.T) {
+	transient := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	unavailable := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}
+	revoked := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}}
+
+	tests := []struct {
+		name       string
+		errs       []error
+		wantErr    bool
+		wantCalls  int
+		wantSleeps []time.Duration
+	}{
+		{"first try", nil, false, 1, nil},
+		{"transient then success", []error{transient}, false, 2, []time.Duration{time.Second}},
+		{"endpoint failure then success", []error{unavailable, transient}, false, 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"rejection isn't retried", []error{revoked}, true, 1, nil},
+		{"gives up after the attempts", []error{transient, transient, transient}, true, 3, []time.Duration{time.Second, 2 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &scriptedTokenSource{errs: tt.errs}
+			src := newRetryTokenSource(base, 3, time.Second)
+			var sleeps []time.Duration
+			src.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+			tok, err := src.Token()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Token() = %v, %v; want error %v", tok, err, tt.wantErr)
+			}
+			if base.calls != tt.wantCalls {
+				t.Errorf("made %d attempts, want %d", base.calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(sleeps, tt.wantSleeps) {
+				t.Errorf("slept %v, want %v", sleeps, tt.wantSleeps)
+			}
+		})
+	}
+}
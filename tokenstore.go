@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// errTokenNotFound is returned by a TokenStore without a token for the user.
+var errTokenNotFound = errors.New("no token stored")
+
+// TokenStore keeps an OAuth token per user. The empty user is the single
+// account the service acts as when API authentication is off.
+type TokenStore interface {
+	Get(user string) (*oauth2.Token, error)
+	Save(user string, tok *oauth2.Token) error
+}
+
+// tokenStore holds every user's Google token, chosen by the -token-store flag.
+var tokenStore TokenStore = &fileTokenStore{}
+
+// accountFromContext returns the user whose Google account a request acts
+// as: the authenticated caller, or "" when API authentication is off.
+func accountFromContext(ctx context.Context) string {
+	if p, ok := principalFromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// fileTokenStore keeps the empty user's token in the -token file and other
+// users' tokens next to it, one file per user.
+type fileTokenStore struct {
+	mu sync.Mutex
+}
+
+// path names user's token file after the hex of their ID, which is safe in a
+// file name on any filesystem and, unlike replacing unsafe characters, gives
+// every user a file of their own.
+func (s *fileTokenStore) path(user string) string {
+	if user == "" {
+		return tokenFile
+	}
+	ext := filepath.Ext(tokenFile)
+	base := strings.TrimSuffix(filepath.Base(tokenFile), ext)
+	return filepath.Join(filepath.Dir(tokenFile), base+"-"+hex.EncodeToString([]byte(user))+ext)
+}
+
+func (s *fileTokenStore) Get(user string) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, err := tokenFromFile(s.path(user))
+	if os.IsNotExist(err) {
+		return nil, errTokenNotFound
+	}
+	return tok, err
+}
+
+func (s *fileTokenStore) Save(user string, tok *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return saveToken(s.path(user), tok)
+}
+
+// memoryTokenStore keeps tokens only for the life of the process.
+type memoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+}
+
+func newMemoryTokenStore() *memoryTokenStore {
+	return &memoryTokenStore{tokens: make(map[string]*oauth2.Token)}
+}
+
+func (s *memoryTokenStore) Get(user string) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, ok := s.tokens[user]
+	if !ok {
+		return nil, errTokenNotFound
+	}
+	return tok, nil
+}
+
+func (s *memoryTokenStore) Save(user string, tok *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[user] = tok
+	return nil
+}
+
+// newTokenStore builds the token store named by the -token-store flag. key
+// is the -token-key flag, only used by the encrypted store.
+func newTokenStore(kind, key string) (TokenStore, error) {
+	switch kind {
+	case "file":
+		return &fileTokenStore{}, nil
+	case "memory":
+		return newMemoryTokenStore(), nil
+	case "encrypted":
+		k, err := parseTokenKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return newEncryptedTokenStore(k)
+	default:
+		return nil, fmt.Errorf("invalid token-store %q: must be file, encrypted or memory", kind)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+)
+
+type CalendarTotal struct {
+	Calendar     string  `json:"calendar"`
+	TotalMinutes float64 `json:"totalMinutes"`
+	EventCount   int     `json:"eventCount"`
+}
+
+// AggregateTotals sums the whole listing, with a per-calendar breakdown.
+type AggregateTotals struct {
+	TotalEvents  int             `json:"totalEvents"`
+	TotalMinutes float64         `json:"totalMinutes"`
+	Calendars    []CalendarTotal `json:"calendars"`
+}
+
+// aggregateTotals adds up per-calendar totals.
+func aggregateTotals(totals []CalendarTotal) AggregateTotals {
+	agg := AggregateTotals{Calendars: totals}
+	for _, t := range totals {
+		agg.TotalEvents += t.EventCount
+		agg.TotalMinutes += t.TotalMinutes
+	}
+	return agg
+}
+
+// calendarTotals sums event minutes and counts per calendar as events are
+// fetched, without keeping the events themselves. Tasks are counted but add
+// no minutes.
+func (a *API) calendarTotals(ctx context.Context, srv CalendarService, q eventQuery) ([]CalendarTotal, error) {
+	totals := make([]CalendarTotal, 0)
+	index := make(map[string]int)
+	err := a.forEachEvent(ctx, srv, q, func(ce calendarEvent) error {
+		i, ok := index[ce.Calendar.Id]
+		if !ok {
+			i = len(totals)
+			index[ce.Calendar.Id] = i
+			totals = append(totals, CalendarTotal{Calendar: ce.Calendar.Summary})
+		}
+		totals[i].EventCount++
+		if isTask(ce.Event) {
+			return nil
+		}
+		start, end, err := eventTimes(ce.Event)
+		if err != nil {
+			logger.Warnf("Skipping duration of event %s: %v", ce.Event.Id, err)
+			return nil
+		}
+		totals[i].TotalMinutes += end.Sub(start).Minutes()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCalendarTotals(t *testing.T) {
+	const team = "team@group.calendar.google.com"
+	srv := newFakeService(primaryCalendar("me@example.com"), ownedCalendar(team, "Team"))
+	// Tasks are counted but add no minutes.
+	task := timedEvent("task", "File expenses", "2024-03-04T17:00:00Z", "2024-03-04T18:00:00Z")
+	task.EventType = "task"
+	srv.addEvents("me@example.com",
+		timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:15:00Z"),
+		timedEvent("b", "Planning", "2024-03-05T13:00:00Z", "2024-03-05T14:30:00Z"),
+		task,
+	)
+	srv.addEvents(team,
+		timedEvent("c", "Retro", "2024-03-06T15:00:00Z", "2024-03-06T16:00:00Z"),
+		allDayEvent("d", "Offsite", "2024-03-07", "2024-03-08"),
+	)
+	const window = "&includeTasks=true&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z&calendars=" + team
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{"format=totals", &[]CalendarTotal{
+			{Calendar: "me@example.com", TotalMinutes: 105, EventCount: 3},
+			{Calendar: "Team", TotalMinutes: 60 + 24*60, EventCount: 2},
+		}},
+		{"aggregate=true", &AggregateTotals{TotalEvents: 5, TotalMinutes: 105 + 60 + 24*60, Calendars: []CalendarTotal{
+			{Calendar: "me@example.com", TotalMinutes: 105, EventCount: 3},
+			{Calendar: "Team", TotalMinutes: 60 + 24*60, EventCount: 2},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).CalendarHandler, "/calendar?"+tt.query+window)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			got := reflect.New(reflect.TypeOf(tt.want).Elem()).Interface()
+			if err := json.Unmarshal(rec.Body.Bytes(), got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultMinBuffer is the travel time expected between differently located
+// events when the request doesn't set minBuffer.
+const defaultMinBuffer = 15 * time.Minute
+
+type TravelLeg struct {
+	Summary  string    `json:"summary"`
+	Location string    `json:"location"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+type TravelGap struct {
+	From         TravelLeg `json:"from"`
+	To           TravelLeg `json:"to"`
+	GapMinutes   float64   `json:"gapMinutes"`
+	Insufficient bool      `json:"insufficient"`
+}
+
+// travelGaps pairs each timed, located event with the next one starting the
+// same day in loc and reports the gap between them when their locations
+// differ. Gaps shorter than minBuffer, including overlaps, are flagged.
+func travelGaps(events []calendarEvent, loc *time.Location, minBuffer time.Duration) []TravelGap {
+	legs := make([]TravelLeg, 0)
+	for _, ce := range events {
+		if isTask(ce.Event) || isAllDay(ce.Event) || strings.TrimSpace(ce.Event.Location) == "" {
+			continue
+		}
+		start, end, err := eventTimes(ce.Event)
+		if err != nil {
+			continue
+		}
+		legs = append(legs, TravelLeg{
+			Summary:  ce.Event.Summary,
+			Location: strings.TrimSpace(ce.Event.Location),
+			Start:    start.In(loc),
+			End:      end.In(loc),
+		})
+	}
+	sort.SliceStable(legs, func(i, j int) bool { return legs[i].Start.Before(legs[j].Start) })
+
+	gaps := make([]TravelGap, 0)
+	for i := 1; i < len(legs); i++ {
+		from, to := legs[i-1], legs[i]
+		if strings.EqualFold(from.Location, to.Location) || from.End.Format(dateLayout) != to.Start.Format(dateLayout) {
+			continue
+		}
+		gap := to.Start.Sub(from.End)
+		gaps = append(gaps, TravelGap{
+			From:         from,
+			To:           to,
+			GapMinutes:   gap.Minutes(),
+			Insufficient: gap < minBuffer,
+		})
+	}
+	return gaps
+}
+
+// TravelHandler reports the gaps between consecutive events held at
+// different locations, flagging those shorter than the minBuffer duration.
+func (a *API) TravelHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minBuffer := defaultMinBuffer
+	if v := r.URL.Query().Get("minBuffer"); v != "" {
+		if minBuffer, err = time.ParseDuration(v); err != nil || minBuffer < 0 {
+			writeError(w, fmt.Sprintf("invalid minBuffer %q: must be a duration such as 15m", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := upstreamContext(r)
+	defer cancel()
+
+	srv, err := a.calendarService(ctx)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	events, err := a.listEvents(ctx, srv, q)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(travelGaps(events, q.Location, minBuffer)); err != nil {
+		logger.Errorf("Error encoding travel response %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func locatedAt(event *calendar.Event, location string) *calendar.Event {
+	event.Location = location
+	return event
+}
+
+func TestTravelGaps(t *testing.T) {
+	cal := ownedCalendar("work", "Work")
+	tests := []struct {
+		name   string
+		events []*calendar.Event
+		want   []float64
+		// wantShort flags which gaps are under the 15 minute buffer.
+		wantShort []bool
+	}{
+		{"enough time", []*calendar.Event{
+			locatedAt(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"), "Office"),
+			locatedAt(timedEvent("b", "Client", "2024-03-04T10:00:00Z", "2024-03-04T11:00:00Z"), "Client HQ"),
+		}, []float64{30}, []bool{false}},
+		{"too tight", []*calendar.Event{
+			locatedAt(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"), "Office"),
+			locatedAt(timedEvent("b", "Client", "2024-03-04T09:40:00Z", "2024-03-04T11:00:00Z"), "Client HQ"),
+		}, []float64{10}, []bool{true}},
+		{"overlapping", []*calendar.Event{
+			locatedAt(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"), "Office"),
+			locatedAt(timedEvent("b", "Client", "2024-03-04T09:15:00Z", "2024-03-04T11:00:00Z"), "Client HQ"),
+		}, []float64{-15}, []bool{true}},
+		{"same place", []*calendar.Event{
+			locatedAt(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"), "Office"),
+			locatedAt(timedEvent("b", "Review", "2024-03-04T09:30:00Z", "2024-03-04T10:00:00Z"), " office "),
+		}, []float64{}, []bool{}},
+		{"next day", []*calendar.Event{
+			locatedAt(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"), "Office"),
+			locatedAt(timedEvent("b", "Client", "2024-03-05T09:00:00Z", "2024-03-05T10:00:00Z"), "Client HQ"),
+		}, []float64{}, []bool{}},
+		{"unlocated in between", []*calendar.Event{
+			locatedAt(timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"), "Office"),
+			timedEvent("b", "Call", "2024-03-04T09:30:00Z", "2024-03-04T10:00:00Z"),
+			locatedAt(timedEvent("c", "Client", "2024-03-04T10:00:00Z", "2024-03-04T11:00:00Z"), "Client HQ"),
+		}, []float64{30}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gaps := travelGaps(statsFixtures(cal, tt.events...), time.UTC, defaultMinBuffer)
+			minutes, short := make([]float64, 0), make([]bool, 0)
+			for _, gap := range gaps {
+				minutes = append(minutes, gap.GapMinutes)
+				short = append(short, gap.Insufficient)
+			}
+			if !reflect.DeepEqual(minutes, tt.want) || !reflect.DeepEqual(short, tt.wantShort) {
+				t.Errorf("gaps %v insufficient %v, want %v insufficient %v", minutes, short, tt.want, tt.wantShort)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	// watchRenewBefore is how long before expiry a channel is replaced.
+	watchRenewBefore = time.Hour
+	// watchCheckInterval is how often channels are checked for renewal.
+	watchCheckInterval = 5 * time.Minute
+	webhookTimeout     = 10 * time.Second
+)
+
+// Push notification settings, set by the -notification-url, -watch-ttl and
+// -webhooks flags.
+var (
+	notificationURL string
+	watchTTL        = 24 * time.Hour
+	webhookURLs     []string
+)
+
+// watcher holds the active watch channels, nil when push notifications are
+// off.
+var watcher *watchManager
+
+// watchChannel is one registered Google watch channel on a calendar's events.
+type watchChannel struct {
+	id         string
+	resourceID string
+	calendarID string
+	token      string
+	expiration time.Time
+}
+
+// ChangeNotification is posted to each outbound webhook when Google reports
+// a change to a watched calendar.
+type ChangeNotification struct {
+	CalendarID    string    `json:"calendarId"`
+	ResourceState string    `json:"resourceState"`
+	MessageNumber int64     `json:"messageNumber"`
+	ChannelID     string    `json:"channelId"`
+	ReceivedAt    time.Time `json:"receivedAt"`
+}
+
+type watchManager struct {
+	mu       sync.Mutex
+	channels map[string]*watchChannel
+	client   *http.Client
+	// services supplies the server's own client, which the channels are
+	// registered with.
+	services serviceProvider
+}
+
+func newWatchManager(services serviceProvider) *watchManager {
+	return &watchManager{
+		channels: make(map[string]*watchChannel),
+		client:   &http.Client{Timeout: webhookTimeout},
+		services: services,
+	}
+}
+
+// parseWebhookURLs reads a comma-separated list of absolute http(s) URLs.
+func parseWebhookURLs(v string) ([]string, error) {
+	urls := make([]string, 0)
+	for _, raw := range strings.Split(v, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q: must be an absolute http or https URL", raw)
+		}
+		urls = append(urls, raw)
+	}
+	return urls, nil
+}
+
+// randomToken returns a URL-safe random string, used for channel IDs and
+// the secrets Google echoes back on each notification.
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// watch registers a channel for changes to calendarID's events.
+func (m *watchManager) watch(ctx context.Context, srv CalendarService, calendarID string) error {
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	req := &calendar.Channel{
+		Id:      id,
+		Type:    "web_hook",
+		Address: notificationURL,
+		Token:   token,
+		Params:  map[string]string{"ttl": strconv.FormatInt(int64(watchTTL/time.Second), 10)},
+	}
+
+	var ch *calendar.Channel
+	err = breaker.Do(func() (err error) {
+		ch, err = srv.WatchEvents(ctx, calendarID, req)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to watch calendar %s: %w", calendarID, err)
+	}
+
+	expiration := time.Now().Add(watchTTL)
+	if ch.Expiration > 0 {
+		expiration = time.Unix(0, ch.Expiration*int64(time.Millisecond))
+	}
+	m.mu.Lock()
+	m.channels[id] = &watchChannel{id: id, resourceID: ch.ResourceId, calendarID: calendarID, token: token, expiration: expiration}
+	m.mu.Unlock()
+	logger.Infof("Watching calendar %s on channel %s until %s", calendarID, id, expiration.Format(time.RFC3339))
+	return nil
+}
+
+// stop tells Google to stop sending notifications for a channel and forgets
+// it.
+func (m *watchManager) stop(ctx context.Context, srv CalendarService, ch *watchChannel) error {
+	m.mu.Lock()
+	delete(m.channels, ch.id)
+	m.mu.Unlock()
+	return breaker.Do(func() error {
+		return srv.StopChannel(ctx, &calendar.Channel{Id: ch.id, ResourceId: ch.resourceID})
+	})
+}
+
+// Start watches every calendar the service reads by default, then keeps the
+// channels renewed until shutdown, when they are stopped.
+func (m *watchManager) Start(ctx context.Context) error {
+	srv, err := m.services.Get(ctx, "")
+	if err != nil {
+		return err
+	}
+	calendars, err := selectCalendars(ctx, srv, eventQuery{})
+	if err != nil {
+		return err
+	}
+	for _, entry := range calendars {
+		if err := m.watch(ctx, srv, entry.Id); err != nil {
+			logger.Error(err)
+		}
+	}
+	lifecycle.Go(func(ctx context.Context) { m.renewLoop(ctx, srv) })
+	lifecycle.OnShutdown("stop watch channels", func(ctx context.Context) error {
+		m.StopAll(ctx)
+		return nil
+	})
+	return nil
+}
+
+// renewLoop replaces channels shortly before they expire, since Google
+// channels can't be extended.
+func (m *watchManager) renewLoop(ctx context.Context, srv CalendarService) {
+	ticker := time.NewTicker(watchCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		expiring := make([]*watchChannel, 0)
+		for _, ch := range m.channels {
+			if time.Until(ch.expiration) < watchRenewBefore {
+				expiring = append(expiring, ch)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, ch := range expiring {
+			if err := m.watch(ctx, srv, ch.calendarID); err != nil {
+				logger.Errorf("Unable to renew channel %s: %v", ch.id, err)
+				continue
+			}
+			if err := m.stop(ctx, srv, ch); err != nil {
+				logger.Errorf("Unable to stop replaced channel %s: %v", ch.id, err)
+			}
+		}
+	}
+}
+
+// StopAll stops every active channel, so Google doesn't keep notifying an
+// address that has gone away.
+func (m *watchManager) StopAll(ctx context.Context) {
+	srv, err := m.services.Get(ctx, "")
+	if err != nil {
+		logger.Errorf("Unable to stop watch channels: %v", err)
+		return
+	}
+	m.mu.Lock()
+	channels := make([]*watchChannel, 0, len(m.channels))
+	for _, ch := range m.channels {
+		channels = append(channels, ch)
+	}
+	m.mu.Unlock()
+	for _, ch := range channels {
+		if err := m.stop(ctx, srv, ch); err != nil {
+			logger.Errorf("Unable to stop channel %s: %v", ch.id, err)
+		}
+	}
+}
+
+// lookup returns the channel with the given ID if token matches its secret.
+func (m *watchManager) lookup(id, token string) (*watchChannel, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch, ok := m.channels[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(ch.token), []byte(token)) != 1 {
+		return nil, false
+	}
+	return ch, true
+}
+
+// fanOut posts a change notification to every webhook, logging failures.
+func (m *watchManager) fanOut(n ChangeNotification) {
+	body, err := json.Marshal(n)
+	if err != nil {
+		logger.Errorf("Error encoding change notification %v", err)
+		return
+	}
+	for _, target := range webhookURLs {
+		target := target
+		// Deliveries aren't cancelled at shutdown, which waits for them
+		// instead; the client timeout bounds them.
+		lifecycle.Go(func(context.Context) {
+			resp, err := m.client.Post(target, "application/json", bytes.NewReader(body))
+			if err != nil {
+				logger.Warnf("Webhook %s failed: %v", target, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				logger.Warnf("Webhook %s returned %s", target, resp.Status)
+			}
+		})
+	}
+}
+
+// NotificationsHandler receives Google's push notifications. Notifications
+// for unknown channels or with the wrong token are rejected; changes drop the
+// calendar's cached events, mark its synced copy stale, and are passed on to
+// the outbound webhooks.
+func (a *API) NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if watcher == nil {
+		writeError(w, "push notifications are not enabled", http.StatusNotFound)
+		return
+	}
+	ch, ok := watcher.lookup(r.Header.Get("X-Goog-Channel-ID"), r.Header.Get("X-Goog-Channel-Token"))
+	if !ok {
+		writeError(w, "unknown channel or token", http.StatusUnauthorized)
+		return
+	}
+
+	state := r.Header.Get("X-Goog-Resource-State")
+	// Google sends a sync message when a channel is created; it carries no
+	// change.
+	if state != "sync" {
+		a.events.FlushCalendar(ch.calendarID)
+		a.responses.Flush()
+		syncer.MarkStale(ch.calendarID)
+		number, _ := strconv.ParseInt(r.Header.Get("X-Goog-Message-Number"), 10, 64)
+		watcher.fanOut(ChangeNotification{
+			CalendarID:    ch.calendarID,
+			ResourceState: state,
+			MessageNumber: number,
+			ChannelID:     ch.id,
+			ReceivedAt:    time.Now(),
+		})
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// now is the clock used to compute default and relative time windows. It is
+// a variable so window calculations can be pinned to a fixed instant.
+var now = time.Now
+
+// defaultWindow is how far back a request without a window looks, set by the
+// -default-window flag.
+var defaultWindow = 30 * 24 * time.Hour
+
+// weekOffsets maps the window shortcuts to a week offset from the current one.
+var weekOffsets = map[string]int{
+	"lastWeek": -1,
+	"thisWeek": 0,
+	"nextWeek": 1,
+}
+
+// parseLocation reads the optional tz query parameter, defaulting to the
+// server's local time zone.
+func parseLocation(values url.Values) (*time.Location, error) {
+	tz := values.Get("tz")
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q: %v", tz, err)
+	}
+	return loc, nil
+}
+
+// parseWindow resolves the time window for a request from either the window
+// parameter or the from and to parameters (also accepted as timeMin and
+// timeMax), each an RFC3339 time, "now" or an offset from now such as -7d.
+// days sets the window's length ending at to. Without any of these it covers
+// the default window up to now; a missing from or to falls back to that
+// window's start or end.
+func parseWindow(values url.Values, loc *time.Location) (time.Time, time.Time, error) {
+	fromName, from, err := windowParam(values, "from", "timeMin")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	toName, to, err := windowParam(values, "to", "timeMax")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	days := values.Get("days")
+
+	if window := values.Get("window"); window != "" {
+		if from != "" || to != "" || days != "" {
+			return time.Time{}, time.Time{}, fmt.Errorf("window can't be combined with from, to or days")
+		}
+		return resolveWindow(window, loc)
+	}
+
+	t := now().In(loc)
+	start, end := t.Add(-defaultWindow), t
+	if to != "" {
+		if end, err = parseWindowTime(to, t); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid %s %q: %v", toName, to, err)
+		}
+	}
+	if from != "" {
+		if days != "" {
+			return time.Time{}, time.Time{}, fmt.Errorf("days can't be combined with from")
+		}
+		if start, err = parseWindowTime(from, t); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid %s %q: %v", fromName, from, err)
+		}
+	}
+	if days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid days %q: must be a positive integer", days)
+		}
+		start = end.AddDate(0, 0, -n)
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid window: from %s is after to %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start.In(loc), end.In(loc), nil
+}
+
+// windowRequested reports whether the request chose its own window.
+func windowRequested(values url.Values) bool {
+	for _, name := range []string{"window", "from", "to", "timeMin", "timeMax", "days"} {
+		if values.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// windowParam reads a window bound given under either of two names,
+// returning the name it was given under along with its value.
+func windowParam(values url.Values, name, alias string) (string, string, error) {
+	v, a := values.Get(name), values.Get(alias)
+	if v != "" && a != "" {
+		return "", "", fmt.Errorf("%s and %s can't both be given", name, alias)
+	}
+	if v == "" {
+		return alias, a, nil
+	}
+	return name, v, nil
+}
+
+// relativeUnits maps the unit suffixes of relative window times to durations.
+var relativeUnits = map[byte]time.Duration{
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// parseWindowTime parses an RFC3339 time, "now", or an offset from now
+// written as a count and unit (m, h, d or w), e.g. -7d or 2h. Offsets
+// without a sign are in the future, since an unescaped "+" in a query
+// string arrives as a space.
+func parseWindowTime(v string, now time.Time) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "now" {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	sign, offset := 1, strings.TrimPrefix(v, "+")
+	if strings.HasPrefix(offset, "-") {
+		sign, offset = -1, offset[1:]
+	}
+	if len(offset) >= 2 {
+		if unit, ok := relativeUnits[offset[len(offset)-1]]; ok {
+			if n, err := strconv.Atoi(offset[:len(offset)-1]); err == nil && n >= 0 {
+				return now.Add(time.Duration(sign*n) * unit), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("must be RFC3339, now, or an offset such as -7d")
+}
+
+// boundWindow fills in a missing window bound so Google is never asked for
+// an unbounded listing: a missing start is the default window before the
+// end, and a missing end is the default window after the start.
+func boundWindow(q eventQuery) eventQuery {
+	switch {
+	case q.TimeMin.IsZero() && q.TimeMax.IsZero():
+		q.TimeMax = now()
+		q.TimeMin = q.TimeMax.Add(-defaultWindow)
+	case q.TimeMin.IsZero():
+		q.TimeMin = q.TimeMax.Add(-defaultWindow)
+	case q.TimeMax.IsZero():
+		q.TimeMax = q.TimeMin.Add(defaultWindow)
+	}
+	return q
+}
+
+// resolveWindow resolves a named week shortcut, or an explicit interval
+// written as two RFC3339 times separated by a slash.
+func resolveWindow(window string, loc *time.Location) (time.Time, time.Time, error) {
+	if slash := strings.Index(window, "/"); slash >= 0 {
+		start, err := time.Parse(time.RFC3339, window[:slash])
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid window start %q: must be RFC3339", window[:slash])
+		}
+		end, err := time.Parse(time.RFC3339, window[slash+1:])
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid window end %q: must be RFC3339", window[slash+1:])
+		}
+		if !start.Before(end) {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid window %q: start must be before end", window)
+		}
+		return start.In(loc), end.In(loc), nil
+	}
+
+	offset, ok := weekOffsets[window]
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid window %q: must be one of lastWeek, thisWeek, nextWeek or start/end", window)
+	}
+	start := startOfWeek(now().In(loc)).AddDate(0, 0, 7*offset)
+	return start, start.AddDate(0, 0, 7), nil
+}
+
+// startOfWeek returns Monday 00:00 of the ISO week containing t, in t's
+// location.
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -daysSinceMonday).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestResolveWindow(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		at        time.Time
+		window    string
+		loc       *time.Location
+		wantStart string
+		wantEnd   string
+	}{
+		{"thisWeek midweek", time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC), "thisWeek", time.UTC, "2024-03-04T00:00:00Z", "2024-03-11T00:00:00Z"},
+		{"thisWeek on Monday", time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), "thisWeek", time.UTC, "2024-03-04T00:00:00Z", "2024-03-11T00:00:00Z"},
+		{"thisWeek on Sunday", time.Date(2024, 3, 10, 23, 59, 0, 0, time.UTC), "thisWeek", time.UTC, "2024-03-04T00:00:00Z", "2024-03-11T00:00:00Z"},
+		{"lastWeek", time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC), "lastWeek", time.UTC, "2024-02-26T00:00:00Z", "2024-03-04T00:00:00Z"},
+		{"nextWeek across a year", time.Date(2024, 12, 27, 9, 0, 0, 0, time.UTC), "nextWeek", time.UTC, "2024-12-30T00:00:00Z", "2025-01-06T00:00:00Z"},
+		// Still Sunday in New York, so the week began the Monday before.
+		{"thisWeek in tz", time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC), "thisWeek", newYork, "2024-03-04T00:00:00-05:00", "2024-03-11T00:00:00-04:00"},
+		{"explicit interval", time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC), "2024-01-01T00:00:00Z/2024-01-02T00:00:00Z", time.UTC, "2024-01-01T00:00:00Z", "2024-01-02T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setNow(t, tt.at)
+			start, end, err := resolveWindow(tt.window, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := start.Format(time.RFC3339); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := end.Format(time.RFC3339); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	at := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query     string
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{"", "2024-02-05T15:00:00Z", "2024-03-06T15:00:00Z", false},
+		{"window=thisWeek", "2024-03-04T00:00:00Z", "2024-03-11T00:00:00Z", false},
+		{"from=-7d&to=now", "2024-02-28T15:00:00Z", "2024-03-06T15:00:00Z", false},
+		{"timeMin=2024-03-01T00:00:00Z&timeMax=2024-03-02T00:00:00Z", "2024-03-01T00:00:00Z", "2024-03-02T00:00:00Z", false},
+		{"to=2024-03-10T00:00:00Z&days=3", "2024-03-07T00:00:00Z", "2024-03-10T00:00:00Z", false},
+		{"window=thisWeek&from=-1d", "", "", true},
+		{"from=2024-03-02T00:00:00Z&to=2024-03-01T00:00:00Z", "", "", true},
+		{"from=yesterday", "", "", true},
+		{"days=0", "", "", true},
+		{"from=-1d&timeMin=-2d", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setNow(t, at)
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start, end, err := parseWindow(values, time.UTC)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseWindow() = %v, %v; want an error", start, end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := start.Format(time.RFC3339); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := end.Format(time.RFC3339); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestBoundWindow(t *testing.T) {
+	at := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		q                eventQuery
+		wantMin, wantMax time.Time
+	}{
+		{"unbounded", eventQuery{}, at.Add(-defaultWindow), at},
+		{"no start", eventQuery{TimeMax: end}, end.Add(-defaultWindow), end},
+		{"no end", eventQuery{TimeMin: start}, start, start.Add(defaultWindow)},
+		{"bounded", eventQuery{TimeMin: start, TimeMax: end}, start, end},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setNow(t, at)
+			q := boundWindow(tt.q)
+			if !q.TimeMin.Equal(tt.wantMin) || !q.TimeMax.Equal(tt.wantMax) {
+				t.Errorf("window %v to %v, want %v to %v", q.TimeMin, q.TimeMax, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRequestWithoutWindowIsBounded(t *testing.T) {
+	at := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	setNow(t, at)
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com", timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"))
+
+	listCalendar(t, newTestAPI(srv), "/calendar")
+	calls := srv.eventListCalls()
+	if len(calls) == 0 {
+		t.Fatal("no Events.List calls")
+	}
+	for _, opts := range calls {
+		if !opts.TimeMin.Equal(at.Add(-defaultWindow)) || !opts.TimeMax.Equal(at) {
+			t.Errorf("Events.List from %v to %v, want the default window ending %v", opts.TimeMin, opts.TimeMax, at)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	xlsxEventsSheet  = "Events"
+	xlsxSummarySheet = "Summary"
+)
+
+// writeXLSX writes a workbook with an Events sheet listing every event and
+// a Summary sheet of per-calendar totals. An empty result still gets the
+// header rows.
+func writeXLSX(w io.Writer, events []calendarEvent, q eventQuery) error {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", xlsxEventsSheet)
+	f.NewSheet(xlsxSummarySheet)
+
+	rows := [][]interface{}{{"Calendar", "Summary", "Start", "End", "Minutes", "Recurring", "Attendees"}}
+	totals := make([]CalendarTotal, 0)
+	index := make(map[string]int)
+	for _, ce := range events {
+		summary, err := summarizeEvent(ce, q)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{
+			summary.Calendar,
+			summary.Summary,
+			rawEventTime(ce.Event.Start),
+			rawEventTime(ce.Event.End),
+			summary.EventTime,
+			summary.RecurringEvent,
+			summary.AttendeeCount,
+		})
+
+		i, ok := index[summary.Calendar]
+		if !ok {
+			i = len(totals)
+			index[summary.Calendar] = i
+			totals = append(totals, CalendarTotal{Calendar: summary.Calendar})
+		}
+		totals[i].TotalMinutes += summary.EventTime
+		totals[i].EventCount++
+	}
+	if err := setXLSXRows(f, xlsxEventsSheet, rows); err != nil {
+		return err
+	}
+
+	summaryRows := [][]interface{}{{"Calendar", "Total minutes", "Events"}}
+	for _, t := range totals {
+		summaryRows = append(summaryRows, []interface{}{t.Calendar, t.TotalMinutes, t.EventCount})
+	}
+	if err := setXLSXRows(f, xlsxSummarySheet, summaryRows); err != nil {
+		return err
+	}
+
+	f.SetColWidth(xlsxEventsSheet, "A", "D", 24)
+	f.SetColWidth(xlsxSummarySheet, "A", "A", 24)
+	return f.Write(w)
+}
+
+// setXLSXRows writes rows to sheet starting at A1.
+func setXLSXRows(f *excelize.File, sheet string, rows [][]interface{}) error {
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
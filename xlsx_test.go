@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestXLSXExport(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		// want maps sheet!cell to its expected value.
+		want map[string]string
+	}{
+		{"events", "&from=2024-03-01T00:00:00Z&to=2024-03-31T00:00:00Z", map[string]string{
+			"Events!A1":  "Calendar",
+			"Events!B2":  "Standup",
+			"Events!C2":  "2024-03-04T09:00:00Z",
+			"Events!E2":  "30",
+			"Events!B3":  "Planning",
+			"Summary!A2": "me@example.com",
+			"Summary!B2": "120",
+			"Summary!C2": "2",
+		}},
+		{"empty", "&from=2023-01-01T00:00:00Z&to=2023-01-31T00:00:00Z", map[string]string{
+			"Events!A1":  "Calendar",
+			"Events!G1":  "Attendees",
+			"Events!A2":  "",
+			"Summary!C1": "Events",
+			"Summary!A2": "",
+		}},
+	}
+	srv := newFakeService(primaryCalendar("me@example.com"))
+	srv.addEvents("me@example.com",
+		timedEvent("a", "Standup", "2024-03-04T09:00:00Z", "2024-03-04T09:30:00Z"),
+		timedEvent("b", "Planning", "2024-03-05T13:00:00Z", "2024-03-05T14:30:00Z"),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(newTestAPI(srv).CalendarHandler, "/calendar?format=xlsx"+tt.query)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="calendar.xlsx"` {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+			f, err := excelize.OpenReader(rec.Body)
+			if err != nil {
+				t.Fatalf("opening workbook: %v", err)
+			}
+			for ref, want := range tt.want {
+				parts := strings.SplitN(ref, "!", 2)
+				got, err := f.GetCellValue(parts[0], parts[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("%s = %q, want %q", ref, got, want)
+				}
+			}
+		})
+	}
+}